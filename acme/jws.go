@@ -0,0 +1,177 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512" // registers SHA-384 and SHA-512 for ES384 and ES512
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// jws is a flattened JSON Web Signature, as used by every ACME POST request.
+type jws struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// jwsHeader is the protected header of an ACME request, which includes
+// either the account's jwk or its kid.
+type jwsHeader struct {
+	Alg   string          `json:"alg"`
+	Nonce string          `json:"nonce"`
+	URL   string          `json:"url"`
+	JWK   json.RawMessage `json:"jwk,omitempty"`
+	KID   string          `json:"kid,omitempty"`
+}
+
+// jwk is a JSON Web Key for an RSA or ECDSA public key.
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+var b64 = base64.RawURLEncoding
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := b64.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// parseJWK parses an RSA or ECDSA public key from its JWK encoding.
+func parseJWK(data []byte) (crypto.PublicKey, error) {
+	var k jwk
+	err := json.Unmarshal(data, &k)
+	if err != nil {
+		return nil, err
+	}
+
+	switch k.Kty {
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("invalid EC public key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		if n.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// thumbprint returns the RFC 7638 JWK thumbprint of a public key, which
+// is used to build challenge key authorizations.
+func thumbprint(pub crypto.PublicKey) (string, error) {
+	var canonical string
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`,
+			k.Curve.Params().Name,
+			b64.EncodeToString(k.X.FillBytes(make([]byte, size))),
+			b64.EncodeToString(k.Y.FillBytes(make([]byte, size))),
+		)
+	case *rsa.PublicKey:
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`,
+			b64.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+			b64.EncodeToString(k.N.Bytes()),
+		)
+	default:
+		return "", fmt.Errorf("unsupported key type %T", pub)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return b64.EncodeToString(sum[:]), nil
+}
+
+// verify checks the JWS signature using the given public key.
+func (j *jws) verify(alg string, pub crypto.PublicKey) error {
+	signed := []byte(j.Protected + "." + j.Payload)
+	sig, err := b64.DecodeString(j.Signature)
+	if err != nil {
+		return err
+	}
+
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		var (
+			hash     crypto.Hash
+			wantBits int
+		)
+		switch alg {
+		case "ES256":
+			hash, wantBits = crypto.SHA256, 256
+		case "ES384":
+			hash, wantBits = crypto.SHA384, 384
+		case "ES512":
+			hash, wantBits = crypto.SHA512, 521
+		}
+		if k.Curve.Params().BitSize != wantBits {
+			return fmt.Errorf("algorithm %q does not match EC key", alg)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return fmt.Errorf("invalid signature length")
+		}
+		h := hash.New()
+		h.Write(signed)
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, h.Sum(nil), r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			return fmt.Errorf("algorithm %q does not match RSA key", alg)
+		}
+		sum := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig)
+	default:
+		return fmt.Errorf("unsupported key type %T", pub)
+	}
+}
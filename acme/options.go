@@ -0,0 +1,117 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+)
+
+// DefaultCertLifetime is the default lifetime of issued certs.
+const DefaultCertLifetime = 90 * 24 * time.Hour
+
+// Options contains each available configuration option
+// for a Server.
+type Options struct {
+	CertLifetime    time.Duration
+	HTTP01Port      int
+	TLSALPN01Port   int
+	DialContext     func(ctx context.Context, network, addr string) (net.Conn, error)
+	ValidateTimeout time.Duration
+	Recorder        cert.Recorder
+	OrderLifetime   time.Duration
+	AllowedDomains  []string
+}
+
+// Option implements a hook to customize a Server
+// using the NewServer function.
+type Option func(*Options) error
+
+// WithCertLifetime sets the lifetime of issued certs.
+func WithCertLifetime(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return fmt.Errorf("cert lifetime %v must be positive", d)
+		}
+		o.CertLifetime = d
+		return nil
+	}
+}
+
+// WithHTTP01Port sets the port http-01 challenges are validated on,
+// instead of port 80.
+func WithHTTP01Port(port int) Option {
+	return func(o *Options) error {
+		o.HTTP01Port = port
+		return nil
+	}
+}
+
+// WithTLSALPN01Port sets the port tls-alpn-01 challenges are validated
+// on, instead of port 443.
+func WithTLSALPN01Port(port int) Option {
+	return func(o *Options) error {
+		o.TLSALPN01Port = port
+		return nil
+	}
+}
+
+// WithDialContext sets the function used to connect to validation
+// targets, which can be used to restrict or redirect them.
+func WithDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return func(o *Options) error {
+		o.DialContext = dial
+		return nil
+	}
+}
+
+// WithValidateTimeout sets how long a single challenge validation may
+// take before it fails.
+func WithValidateTimeout(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return fmt.Errorf("validate timeout %v must be positive", d)
+		}
+		o.ValidateTimeout = d
+		return nil
+	}
+}
+
+// WithRecorder records every issued cert using the given Recorder, with
+// the ACME account URL as the requester.
+func WithRecorder(r cert.Recorder) Option {
+	return func(o *Options) error {
+		o.Recorder = r
+		return nil
+	}
+}
+
+// WithOrderLifetime sets how long orders and their authorizations stay
+// usable before they expire.
+func WithOrderLifetime(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return fmt.Errorf("order lifetime %v must be positive", d)
+		}
+		o.OrderLifetime = d
+		return nil
+	}
+}
+
+// WithAllowedDomains only allows orders for the given domains. A domain
+// starting with "*." allows any of its subdomains, but not itself. By
+// default, any domain is allowed.
+func WithAllowedDomains(domains ...string) Option {
+	return func(o *Options) error {
+		for _, domain := range domains {
+			if !validDNSName(strings.TrimPrefix(strings.ToLower(domain), "*.")) {
+				return fmt.Errorf("allowed domain %q is not a valid DNS name", domain)
+			}
+			o.AllowedDomains = append(o.AllowedDomains, strings.ToLower(domain))
+		}
+		return nil
+	}
+}
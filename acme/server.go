@@ -0,0 +1,905 @@
+// Package acme implements an RFC 8555 ACME server backed by the cert
+// package, so existing ACME clients can obtain certificates from an
+// internal CA. Domains are validated using the http-01 and tls-alpn-01
+// challenge types.
+package acme
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+)
+
+const (
+	statusPending    = "pending"
+	statusProcessing = "processing"
+	statusReady      = "ready"
+	statusValid      = "valid"
+	statusInvalid    = "invalid"
+	statusExpired    = "expired"
+)
+
+// DefaultOrderLifetime is the default lifetime of orders and their
+// authorizations.
+const DefaultOrderLifetime = 7 * 24 * time.Hour
+
+// maxRequestSize limits the size of request bodies.
+const maxRequestSize = 1 << 20
+
+// maxNonces limits how many unused nonces are remembered.
+const maxNonces = 10000
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type account struct {
+	id         string
+	key        crypto.PublicKey
+	thumbprint string
+	status     string
+	contact    []string
+}
+
+type order struct {
+	id          string
+	accountID   string
+	status      string
+	expires     time.Time
+	identifiers []identifier
+	authzIDs    []string
+	certID      string
+	err         *problem
+}
+
+type authorization struct {
+	id           string
+	accountID    string
+	identifier   identifier
+	status       string
+	expires      time.Time
+	challengeIDs []string
+}
+
+type challenge struct {
+	id        string
+	authzID   string
+	typ       string
+	token     string
+	status    string
+	validated time.Time
+	err       *problem
+}
+
+// Server is an ACME server, which implements http.Handler.
+type Server struct {
+	baseURL      *url.URL
+	caCertPEM    []byte
+	caPrivKeyPEM []byte
+	options      *Options
+
+	mu           sync.Mutex
+	nonces       map[string]bool
+	accounts     map[string]*account
+	accountsByTP map[string]*account
+	orders       map[string]*order
+	authzs       map[string]*authorization
+	challenges   map[string]*challenge
+	certs        map[string][]byte
+}
+
+// NewServer creates a new Server from the PEM encoded CA private key and
+// cert, applying the given Option(s). The baseURL is the external URL
+// the Server's handler is reachable at, such as "https://ca.internal/acme".
+// The ACME directory is served at baseURL + "/directory".
+func NewServer(baseURL string, caPrivKeyPEM, caCertPEM io.Reader, opts ...Option) (*Server, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("base URL %q must be absolute", baseURL)
+	}
+
+	serverOptions := &Options{
+		CertLifetime:    DefaultCertLifetime,
+		HTTP01Port:      80,
+		TLSALPN01Port:   443,
+		ValidateTimeout: 10 * time.Second,
+		OrderLifetime:   DefaultOrderLifetime,
+	}
+
+	for _, opt := range opts {
+		err := opt(serverOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	caCertPEMBytes, err := ioutil.ReadAll(caCertPEM)
+	if err != nil {
+		return nil, err
+	}
+	caPrivKeyPEMBytes, err := ioutil.ReadAll(caPrivKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	// make sure the CA cert and key can be used before accepting requests
+	_, _, err = cert.ReadCertAndKey(bytes.NewReader(caCertPEMBytes), bytes.NewReader(caPrivKeyPEMBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		baseURL:      u,
+		caCertPEM:    caCertPEMBytes,
+		caPrivKeyPEM: caPrivKeyPEMBytes,
+		options:      serverOptions,
+		nonces:       map[string]bool{},
+		accounts:     map[string]*account{},
+		accountsByTP: map[string]*account{},
+		orders:       map[string]*order{},
+		authzs:       map[string]*authorization{},
+		challenges:   map[string]*challenge{},
+		certs:        map[string][]byte{},
+	}, nil
+}
+
+// DirectoryURL returns the URL of the ACME directory, which ACME
+// clients are configured with.
+func (s *Server) DirectoryURL() string {
+	return s.url("/directory")
+}
+
+func (s *Server) url(path string) string {
+	return s.baseURL.String() + path
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return b64.EncodeToString(b)
+}
+
+func (s *Server) newNonce() string {
+	nonce := newID()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.nonces) >= maxNonces {
+		s.nonces = map[string]bool{}
+	}
+	s.nonces[nonce] = true
+	return nonce
+}
+
+func (s *Server) useNonce(nonce string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.nonces[nonce] {
+		return false
+	}
+	delete(s.nonces, nonce)
+	return true
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", s.newNonce())
+	w.Header().Set("Cache-Control", "no-store")
+
+	path := strings.TrimPrefix(r.URL.Path, s.baseURL.Path)
+	resource, id := path, ""
+	if parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 3); len(parts) >= 2 {
+		resource, id = "/"+parts[0], parts[1]
+		if len(parts) == 3 {
+			resource += "/" + parts[2]
+		}
+	}
+
+	switch {
+	case path == "/directory" && r.Method == http.MethodGet:
+		s.handleDirectory(w, r)
+		return
+	case path == "/new-nonce" && (r.Method == http.MethodHead || r.Method == http.MethodGet):
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	case r.Method != http.MethodPost:
+		writeProblem(w, &problem{Type: "malformed", Detail: "method not allowed", Status: http.StatusMethodNotAllowed})
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/jose+json" {
+		writeProblem(w, &problem{Type: "malformed", Detail: "content type must be application/jose+json", Status: http.StatusUnsupportedMediaType})
+		return
+	}
+
+	req, prob := s.parseRequest(r, path == "/new-account")
+	if prob != nil {
+		writeProblem(w, prob)
+		return
+	}
+
+	switch {
+	case path == "/new-account":
+		s.handleNewAccount(w, req)
+	case path == "/new-order":
+		s.handleNewOrder(w, req)
+	case resource == "/account" && id != "":
+		s.handleAccount(w, req, id)
+	case resource == "/order" && id != "":
+		s.handleOrder(w, req, id)
+	case resource == "/order/finalize" && id != "":
+		s.handleFinalize(w, req, id)
+	case resource == "/authz" && id != "":
+		s.handleAuthz(w, req, id)
+	case resource == "/challenge" && id != "":
+		s.handleChallenge(w, req, id)
+	case resource == "/cert" && id != "":
+		s.handleCert(w, req, id)
+	default:
+		writeProblem(w, &problem{Type: "malformed", Detail: "not found", Status: http.StatusNotFound})
+	}
+}
+
+func (s *Server) handleDirectory(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"newNonce":   s.url("/new-nonce"),
+		"newAccount": s.url("/new-account"),
+		"newOrder":   s.url("/new-order"),
+		"meta": map[string]interface{}{
+			"externalAccountRequired": false,
+		},
+	})
+}
+
+// request is a verified ACME POST request.
+type request struct {
+	url     string
+	account *account
+	key     crypto.PublicKey
+	payload []byte
+}
+
+func (r *request) postAsGet() bool {
+	return len(r.payload) == 0
+}
+
+// parseRequest verifies the JWS of an ACME POST request. The request must
+// be signed using an account's kid, unless jwkAllowed is set, in which
+// case it must be signed using a jwk instead.
+func (s *Server) parseRequest(r *http.Request, jwkAllowed bool) (*request, *problem) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		return nil, &problem{Type: "malformed", Detail: err.Error()}
+	}
+
+	var j jws
+	err = json.Unmarshal(body, &j)
+	if err != nil {
+		return nil, &problem{Type: "malformed", Detail: "invalid JWS: " + err.Error()}
+	}
+
+	headerJSON, err := b64.DecodeString(j.Protected)
+	if err != nil {
+		return nil, &problem{Type: "malformed", Detail: "invalid protected header: " + err.Error()}
+	}
+	var header jwsHeader
+	err = json.Unmarshal(headerJSON, &header)
+	if err != nil {
+		return nil, &problem{Type: "malformed", Detail: "invalid protected header: " + err.Error()}
+	}
+
+	if !s.useNonce(header.Nonce) {
+		return nil, &problem{Type: "badNonce", Detail: "invalid or reused nonce"}
+	}
+
+	req := &request{url: s.baseURL.Scheme + "://" + s.baseURL.Host + r.URL.Path}
+	if header.URL != req.url {
+		return nil, &problem{Type: "unauthorized", Detail: fmt.Sprintf("JWS url %q does not match request url", header.URL), Status: http.StatusUnauthorized}
+	}
+
+	switch {
+	case jwkAllowed && len(header.JWK) > 0 && header.KID == "":
+		req.key, err = parseJWK(header.JWK)
+		if err != nil {
+			return nil, &problem{Type: "badPublicKey", Detail: err.Error()}
+		}
+	case !jwkAllowed && header.KID != "" && len(header.JWK) == 0:
+		id := strings.TrimPrefix(header.KID, s.url("/account/"))
+		s.mu.Lock()
+		req.account = s.accounts[id]
+		var status string
+		if req.account != nil {
+			status = req.account.status
+		}
+		s.mu.Unlock()
+		if req.account == nil || header.KID != s.url("/account/"+id) {
+			return nil, &problem{Type: "accountDoesNotExist", Detail: "unknown account", Status: http.StatusUnauthorized}
+		}
+		if status != statusValid {
+			return nil, &problem{Type: "unauthorized", Detail: "account is not valid", Status: http.StatusUnauthorized}
+		}
+		req.key = req.account.key
+	case jwkAllowed:
+		return nil, &problem{Type: "malformed", Detail: "request must be signed with a jwk"}
+	default:
+		return nil, &problem{Type: "malformed", Detail: "request must be signed with an account kid"}
+	}
+
+	err = j.verify(header.Alg, req.key)
+	if err != nil {
+		return nil, &problem{Type: "unauthorized", Detail: "invalid JWS signature: " + err.Error(), Status: http.StatusUnauthorized}
+	}
+
+	req.payload, err = b64.DecodeString(j.Payload)
+	if err != nil {
+		return nil, &problem{Type: "malformed", Detail: "invalid payload: " + err.Error()}
+	}
+
+	return req, nil
+}
+
+func (s *Server) accountJSON(a *account) map[string]interface{} {
+	return map[string]interface{}{
+		"status":  a.status,
+		"contact": a.contact,
+	}
+}
+
+func (s *Server) handleNewAccount(w http.ResponseWriter, req *request) {
+	var payload struct {
+		Contact              []string `json:"contact"`
+		TermsOfServiceAgreed bool     `json:"termsOfServiceAgreed"`
+		OnlyReturnExisting   bool     `json:"onlyReturnExisting"`
+	}
+	err := json.Unmarshal(req.payload, &payload)
+	if err != nil {
+		writeProblem(w, &problem{Type: "malformed", Detail: err.Error()})
+		return
+	}
+
+	tp, err := thumbprint(req.key)
+	if err != nil {
+		writeProblem(w, &problem{Type: "badPublicKey", Detail: err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.accountsByTP[tp]; ok {
+		w.Header().Set("Location", s.url("/account/"+existing.id))
+		writeJSON(w, http.StatusOK, s.accountJSON(existing))
+		return
+	}
+	if payload.OnlyReturnExisting {
+		writeProblem(w, &problem{Type: "accountDoesNotExist", Detail: "no account exists for this key"})
+		return
+	}
+
+	a := &account{
+		id:         newID(),
+		key:        req.key,
+		thumbprint: tp,
+		status:     statusValid,
+		contact:    payload.Contact,
+	}
+	s.accounts[a.id] = a
+	s.accountsByTP[tp] = a
+
+	w.Header().Set("Location", s.url("/account/"+a.id))
+	writeJSON(w, http.StatusCreated, s.accountJSON(a))
+}
+
+func (s *Server) handleAccount(w http.ResponseWriter, req *request, id string) {
+	if req.account.id != id {
+		writeProblem(w, &problem{Type: "unauthorized", Detail: "account does not match", Status: http.StatusForbidden})
+		return
+	}
+
+	var payload struct {
+		Contact []string `json:"contact"`
+		Status  string   `json:"status"`
+	}
+	if !req.postAsGet() {
+		err := json.Unmarshal(req.payload, &payload)
+		if err != nil {
+			writeProblem(w, &problem{Type: "malformed", Detail: err.Error()})
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if payload.Contact != nil {
+		req.account.contact = payload.Contact
+	}
+	if payload.Status == "deactivated" {
+		req.account.status = "deactivated"
+	}
+
+	w.Header().Set("Location", s.url("/account/"+id))
+	writeJSON(w, http.StatusOK, s.accountJSON(req.account))
+}
+
+func (s *Server) handleNewOrder(w http.ResponseWriter, req *request) {
+	var payload struct {
+		Identifiers []identifier `json:"identifiers"`
+	}
+	err := json.Unmarshal(req.payload, &payload)
+	if err != nil {
+		writeProblem(w, &problem{Type: "malformed", Detail: err.Error()})
+		return
+	}
+	if len(payload.Identifiers) == 0 {
+		writeProblem(w, &problem{Type: "malformed", Detail: "at least one identifier is required"})
+		return
+	}
+
+	o := &order{
+		id:        newID(),
+		accountID: req.account.id,
+		status:    statusPending,
+		expires:   time.Now().Add(s.options.OrderLifetime),
+	}
+
+	seen := map[string]bool{}
+	for _, id := range payload.Identifiers {
+		if id.Type != "dns" {
+			writeProblem(w, &problem{Type: "unsupportedIdentifier", Detail: fmt.Sprintf("identifier type %q is not supported", id.Type)})
+			return
+		}
+		id.Value = strings.ToLower(id.Value)
+		if !validDNSName(id.Value) {
+			writeProblem(w, &problem{Type: "rejectedIdentifier", Detail: fmt.Sprintf("identifier %q is not a valid DNS name", id.Value)})
+			return
+		}
+		if !s.domainAllowed(id.Value) {
+			writeProblem(w, &problem{Type: "rejectedIdentifier", Detail: fmt.Sprintf("identifier %q is not allowed", id.Value)})
+			return
+		}
+		if !seen[id.Value] {
+			seen[id.Value] = true
+			o.identifiers = append(o.identifiers, id)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeExpired()
+
+	for _, id := range o.identifiers {
+		z := &authorization{
+			id:         newID(),
+			accountID:  req.account.id,
+			identifier: id,
+			status:     statusPending,
+			expires:    o.expires,
+		}
+		for _, typ := range []string{"http-01", "tls-alpn-01"} {
+			c := &challenge{
+				id:      newID(),
+				authzID: z.id,
+				typ:     typ,
+				token:   newID(),
+				status:  statusPending,
+			}
+			s.challenges[c.id] = c
+			z.challengeIDs = append(z.challengeIDs, c.id)
+		}
+		s.authzs[z.id] = z
+		o.authzIDs = append(o.authzIDs, z.id)
+	}
+	s.orders[o.id] = o
+
+	w.Header().Set("Location", s.url("/order/"+o.id))
+	writeJSON(w, http.StatusCreated, s.orderJSON(o))
+}
+
+// removeExpired forgets orders that have expired, along with their
+// authorizations, challenges and certs. It must be called with s.mu held.
+func (s *Server) removeExpired() {
+	now := time.Now()
+	for id, o := range s.orders {
+		if now.Before(o.expires) {
+			continue
+		}
+		for _, authzID := range o.authzIDs {
+			for _, challengeID := range s.authzs[authzID].challengeIDs {
+				delete(s.challenges, challengeID)
+			}
+			delete(s.authzs, authzID)
+		}
+		delete(s.certs, o.certID)
+		delete(s.orders, id)
+	}
+}
+
+// updateAuthzStatus expires a pending authorization after its expiry.
+// It must be called with s.mu held.
+func (s *Server) updateAuthzStatus(z *authorization) {
+	if z.status == statusPending && !time.Now().Before(z.expires) {
+		z.status = statusExpired
+	}
+}
+
+// updateOrderStatus moves a pending order to ready or invalid based on
+// its authorizations, and invalidates orders that weren't finalized
+// before their expiry. It must be called with s.mu held.
+func (s *Server) updateOrderStatus(o *order) {
+	if (o.status == statusPending || o.status == statusReady) && !time.Now().Before(o.expires) {
+		o.status = statusInvalid
+		o.err = &problem{Type: "malformed", Detail: "order expired"}
+		return
+	}
+	if o.status != statusPending {
+		return
+	}
+	ready := true
+	for _, id := range o.authzIDs {
+		z := s.authzs[id]
+		s.updateAuthzStatus(z)
+		switch z.status {
+		case statusInvalid, statusExpired:
+			o.status = statusInvalid
+			o.err = &problem{Type: "unauthorized", Detail: "an authorization failed"}
+			return
+		case statusValid:
+		default:
+			ready = false
+		}
+	}
+	if ready {
+		o.status = statusReady
+	}
+}
+
+// orderJSON must be called with s.mu held.
+func (s *Server) orderJSON(o *order) map[string]interface{} {
+	s.updateOrderStatus(o)
+
+	var authzURLs []string
+	for _, id := range o.authzIDs {
+		authzURLs = append(authzURLs, s.url("/authz/"+id))
+	}
+	v := map[string]interface{}{
+		"status":         o.status,
+		"expires":        o.expires.Format(time.RFC3339),
+		"identifiers":    o.identifiers,
+		"authorizations": authzURLs,
+		"finalize":       s.url("/order/" + o.id + "/finalize"),
+	}
+	if o.certID != "" {
+		v["certificate"] = s.url("/cert/" + o.certID)
+	}
+	if o.err != nil {
+		v["error"] = o.err.withDefaults()
+	}
+	return v
+}
+
+func (s *Server) handleOrder(w http.ResponseWriter, req *request, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[id]
+	if !ok || o.accountID != req.account.id {
+		writeProblem(w, &problem{Type: "malformed", Detail: "order not found", Status: http.StatusNotFound})
+		return
+	}
+
+	w.Header().Set("Location", s.url("/order/"+id))
+	writeJSON(w, http.StatusOK, s.orderJSON(o))
+}
+
+// authzJSON must be called with s.mu held.
+func (s *Server) authzJSON(z *authorization) map[string]interface{} {
+	s.updateAuthzStatus(z)
+
+	var challenges []interface{}
+	for _, id := range z.challengeIDs {
+		challenges = append(challenges, s.challengeJSON(s.challenges[id]))
+	}
+	return map[string]interface{}{
+		"status":     z.status,
+		"expires":    z.expires.Format(time.RFC3339),
+		"identifier": z.identifier,
+		"challenges": challenges,
+	}
+}
+
+// challengeJSON must be called with s.mu held.
+func (s *Server) challengeJSON(c *challenge) map[string]interface{} {
+	v := map[string]interface{}{
+		"type":   c.typ,
+		"url":    s.url("/challenge/" + c.id),
+		"token":  c.token,
+		"status": c.status,
+	}
+	if !c.validated.IsZero() {
+		v["validated"] = c.validated.Format(time.RFC3339)
+	}
+	if c.err != nil {
+		v["error"] = c.err.withDefaults()
+	}
+	return v
+}
+
+func (s *Server) handleAuthz(w http.ResponseWriter, req *request, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z, ok := s.authzs[id]
+	if !ok || z.accountID != req.account.id {
+		writeProblem(w, &problem{Type: "malformed", Detail: "authorization not found", Status: http.StatusNotFound})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.authzJSON(z))
+}
+
+func (s *Server) handleChallenge(w http.ResponseWriter, req *request, id string) {
+	s.mu.Lock()
+	c, ok := s.challenges[id]
+	var z *authorization
+	if ok {
+		z = s.authzs[c.authzID]
+	}
+	if !ok || z.accountID != req.account.id {
+		s.mu.Unlock()
+		writeProblem(w, &problem{Type: "malformed", Detail: "challenge not found", Status: http.StatusNotFound})
+		return
+	}
+
+	s.updateAuthzStatus(z)
+	validate := !req.postAsGet() && c.status == statusPending && z.status == statusPending
+	if validate {
+		c.status = statusProcessing
+	}
+	s.mu.Unlock()
+
+	if validate {
+		keyAuth := c.token + "." + req.account.thumbprint
+		err := s.validate(c.typ, z.identifier.Value, c.token, keyAuth)
+
+		s.mu.Lock()
+		c.validated = time.Now()
+		if err != nil {
+			c.status = statusInvalid
+			c.err = &problem{Type: "incorrectResponse", Detail: err.Error()}
+			z.status = statusInvalid
+		} else {
+			c.status = statusValid
+			z.status = statusValid
+		}
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Add("Link", fmt.Sprintf("<%s>;rel=\"up\"", s.url("/authz/"+z.id)))
+	writeJSON(w, http.StatusOK, s.challengeJSON(c))
+}
+
+func (s *Server) handleFinalize(w http.ResponseWriter, req *request, id string) {
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+	err := json.Unmarshal(req.payload, &payload)
+	if err != nil {
+		writeProblem(w, &problem{Type: "malformed", Detail: err.Error()})
+		return
+	}
+
+	csrDER, err := b64.DecodeString(payload.CSR)
+	if err != nil {
+		writeProblem(w, &problem{Type: "badCSR", Detail: err.Error()})
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		writeProblem(w, &problem{Type: "badCSR", Detail: err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	o, ok := s.orders[id]
+	if !ok || o.accountID != req.account.id {
+		s.mu.Unlock()
+		writeProblem(w, &problem{Type: "malformed", Detail: "order not found", Status: http.StatusNotFound})
+		return
+	}
+	s.updateOrderStatus(o)
+	if o.status != statusReady {
+		s.mu.Unlock()
+		writeProblem(w, &problem{Type: "orderNotReady", Detail: fmt.Sprintf("order is %s", o.status), Status: http.StatusForbidden})
+		return
+	}
+	err = checkCSRNames(csr, o.identifiers)
+	if err != nil {
+		s.mu.Unlock()
+		writeProblem(w, &problem{Type: "badCSR", Detail: err.Error()})
+		return
+	}
+	o.status = statusProcessing
+	s.mu.Unlock()
+
+	certOpts := []cert.CertOption{
+		cert.IsServer(),
+		cert.IsValidFor(s.options.CertLifetime),
+	}
+	if s.options.Recorder != nil {
+		certOpts = append(certOpts, cert.WithRecorder(s.options.Recorder), cert.WithRequester(s.url("/account/"+req.account.id)))
+	}
+
+	certPEM, err := cert.NewFromCSR(
+		bytes.NewReader(s.caPrivKeyPEM),
+		bytes.NewReader(s.caCertPEM),
+		csr,
+		certOpts...,
+	)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		o.status = statusInvalid
+		o.err = &problem{Type: "serverInternal", Detail: err.Error()}
+	} else {
+		o.status = statusValid
+		o.certID = newID()
+		s.certs[o.certID] = append(certPEM, s.caCertPEM...)
+	}
+
+	w.Header().Set("Location", s.url("/order/"+id))
+	writeJSON(w, http.StatusOK, s.orderJSON(o))
+}
+
+// domainAllowed checks the domain against the allowed domains, if any.
+func (s *Server) domainAllowed(domain string) bool {
+	if len(s.options.AllowedDomains) == 0 {
+		return true
+	}
+	for _, allowed := range s.options.AllowedDomains {
+		if strings.HasPrefix(allowed, "*.") {
+			if strings.HasSuffix(domain, allowed[1:]) {
+				return true
+			}
+		} else if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// validDNSName checks the name is a DNS name without a trailing dot,
+// made of letters, digits and hyphens. IP addresses and wildcards
+// aren't valid.
+func validDNSName(name string) bool {
+	if len(name) == 0 || len(name) > 253 || net.ParseIP(name) != nil {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checkCSRNames checks the CSR requests exactly the order's identifiers.
+func checkCSRNames(csr *x509.CertificateRequest, identifiers []identifier) error {
+	if len(csr.IPAddresses) > 0 || len(csr.EmailAddresses) > 0 || len(csr.URIs) > 0 {
+		return fmt.Errorf("CSR may only contain DNS names")
+	}
+
+	names := map[string]bool{}
+	for _, name := range csr.DNSNames {
+		names[strings.ToLower(name)] = true
+	}
+	if cn := csr.Subject.CommonName; cn != "" {
+		names[strings.ToLower(cn)] = true
+	}
+
+	var want, got []string
+	for _, id := range identifiers {
+		want = append(want, id.Value)
+	}
+	for name := range names {
+		got = append(got, name)
+	}
+	sort.Strings(want)
+	sort.Strings(got)
+	if strings.Join(want, ",") != strings.Join(got, ",") {
+		return fmt.Errorf("CSR names %v do not match order identifiers %v", got, want)
+	}
+	return nil
+}
+
+func (s *Server) handleCert(w http.ResponseWriter, req *request, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chain, ok := s.certs[id]
+	if ok {
+		ok = false
+		for _, o := range s.orders {
+			if o.certID == id && o.accountID == req.account.id {
+				ok = true
+				break
+			}
+		}
+	}
+	if !ok {
+		writeProblem(w, &problem{Type: "malformed", Detail: "certificate not found", Status: http.StatusNotFound})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	w.WriteHeader(http.StatusOK)
+	w.Write(chain)
+}
+
+// problem is an RFC 7807 problem document with an ACME error type.
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+func (p *problem) withDefaults() *problem {
+	v := *p
+	if !strings.HasPrefix(v.Type, "urn:") {
+		v.Type = "urn:ietf:params:acme:error:" + v.Type
+	}
+	if v.Status == 0 {
+		v.Status = http.StatusBadRequest
+	}
+	return &v
+}
+
+func writeProblem(w http.ResponseWriter, p *problem) {
+	p = p.withDefaults()
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
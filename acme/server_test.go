@@ -0,0 +1,324 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/stretchr/testify/require"
+	xacme "golang.org/x/crypto/acme"
+)
+
+// startACME starts an ACME server for a new CA, returning the CA cert and
+// a registered ACME client using the given key. Every validation
+// connection is redirected to the loopback interface, so any domain can
+// be used in tests.
+func startACME(t *testing.T, key *ecdsa.PrivateKey, opts ...Option) ([]byte, *xacme.Client) {
+	caPEM, caPrivKeyPEM, err := cert.NewCA(cert.WithCommonName("acme-ca"))
+	require.NoError(t, err)
+
+	var handler http.Handler
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	dialLoopback := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, net.JoinHostPort("127.0.0.1", port))
+	}
+
+	opts = append([]Option{WithDialContext(dialLoopback), WithValidateTimeout(5 * time.Second)}, opts...)
+	s, err := NewServer(ts.URL+"/acme", bytes.NewReader(caPrivKeyPEM), bytes.NewReader(caPEM), opts...)
+	require.NoError(t, err)
+	handler = s
+
+	client := &xacme.Client{
+		Key:          key,
+		DirectoryURL: s.DirectoryURL(),
+		HTTPClient:   ts.Client(),
+	}
+	_, err = client.Register(context.Background(), &xacme.Account{}, xacme.AcceptTOS)
+	require.NoError(t, err)
+
+	return caPEM, client
+}
+
+func listenerPort(t *testing.T, l net.Listener) int {
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return p
+}
+
+// serveHTTP01 serves http-01 responses for the client, returning the
+// port they are served on.
+func serveHTTP01(t *testing.T, client *xacme.Client, tokens map[string]bool) int {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for token := range tokens {
+			if r.URL.Path == client.HTTP01ChallengePath(token) {
+				resp, err := client.HTTP01ChallengeResponse(token)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				w.Write([]byte(resp))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	return listenerPort(t, ts.Listener)
+}
+
+// serveTLSALPN01 serves tls-alpn-01 challenge certs, returning the port
+// they are served on.
+func serveTLSALPN01(t *testing.T, certs map[string]*tls.Certificate) int {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		NextProtos: []string{"acme-tls/1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return certs[hello.ServerName], nil
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return listenerPort(t, l)
+}
+
+func newCSR(t *testing.T, domain string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{domain}}, key)
+	require.NoError(t, err)
+	return csr
+}
+
+func TestServer(t *testing.T) {
+	for _, typ := range []string{"http-01", "tls-alpn-01"} {
+		t.Run(typ, func(t *testing.T) {
+			const domain = "app.internal"
+			ctx := context.Background()
+
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			require.NoError(t, err)
+
+			tokens := map[string]bool{}
+			certs := map[string]*tls.Certificate{}
+			httpPort := serveHTTP01(t, &xacme.Client{Key: key}, tokens)
+			tlsPort := serveTLSALPN01(t, certs)
+
+			caPEM, client := startACME(t, key, WithHTTP01Port(httpPort), WithTLSALPN01Port(tlsPort))
+
+			order, err := client.AuthorizeOrder(ctx, xacme.DomainIDs(domain))
+			require.NoError(t, err)
+			require.Equal(t, xacme.StatusPending, order.Status)
+			require.Len(t, order.AuthzURLs, 1)
+
+			authz, err := client.GetAuthorization(ctx, order.AuthzURLs[0])
+			require.NoError(t, err)
+
+			var chal *xacme.Challenge
+			for _, c := range authz.Challenges {
+				if c.Type == typ {
+					chal = c
+				}
+			}
+			require.NotNil(t, chal)
+
+			switch typ {
+			case "http-01":
+				tokens[chal.Token] = true
+			case "tls-alpn-01":
+				challengeCert, err := client.TLSALPN01ChallengeCert(chal.Token, domain)
+				require.NoError(t, err)
+				certs[domain] = &challengeCert
+			}
+
+			_, err = client.Accept(ctx, chal)
+			require.NoError(t, err)
+
+			_, err = client.WaitAuthorization(ctx, authz.URI)
+			require.NoError(t, err)
+
+			order, err = client.WaitOrder(ctx, order.URI)
+			require.NoError(t, err)
+			require.Equal(t, xacme.StatusReady, order.Status)
+
+			der, certURL, err := client.CreateOrderCert(ctx, order.FinalizeURL, newCSR(t, domain), true)
+			require.NoError(t, err)
+			require.NotEmpty(t, certURL)
+			require.Len(t, der, 2)
+
+			leaf, err := x509.ParseCertificate(der[0])
+			require.NoError(t, err)
+			require.Equal(t, []string{domain}, leaf.DNSNames)
+
+			roots := x509.NewCertPool()
+			roots.AppendCertsFromPEM(caPEM)
+			_, err = leaf.Verify(x509.VerifyOptions{
+				DNSName:   domain,
+				Roots:     roots,
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestServerRejects(t *testing.T) {
+	ctx := context.Background()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tokens := map[string]bool{}
+	httpPort := serveHTTP01(t, &xacme.Client{Key: key}, tokens)
+	_, client := startACME(t, key, WithHTTP01Port(httpPort))
+
+	challenge := func(domain string) (*xacme.Order, *xacme.Challenge) {
+		order, err := client.AuthorizeOrder(ctx, xacme.DomainIDs(domain))
+		require.NoError(t, err)
+		authz, err := client.GetAuthorization(ctx, order.AuthzURLs[0])
+		require.NoError(t, err)
+		for _, c := range authz.Challenges {
+			if c.Type == "http-01" {
+				return order, c
+			}
+		}
+		t.Fatal("no http-01 challenge offered")
+		return nil, nil
+	}
+
+	t.Run("unanswered challenge", func(t *testing.T) {
+		order, chal := challenge("missing.internal")
+
+		_, err := client.Accept(ctx, chal)
+		require.NoError(t, err)
+
+		_, err = client.WaitOrder(ctx, order.URI)
+		require.Error(t, err)
+
+		_, _, err = client.CreateOrderCert(ctx, order.FinalizeURL, newCSR(t, "missing.internal"), true)
+		require.Error(t, err)
+	})
+
+	t.Run("mismatched CSR", func(t *testing.T) {
+		order, chal := challenge("app.internal")
+		tokens[chal.Token] = true
+
+		_, err := client.Accept(ctx, chal)
+		require.NoError(t, err)
+		order, err = client.WaitOrder(ctx, order.URI)
+		require.NoError(t, err)
+
+		_, _, err = client.CreateOrderCert(ctx, order.FinalizeURL, newCSR(t, "other.internal"), true)
+		require.Error(t, err)
+		acmeErr, ok := err.(*xacme.Error)
+		require.True(t, ok)
+		require.Equal(t, "urn:ietf:params:acme:error:badCSR", acmeErr.ProblemType)
+	})
+
+	t.Run("unsupported identifier", func(t *testing.T) {
+		_, err := client.AuthorizeOrder(ctx, xacme.IPIDs("127.0.0.1"))
+		require.Error(t, err)
+	})
+
+	t.Run("invalid identifier", func(t *testing.T) {
+		for _, domain := range []string{"*.app.internal", "app_1.internal", "-app.internal", "app..internal", "127.0.0.1", "app.internal."} {
+			_, err := client.AuthorizeOrder(ctx, xacme.DomainIDs(domain))
+			require.Error(t, err, domain)
+			acmeErr, ok := err.(*xacme.Error)
+			require.True(t, ok)
+			require.Equal(t, "urn:ietf:params:acme:error:rejectedIdentifier", acmeErr.ProblemType)
+		}
+	})
+}
+
+func TestServerAllowedDomains(t *testing.T) {
+	ctx := context.Background()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	_, client := startACME(t, key, WithAllowedDomains("app.internal", "*.svc.internal"))
+
+	for _, domain := range []string{"app.internal", "db.svc.internal", "a.b.svc.internal"} {
+		_, err := client.AuthorizeOrder(ctx, xacme.DomainIDs(domain))
+		require.NoError(t, err, domain)
+	}
+	for _, domain := range []string{"other.internal", "svc.internal", "x.app.internal", "evilsvc.internal"} {
+		_, err := client.AuthorizeOrder(ctx, xacme.DomainIDs(domain))
+		require.Error(t, err, domain)
+	}
+
+	_, err = NewServer("https://ca.internal/acme", nil, nil, WithAllowedDomains("bad_domain"))
+	require.Error(t, err)
+}
+
+func TestServerOrderExpiry(t *testing.T) {
+	ctx := context.Background()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tokens := map[string]bool{}
+	httpPort := serveHTTP01(t, &xacme.Client{Key: key}, tokens)
+	_, client := startACME(t, key, WithHTTP01Port(httpPort), WithOrderLifetime(200*time.Millisecond))
+
+	order, err := client.AuthorizeOrder(ctx, xacme.DomainIDs("app.internal"))
+	require.NoError(t, err)
+	authz, err := client.GetAuthorization(ctx, order.AuthzURLs[0])
+	require.NoError(t, err)
+
+	time.Sleep(300 * time.Millisecond)
+
+	authz, err = client.GetAuthorization(ctx, order.AuthzURLs[0])
+	require.NoError(t, err)
+	require.Equal(t, "expired", authz.Status)
+
+	// an expired authorization is no longer validated
+	for _, c := range authz.Challenges {
+		tokens[c.Token] = true
+		chal, err := client.Accept(ctx, c)
+		require.NoError(t, err)
+		require.Equal(t, "pending", chal.Status)
+	}
+
+	order, err = client.GetOrder(ctx, order.URI)
+	require.NoError(t, err)
+	require.Equal(t, "invalid", order.Status)
+
+	// expired orders are forgotten when the next order is created
+	_, err = client.AuthorizeOrder(ctx, xacme.DomainIDs("app.internal"))
+	require.NoError(t, err)
+	_, err = client.GetOrder(ctx, order.URI)
+	require.Error(t, err)
+}
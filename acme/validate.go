@@ -0,0 +1,132 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// acmeIdentifierOID is the id-pe-acmeIdentifier extension used by
+// tls-alpn-01 challenge certs (RFC 8737).
+var acmeIdentifierOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// validate checks a challenge of the given type against the domain.
+func (s *Server) validate(typ, domain, token, keyAuth string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.options.ValidateTimeout)
+	defer cancel()
+
+	switch typ {
+	case "http-01":
+		return s.validateHTTP01(ctx, domain, token, keyAuth)
+	case "tls-alpn-01":
+		return s.validateTLSALPN01(ctx, domain, keyAuth)
+	default:
+		return fmt.Errorf("unsupported challenge type %q", typ)
+	}
+}
+
+func (s *Server) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if s.options.DialContext != nil {
+		return s.options.DialContext(ctx, network, addr)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
+}
+
+func (s *Server) validateHTTP01(ctx context.Context, domain, token, keyAuth string) error {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext:       s.dialContext,
+			DisableKeepAlives: true,
+		},
+	}
+
+	host := net.JoinHostPort(domain, strconv.Itoa(s.options.HTTP01Port))
+	req, err := http.NewRequest(http.MethodGet, "http://"+host+"/.well-known/acme-challenge/"+token, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http-01 challenge for %q returned status %d", domain, resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return err
+	}
+	if string(bytes.TrimSpace(body)) != keyAuth {
+		return fmt.Errorf("http-01 challenge for %q returned the wrong key authorization", domain)
+	}
+	return nil
+}
+
+func (s *Server) validateTLSALPN01(ctx context.Context, domain, keyAuth string) error {
+	conn, err := s.dialContext(ctx, "tcp", net.JoinHostPort(domain, strconv.Itoa(s.options.TLSALPN01Port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName: domain,
+		NextProtos: []string{"acme-tls/1"},
+		// the challenge cert is self-signed, its contents are checked below
+		InsecureSkipVerify: true,
+	})
+	err = tlsConn.Handshake()
+	if err != nil {
+		return err
+	}
+
+	state := tlsConn.ConnectionState()
+	if state.NegotiatedProtocol != "acme-tls/1" {
+		return fmt.Errorf("tls-alpn-01 challenge for %q did not negotiate acme-tls/1", domain)
+	}
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("tls-alpn-01 challenge for %q presented no certificate", domain)
+	}
+
+	leaf := state.PeerCertificates[0]
+	if len(leaf.DNSNames) != 1 || leaf.DNSNames[0] != domain {
+		return fmt.Errorf("tls-alpn-01 challenge cert for %q has DNS names %v", domain, leaf.DNSNames)
+	}
+
+	sum := sha256.Sum256([]byte(keyAuth))
+	for _, ext := range leaf.Extensions {
+		if !ext.Id.Equal(acmeIdentifierOID) {
+			continue
+		}
+		if !ext.Critical {
+			return fmt.Errorf("tls-alpn-01 challenge cert for %q has a non-critical acmeIdentifier", domain)
+		}
+		var value []byte
+		rest, err := asn1.Unmarshal(ext.Value, &value)
+		if err != nil || len(rest) > 0 {
+			return fmt.Errorf("tls-alpn-01 challenge cert for %q has a malformed acmeIdentifier", domain)
+		}
+		if !bytes.Equal(value, sum[:]) {
+			return fmt.Errorf("tls-alpn-01 challenge for %q returned the wrong key authorization", domain)
+		}
+		return nil
+	}
+	return fmt.Errorf("tls-alpn-01 challenge cert for %q has no acmeIdentifier", domain)
+}
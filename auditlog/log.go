@@ -0,0 +1,263 @@
+// Package auditlog implements an append-only, hash-chained log of CA
+// operations. Every entry includes the hash of the previous one and is
+// signed by the CA key, so gaps and edits are detected by Verify.
+package auditlog
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Op is a CA operation recorded in the log.
+type Op string
+
+const (
+	OpCACreate  Op = "ca_create"
+	OpIssue     Op = "issue"
+	OpSSHIssue  Op = "ssh_issue"
+	OpRevoke    Op = "revoke"
+	OpKeyExport Op = "key_export"
+)
+
+// Entry is a single log entry.
+type Entry struct {
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Op        Op        `json:"op"`
+	Serial    string    `json:"serial,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	Requester string    `json:"requester,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+	Signature string    `json:"signature"`
+}
+
+// computeHash returns the hex encoded SHA-256 hash of every field of the
+// entry except its hash and signature.
+func (e *Entry) computeHash() (string, error) {
+	body := *e
+	body.Hash = ""
+	body.Signature = ""
+	b, err := json.Marshal(&body)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log is an audit log file, which entries are appended to.
+type Log struct {
+	mu       sync.Mutex
+	file     *os.File
+	signer   crypto.Signer
+	seq      uint64
+	prevHash string
+}
+
+// Open opens the log at the given path, creating it if needed. Entries
+// are signed using the given CA key. The existing entries are verified
+// first, so nothing is appended to a log that was tampered with.
+func Open(path string, caKey crypto.Signer) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := Verify(file, caKey.Public())
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &Log{
+		file:     file,
+		signer:   caKey,
+		seq:      head.Seq,
+		prevHash: head.Hash,
+	}, nil
+}
+
+// Close closes the underlying file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Append chains, signs and writes the entry, setting its sequence
+// number, time, previous hash, hash and signature.
+func (l *Log) Append(e *Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.Seq = l.seq + 1
+	e.Time = time.Now().UTC()
+	e.PrevHash = l.prevHash
+
+	hash, err := e.computeHash()
+	if err != nil {
+		return err
+	}
+	e.Hash = hash
+
+	digest, _ := hex.DecodeString(hash)
+	sig, err := l.signer.Sign(rand.Reader, digest, crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("failed to sign audit log entry: %w", err)
+	}
+	e.Signature = base64.StdEncoding.EncodeToString(sig)
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = l.file.Write(append(b, '\n'))
+	if err != nil {
+		return err
+	}
+	err = l.file.Sync()
+	if err != nil {
+		return err
+	}
+
+	l.seq = e.Seq
+	l.prevHash = e.Hash
+	return nil
+}
+
+// RecordCA records the creation of the CA.
+func (l *Log) RecordCA(ca *x509.Certificate) error {
+	return l.Append(&Entry{
+		Op:      OpCACreate,
+		Serial:  fmt.Sprintf("%x", ca.SerialNumber),
+		Subject: ca.Subject.String(),
+	})
+}
+
+// RecordCertificate records the issuance of a cert, which implements the
+// cert.Recorder interface.
+func (l *Log) RecordCertificate(c *x509.Certificate, requester string) error {
+	return l.Append(&Entry{
+		Op:        OpIssue,
+		Serial:    fmt.Sprintf("%x", c.SerialNumber),
+		Subject:   c.Subject.String(),
+		Requester: requester,
+	})
+}
+
+// RecordSSHCertificate records the signing of an OpenSSH cert.
+func (l *Log) RecordSSHCertificate(c *ssh.Certificate, requester string) error {
+	typ := "user"
+	if c.CertType == ssh.HostCert {
+		typ = "host"
+	}
+	return l.Append(&Entry{
+		Op:        OpSSHIssue,
+		Serial:    fmt.Sprintf("%x", c.Serial),
+		Subject:   fmt.Sprintf("%s cert %q for %s", typ, c.KeyId, strings.Join(c.ValidPrincipals, ",")),
+		Requester: requester,
+	})
+}
+
+// RecordRevocation records the revocation of a cert.
+func (l *Log) RecordRevocation(serial, reason string) error {
+	return l.Append(&Entry{
+		Op:     OpRevoke,
+		Serial: serial,
+		Reason: reason,
+	})
+}
+
+// RecordKeyExport records that a private key left the CA, such as the
+// CA key being copied, or a key generated for a requester.
+func (l *Log) RecordKeyExport(serial, requester, reason string) error {
+	return l.Append(&Entry{
+		Op:        OpKeyExport,
+		Serial:    serial,
+		Requester: requester,
+		Reason:    reason,
+	})
+}
+
+// Head is the last entry of a verified log.
+type Head struct {
+	Seq  uint64
+	Hash string
+}
+
+// VerifyError describes the first invalid entry found by Verify.
+type VerifyError struct {
+	Line   int
+	Seq    uint64
+	Reason string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("audit log line %d (seq %d): %s", e.Line, e.Seq, e.Reason)
+}
+
+// Verify reads every entry of a log, checking sequence numbers have no
+// gaps, every entry is chained to the previous one, and every hash and
+// signature is valid for the given CA public key. It returns the head of
+// the log, which can be compared against a previously recorded head to
+// detect truncation.
+func Verify(r io.Reader, caPub crypto.PublicKey) (Head, error) {
+	var head Head
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var e Entry
+		err := json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			return head, &VerifyError{Line: line, Seq: head.Seq + 1, Reason: err.Error()}
+		}
+
+		fail := func(format string, args ...interface{}) (Head, error) {
+			return head, &VerifyError{Line: line, Seq: e.Seq, Reason: fmt.Sprintf(format, args...)}
+		}
+
+		if e.Seq != head.Seq+1 {
+			return fail("expected seq %d, entries are missing or reordered", head.Seq+1)
+		}
+		if e.PrevHash != head.Hash {
+			return fail("previous hash %q does not match %q", e.PrevHash, head.Hash)
+		}
+		hash, err := e.computeHash()
+		if err != nil {
+			return fail("%s", err)
+		}
+		if e.Hash != hash {
+			return fail("hash does not match the entry, it was modified")
+		}
+		sig, err := base64.StdEncoding.DecodeString(e.Signature)
+		if err != nil {
+			return fail("malformed signature: %s", err)
+		}
+		digest, _ := hex.DecodeString(hash)
+		err = verifySignature(caPub, digest, sig)
+		if err != nil {
+			return fail("invalid signature: %s", err)
+		}
+
+		head = Head{Seq: e.Seq, Hash: e.Hash}
+	}
+
+	return head, scanner.Err()
+}
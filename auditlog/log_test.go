@@ -0,0 +1,148 @@
+package auditlog
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/picatz/mtls/store"
+	"github.com/stretchr/testify/require"
+)
+
+func newCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	caPEM, caPrivKeyPEM, err := cert.NewCA(cert.WithCommonName("ca"))
+	require.NoError(t, err)
+	caCert, caKey, err := cert.ReadCertAndKey(bytes.NewReader(caPEM), bytes.NewReader(caPrivKeyPEM))
+	require.NoError(t, err)
+	return caCert, caKey.(*ecdsa.PrivateKey), caPEM, caPrivKeyPEM
+}
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	caCert, caKey, caPEM, caPrivKeyPEM := newCA(t)
+
+	l, err := Open(path, caKey)
+	require.NoError(t, err)
+	require.NoError(t, l.RecordCA(caCert))
+
+	db, err := store.Open(filepath.Join(t.TempDir(), "issued.jsonl"))
+	require.NoError(t, err)
+	defer db.Close()
+	audited := Store(db, l)
+
+	certPEM, _, err := cert.NewServerFromCA(
+		bytes.NewReader(caPrivKeyPEM),
+		bytes.NewReader(caPEM),
+		cert.WithCommonName("server"),
+		cert.WithRecorder(store.Recorder(audited)),
+		cert.WithRequester("deploy"),
+	)
+	require.NoError(t, err)
+	block, _ := pem.Decode(certPEM)
+	issued, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+
+	require.NoError(t, audited.Revoke(store.FormatSerial(issued), "retired"))
+	require.NoError(t, l.RecordKeyExport(store.FormatSerial(issued), "deploy", "backup"))
+	require.NoError(t, l.Close())
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 4)
+	require.Contains(t, lines[1], `"op":"issue"`)
+	require.Contains(t, lines[1], `"requester":"deploy"`)
+	require.Contains(t, lines[2], `"op":"revoke"`)
+
+	head, err := Verify(bytes.NewReader(data), caCert.PublicKey)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), head.Seq)
+
+	// reopening continues the chain
+	l, err = Open(path, caKey)
+	require.NoError(t, err)
+	require.NoError(t, l.RecordRevocation("00", "test"))
+	require.NoError(t, l.Close())
+
+	data, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	head, err = Verify(bytes.NewReader(data), caCert.PublicKey)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), head.Seq)
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	caCert, caKey, _, _ := newCA(t)
+
+	l, err := Open(path, caKey)
+	require.NoError(t, err)
+	require.NoError(t, l.RecordCA(caCert))
+	for _, requester := range []string{"alice", "bob", "carol"} {
+		require.NoError(t, l.Append(&Entry{Op: OpIssue, Serial: "01", Requester: requester}))
+	}
+	require.NoError(t, l.Close())
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(string(data), "\n")
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		log  string
+		key  interface{}
+		seq  uint64
+		line int
+	}{
+		"edited entry": {
+			log:  strings.Replace(string(data), `"requester":"bob"`, `"requester":"mallory"`, 1),
+			key:  caCert.PublicKey,
+			seq:  3,
+			line: 3,
+		},
+		"removed entry": {
+			log:  lines[0] + lines[1] + lines[3],
+			key:  caCert.PublicKey,
+			seq:  4,
+			line: 3,
+		},
+		"reordered entries": {
+			log:  lines[0] + lines[2] + lines[1] + lines[3],
+			key:  caCert.PublicKey,
+			seq:  3,
+			line: 2,
+		},
+		"wrong CA": {
+			log:  string(data),
+			key:  &otherKey.PublicKey,
+			seq:  1,
+			line: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Verify(strings.NewReader(test.log), test.key)
+			var verifyErr *VerifyError
+			require.True(t, errors.As(err, &verifyErr), "expected a VerifyError, got %v", err)
+			require.Equal(t, test.seq, verifyErr.Seq)
+			require.Equal(t, test.line, verifyErr.Line)
+		})
+	}
+
+	// a tampered log can't be appended to
+	require.NoError(t, ioutil.WriteFile(path, []byte(tests["edited entry"].log), 0600))
+	_, err = Open(path, caKey)
+	require.Error(t, err)
+}
@@ -0,0 +1,35 @@
+package auditlog
+
+import "github.com/picatz/mtls/store"
+
+type auditedStore struct {
+	store.Store
+	log *Log
+}
+
+// Store wraps a store.Store, recording every issuance and revocation in
+// the log once the store accepts it.
+func Store(s store.Store, l *Log) store.Store {
+	return &auditedStore{Store: s, log: l}
+}
+
+func (s *auditedStore) Put(r *store.Record) error {
+	err := s.Store.Put(r)
+	if err != nil {
+		return err
+	}
+	return s.log.Append(&Entry{
+		Op:        OpIssue,
+		Serial:    r.Serial,
+		Subject:   r.Subject,
+		Requester: r.Requester,
+	})
+}
+
+func (s *auditedStore) Revoke(serial, reason string) error {
+	err := s.Store.Revoke(serial, reason)
+	if err != nil {
+		return err
+	}
+	return s.log.RecordRevocation(serial, reason)
+}
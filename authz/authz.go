@@ -0,0 +1,57 @@
+// Package authz decides what each mTLS peer identity is allowed to do,
+// using rules loaded from a file.
+package authz
+
+import (
+	"fmt"
+
+	"github.com/picatz/mtls/identity"
+)
+
+// Action is something an identity asks to do to a resource.
+type Action string
+
+const (
+	// ActionConnect is connecting to a "host:port" destination.
+	ActionConnect Action = "connect"
+	// ActionListen is listening on a "host:port" address.
+	ActionListen Action = "listen"
+	// ActionCall is calling a gRPC method, named
+	// "/package.Service/Method".
+	ActionCall Action = "call"
+)
+
+// Authorizer decides if an identity may do an action to a resource.
+type Authorizer interface {
+	Authorize(id *identity.Identity, action Action, resource string) error
+}
+
+// AuthorizerFunc implements an Authorizer using a function.
+type AuthorizerFunc func(id *identity.Identity, action Action, resource string) error
+
+// Authorize calls the function.
+func (f AuthorizerFunc) Authorize(id *identity.Identity, action Action, resource string) error {
+	return f(id, action, resource)
+}
+
+// AllowAll allows every identity to do anything.
+var AllowAll Authorizer = AuthorizerFunc(func(*identity.Identity, Action, string) error {
+	return nil
+})
+
+// DenyAll denies everything.
+var DenyAll Authorizer = AuthorizerFunc(func(id *identity.Identity, action Action, resource string) error {
+	return &DeniedError{Identity: id.Name(), Action: action, Resource: resource}
+})
+
+// DeniedError is returned when an identity isn't allowed to do an
+// action to a resource.
+type DeniedError struct {
+	Identity string
+	Action   Action
+	Resource string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("identity %q is not allowed to %s %q", e.Identity, e.Action, e.Resource)
+}
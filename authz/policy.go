@@ -0,0 +1,237 @@
+package authz
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/picatz/mtls/identity"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy is an Authorizer allowing what any of its rules allow, and
+// denying everything else.
+type Policy struct {
+	Rules []Rule `yaml:"rules" json:"rules"`
+}
+
+// Rule allows the matching identities to do each listed action.
+type Rule struct {
+	// Identities are glob patterns matched against an identity's name.
+	// Patterns with a scheme, such as "spiffe://example.org/*", only
+	// match the identity's URI SAN, and other patterns only match its
+	// common name, so a common name can't pose as a URI. Unlike
+	// path.Match, "*" and "?" also match "/", so that pattern matches
+	// every SPIFFE ID under example.org. "*" matches any identity.
+	Identities []string `yaml:"identities" json:"identities"`
+	// Connect are the "host:port" destinations the identities may connect
+	// to. Hosts may be glob patterns or CIDRs, and ports may be "*" or
+	// ranges such as "8000-8999".
+	Connect []string `yaml:"connect" json:"connect"`
+	// Listen are the "host:port" addresses the identities may listen on,
+	// in the same format as Connect.
+	Listen []string `yaml:"listen" json:"listen"`
+	// Call are glob patterns of the gRPC methods the identities may call,
+	// such as "/example.Service/*". "/*/*" matches any method.
+	Call []string `yaml:"call" json:"call"`
+}
+
+// Authorize implements the Authorizer interface.
+func (p *Policy) Authorize(id *identity.Identity, action Action, resource string) error {
+	for _, rule := range p.Rules {
+		if rule.matchesIdentity(id) && rule.allows(action, resource) {
+			return nil
+		}
+	}
+	return &DeniedError{Identity: id.Name(), Action: action, Resource: resource}
+}
+
+func (r *Rule) matchesIdentity(id *identity.Identity) bool {
+	return MatchIdentity(r.Identities, id)
+}
+
+// MatchIdentity reports whether any of the glob patterns matches the
+// identity, the way policy rules match identities.
+func MatchIdentity(patterns []string, id *identity.Identity) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			return true
+		}
+		name := id.CommonName
+		if strings.Contains(pattern, "://") {
+			// URI patterns only match the identity's URI SAN
+			name = ""
+			if len(id.URIs) > 0 {
+				name = id.Name()
+			}
+		}
+		if matchIdentityGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) allows(action Action, resource string) bool {
+	switch action {
+	case ActionConnect:
+		return MatchAddr(r.Connect, resource)
+	case ActionListen:
+		return MatchAddr(r.Listen, resource)
+	case ActionCall:
+		for _, pattern := range r.Call {
+			if matchGlob(pattern, resource) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func matchGlob(pattern, name string) bool {
+	if name == "" {
+		return false
+	}
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
+
+// matchIdentityGlob is like matchGlob, but "*" and "?" also match "/",
+// by replacing it with a byte identity names can't contain.
+func matchIdentityGlob(pattern, name string) bool {
+	return matchGlob(strings.ReplaceAll(pattern, "/", "\x00"), strings.ReplaceAll(name, "/", "\x00"))
+}
+
+// MatchAddr reports whether any of the "host:port" patterns matches the
+// address, the way policy rules match addresses.
+func MatchAddr(patterns []string, addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range patterns {
+		patternHost, patternPort, err := net.SplitHostPort(pattern)
+		if err != nil {
+			continue
+		}
+		if matchHost(patternHost, host) && matchPort(patternPort, port) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchHost(pattern, host string) bool {
+	if _, network, err := net.ParseCIDR(pattern); err == nil {
+		ip := net.ParseIP(host)
+		return ip != nil && network.Contains(ip)
+	}
+	if ip := net.ParseIP(pattern); ip != nil {
+		return ip.Equal(net.ParseIP(host))
+	}
+	return matchGlob(strings.ToLower(pattern), strings.ToLower(host))
+}
+
+func matchPort(pattern, port string) bool {
+	if pattern == "*" {
+		return true
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return false
+	}
+	low, high, err := parsePortRange(pattern)
+	return err == nil && low <= n && n <= high
+}
+
+func parsePortRange(pattern string) (int, int, error) {
+	parts := strings.SplitN(pattern, "-", 2)
+	low, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port %q", pattern)
+	}
+	high := low
+	if len(parts) == 2 {
+		high, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid port range %q", pattern)
+		}
+	}
+	if low < 0 || high > 65535 || low > high {
+		return 0, 0, fmt.Errorf("invalid port range %q", pattern)
+	}
+	return low, high, nil
+}
+
+// ValidateAddrPattern checks a "host:port" pattern can be parsed.
+func ValidateAddrPattern(pattern string) error {
+	_, port, err := net.SplitHostPort(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid address pattern %q: %w", pattern, err)
+	}
+	if port != "*" {
+		_, _, err = parsePortRange(port)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks every pattern in the policy can be parsed.
+func (p *Policy) validate() error {
+	for i, rule := range p.Rules {
+		if len(rule.Identities) == 0 {
+			return fmt.Errorf("rule %d has no identities", i+1)
+		}
+		for _, pattern := range rule.Identities {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %d: invalid identity pattern %q", i+1, pattern)
+			}
+		}
+		for _, pattern := range rule.Call {
+			if _, err := path.Match(pattern, ""); err != nil || !strings.HasPrefix(pattern, "/") {
+				return fmt.Errorf("rule %d: invalid method pattern %q", i+1, pattern)
+			}
+		}
+		for _, pattern := range append(append([]string{}, rule.Connect...), rule.Listen...) {
+			err := ValidateAddrPattern(pattern)
+			if err != nil {
+				return fmt.Errorf("rule %d: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ParsePolicy parses a YAML (or JSON) encoded Policy.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	err := yaml.Unmarshal(data, &p)
+	if err != nil {
+		return nil, err
+	}
+	err = p.validate()
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// LoadPolicy reads a Policy from a YAML (or JSON) file.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := ParsePolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", path, err)
+	}
+	return p, nil
+}
@@ -0,0 +1,109 @@
+package authz
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/picatz/mtls/identity"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `
+rules:
+  - identities: ["spiffe://example.org/app/*"]
+    connect: ["db.internal:5432", "10.0.0.0/8:8000-8999", "*.cache.internal:*"]
+  - identities: [alice]
+    connect: ["[fd00::/8]:22"]
+    listen: ["127.0.0.1:8080"]
+    call: ["/example.Echo/*", "/grpc.health.v1.Health/Check"]
+`
+
+func TestPolicy(t *testing.T) {
+	p, err := ParsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+
+	app := &identity.Identity{CommonName: "app", URIs: []string{"spiffe://example.org/app/web"}}
+	alice := &identity.Identity{CommonName: "alice"}
+
+	for _, test := range []struct {
+		id       *identity.Identity
+		action   Action
+		resource string
+		allowed  bool
+	}{
+		{app, ActionConnect, "db.internal:5432", true},
+		{app, ActionConnect, "DB.internal:5432", true},
+		{app, ActionConnect, "db.internal:5433", false},
+		{app, ActionConnect, "10.1.2.3:8080", true},
+		{app, ActionConnect, "10.1.2.3:9000", false},
+		{app, ActionConnect, "11.1.2.3:8080", false},
+		{app, ActionConnect, "redis.cache.internal:6379", true},
+		{app, ActionListen, "127.0.0.1:8080", false},
+		{alice, ActionConnect, "[fd00::1]:22", true},
+		{alice, ActionConnect, "db.internal:5432", false},
+		{alice, ActionListen, "127.0.0.1:8080", true},
+		{alice, ActionListen, "0.0.0.0:8080", false},
+		{alice, ActionConnect, "not an address", false},
+		{alice, Action("delete"), "127.0.0.1:8080", false},
+		{alice, ActionCall, "/example.Echo/Say", true},
+		{alice, ActionCall, "/grpc.health.v1.Health/Check", true},
+		{alice, ActionCall, "/grpc.health.v1.Health/Watch", false},
+		{app, ActionCall, "/example.Echo/Say", false},
+	} {
+		err := p.Authorize(test.id, test.action, test.resource)
+		if test.allowed {
+			require.NoError(t, err, "%s %s %s", test.id, test.action, test.resource)
+			continue
+		}
+		var deniedErr *DeniedError
+		require.True(t, errors.As(err, &deniedErr), "%s %s %s", test.id, test.action, test.resource)
+		require.Equal(t, test.id.Name(), deniedErr.Identity)
+	}
+
+	require.NoError(t, AllowAll.Authorize(alice, ActionListen, "0.0.0.0:22"))
+	require.Error(t, DenyAll.Authorize(alice, ActionConnect, "db.internal:5432"))
+}
+
+func TestMatchIdentity(t *testing.T) {
+	// identities with only a URI SAN have no common name
+	workload := &identity.Identity{URIs: []string{"spiffe://example.org/ns/prod/sa/web"}}
+	alice := &identity.Identity{CommonName: "alice"}
+	impostor := &identity.Identity{CommonName: "spiffe://example.org/admin", URIs: []string{"spiffe://other.org/x"}}
+
+	for _, test := range []struct {
+		pattern string
+		id      *identity.Identity
+		matches bool
+	}{
+		{"*", workload, true},
+		{"*", alice, true},
+		{"spiffe://example.org/*", workload, true},
+		{"spiffe://example.org/ns/*/sa/web", workload, true},
+		{"spiffe://example.org/ns/dev/*", workload, false},
+		{"spiffe://other.org/*", workload, false},
+		{"spiffe://example.org/*", alice, false},
+		{"al?ce", alice, true},
+		// a common name can't pose as a URI SAN
+		{"spiffe://example.org/*", impostor, false},
+		{"spiffe://example.org/admin", impostor, false},
+		{"spiffe://other.org/*", impostor, true},
+		{"web", workload, false},
+	} {
+		require.Equal(t, test.matches, MatchIdentity([]string{test.pattern}, test.id), "%s %s", test.pattern, test.id)
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	for _, data := range []string{
+		"rules:\n  - connect: ['db:5432']\n",
+		"rules:\n  - identities: ['[']\n",
+		"rules:\n  - identities: [a]\n    connect: [db]\n",
+		"rules:\n  - identities: [a]\n    listen: ['db:99999']\n",
+		"rules:\n  - identities: [a]\n    connect: ['db:20-10']\n",
+		"rules:\n  - identities: [a]\n    call: ['example.Echo/*']\n",
+		"rules: [",
+	} {
+		_, err := ParsePolicy([]byte(data))
+		require.Error(t, err, data)
+	}
+}
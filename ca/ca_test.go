@@ -0,0 +1,231 @@
+package ca
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/picatz/mtls/client"
+	"github.com/picatz/mtls/internal/testpki"
+	"github.com/picatz/mtls/renew"
+	"github.com/picatz/mtls/server"
+	"github.com/picatz/mtls/tlsconf"
+	"github.com/stretchr/testify/require"
+)
+
+// startCA starts a CA server, returning a function to create clients
+// for it from a client key pair.
+func startCA(t *testing.T, pki *testpki.PKI, opts ...Option) (*server.Server, func(tls.Certificate) *client.Client) {
+	serverTLSConfig, err := tlsconf.Build(
+		tlsconf.WithCertificates([]tls.Certificate{pki.Server(cert.WithCommonName("ca.server"))}),
+		tlsconf.WithCACertificates(bytes.NewReader(pki.CAPEM)),
+		tlsconf.WithMutualAuthentication(),
+		tlsconf.WithProfile(tlsconf.IntermediateProfile),
+	)
+	require.NoError(t, err)
+
+	issuer, err := NewIssuer(bytes.NewReader(pki.CAPrivKeyPEM), bytes.NewReader(pki.CAPEM), opts...)
+	require.NoError(t, err)
+
+	s, err := NewServer(issuer,
+		server.WithAddr("127.0.0.1:0"),
+		server.WithTLSConfig(serverTLSConfig),
+	)
+	require.NoError(t, err)
+	s.Start()
+
+	newClient := func(keyPair tls.Certificate) *client.Client {
+		c, err := client.New(
+			client.WithAddr(s.Listener().Addr().String()),
+			client.WithTLSConfig(&tls.Config{
+				RootCAs:      pki.Pool,
+				Certificates: []tls.Certificate{keyPair},
+			}),
+		)
+		require.NoError(t, err)
+		return c
+	}
+
+	return s, newClient
+}
+
+func parseChain(t *testing.T, chain []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, chain = pem.Decode(chain)
+		if block == nil {
+			break
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		require.NoError(t, err)
+		certs = append(certs, c)
+	}
+	return certs
+}
+
+func TestIssueOverMTLS(t *testing.T) {
+	pki := testpki.New(t)
+
+	s, newClient := startCA(t, pki, WithMaxLifetime(time.Hour))
+	defer s.Shutdown()
+
+	// alice's cert is used as both a client and a server, so she may be
+	// issued server certs
+	caCert, caKey, err := cert.ReadCertAndKey(bytes.NewReader(pki.CAPEM), bytes.NewReader(pki.CAPrivKeyPEM))
+	require.NoError(t, err)
+	aliceKeyPair := pki.KeyPair(mustNew(t,
+		cert.WithNewECDSAKey(),
+		cert.WithProfile(cert.DualUseProfile),
+		cert.IsValidFor(time.Hour),
+		cert.WithCommonName("alice"),
+		cert.WithDNSNames("alice.example.com"),
+		cert.WithParent(caCert, caKey),
+	))
+
+	caClient := NewClient(newClient(aliceKeyPair))
+
+	csrPEM, _, err := cert.NewCSR(
+		cert.WithCommonName("alice"),
+		cert.WithDNSNames("alice.example.com"),
+	)
+	require.NoError(t, err)
+
+	chain, err := caClient.Request(context.Background(), &Request{
+		CSR:      string(csrPEM),
+		Usage:    UsageServer,
+		Lifetime: 48 * time.Hour,
+	})
+	require.NoError(t, err)
+
+	certs := parseChain(t, chain)
+	require.Len(t, certs, 2)
+	require.Equal(t, "alice", certs[0].Subject.CommonName)
+	require.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, certs[0].ExtKeyUsage)
+	require.True(t, certs[0].NotAfter.Sub(certs[0].NotBefore) <= time.Hour)
+	require.Equal(t, "ca", certs[1].Subject.CommonName)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(certs[1])
+	_, err = certs[0].Verify(x509.VerifyOptions{
+		Roots:   roots,
+		DNSName: "alice.example.com",
+	})
+	require.NoError(t, err)
+
+	for _, opts := range [][]cert.CertOption{
+		{cert.WithCommonName("bob")},
+		{cert.WithCommonName("alice"), cert.WithDNSNames("bob.example.com")},
+		{cert.WithCommonName("alice"), cert.WithIPAddresses(net.ParseIP("10.0.0.1"))},
+	} {
+		csrPEM, _, err := cert.NewCSR(opts...)
+		require.NoError(t, err)
+
+		_, err = caClient.Request(context.Background(), &Request{CSR: string(csrPEM)})
+		require.Error(t, err)
+	}
+}
+
+func mustNew(t *testing.T, opts ...cert.CertOption) ([]byte, []byte) {
+	certPEM, keyPEM, err := cert.New(opts...)
+	require.NoError(t, err)
+	return certPEM, keyPEM
+}
+
+func TestIssueUsageMustMatchCaller(t *testing.T) {
+	pki := testpki.New(t)
+
+	s, newClient := startCA(t, pki)
+	defer s.Shutdown()
+
+	// bob's cert is only for clients
+	bobKeyPair := pki.Client(
+		cert.WithCommonName("bob"),
+		cert.WithDNSNames("bob.example.com"),
+	)
+	caClient := NewClient(newClient(bobKeyPair))
+
+	csrPEM, _, err := cert.NewCSR(
+		cert.WithCommonName("bob"),
+		cert.WithDNSNames("bob.example.com"),
+	)
+	require.NoError(t, err)
+
+	_, err = caClient.Request(context.Background(), &Request{CSR: string(csrPEM), Usage: UsageServer})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "server usage is not allowed")
+
+	chain, err := caClient.Request(context.Background(), &Request{CSR: string(csrPEM)})
+	require.NoError(t, err)
+	require.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, parseChain(t, chain)[0].ExtKeyUsage)
+}
+
+func TestRenewWithRemoteCA(t *testing.T) {
+	pki := testpki.New(t)
+
+	s, newClient := startCA(t, pki)
+	defer s.Shutdown()
+
+	aliceCertPEM, aliceKeyPEM := pki.ClientPEM(cert.WithCommonName("alice"))
+	aliceKeyPair := pki.KeyPair(aliceCertPEM, aliceKeyPEM)
+
+	dir, err := ioutil.TempDir("", "ca")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := pki.Write(dir, "alice", aliceCertPEM, aliceKeyPEM)
+
+	agent, err := renew.New(certFile, keyFile, NewClient(newClient(aliceKeyPair)))
+	require.NoError(t, err)
+
+	require.NoError(t, agent.Renew(context.Background()))
+
+	renewed := agent.Certificate()
+	require.Equal(t, "alice", renewed.Leaf.Subject.CommonName)
+	require.NotEqual(t, aliceKeyPair.Certificate[0], renewed.Certificate[0])
+	require.Len(t, renewed.Certificate, 2)
+}
+
+func TestIssueRequiresVerifiedClient(t *testing.T) {
+	pki := testpki.New(t)
+
+	issuer, err := NewIssuer(bytes.NewReader(pki.CAPrivKeyPEM), bytes.NewReader(pki.CAPEM))
+	require.NoError(t, err)
+
+	// client certs are requested, but not verified
+	serverTLSConfig := pki.ServerTLSConfig()
+	serverTLSConfig.ClientAuth = tls.RequestClientCert
+
+	s, err := NewServer(issuer,
+		server.WithAddr("127.0.0.1:0"),
+		server.WithTLSConfig(serverTLSConfig),
+	)
+	require.NoError(t, err)
+	s.Start()
+	defer s.Shutdown()
+
+	other := testpki.New(t)
+	c, err := client.New(
+		client.WithAddr(s.Listener().Addr().String()),
+		client.WithTLSConfig(&tls.Config{
+			RootCAs:      pki.Pool,
+			Certificates: []tls.Certificate{other.Client(cert.WithCommonName("alice"))},
+		}),
+	)
+	require.NoError(t, err)
+
+	csrPEM, _, err := cert.NewCSR(cert.WithCommonName("alice"))
+	require.NoError(t, err)
+
+	_, err = NewClient(c).Request(context.Background(), &Request{CSR: string(csrPEM)})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "verified client certificate")
+}
@@ -0,0 +1,92 @@
+package ca
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/picatz/mtls/client"
+)
+
+// Client requests certificates from a CA server, authenticating with
+// the client certificate of the given client.Client.
+type Client struct {
+	client *client.Client
+	// Usage of certs issued by Issue, defaulting to client.
+	Usage Usage
+	// Lifetime requested for certs issued by Issue.
+	Lifetime time.Duration
+}
+
+// NewClient creates a new Client using the given client.Client.
+func NewClient(c *client.Client) *Client {
+	return &Client{client: c}
+}
+
+// Request sends the request to the CA server, returning the PEM encoded
+// chain of the issued cert followed by the CA cert.
+func (c *Client) Request(ctx context.Context, req *Request) ([]byte, error) {
+	conn, err := c.client.Dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	err = json.NewEncoder(conn).Encode(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &Response{}
+	err = json.NewDecoder(conn).Decode(resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("ca: %s", resp.Error)
+	}
+	return []byte(resp.Chain), nil
+}
+
+// Issue requests a new cert with a new key for the subject common name
+// and SANs of the current cert. It implements the renew.Issuer interface,
+// so a renew.Agent can use a remote CA.
+func (c *Client) Issue(ctx context.Context, current *x509.Certificate) ([]byte, []byte, error) {
+	csrPEM, privKeyPEM, err := cert.NewCSR(
+		cert.WithCommonName(current.Subject.CommonName),
+		cert.WithDNSNames(current.DNSNames...),
+		cert.WithIPAddresses(current.IPAddresses...),
+		cert.WithURIs(current.URIs...),
+		cert.WithEmailAddresses(current.EmailAddresses...),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chain, err := c.Request(ctx, &Request{
+		CSR:      string(csrPEM),
+		Usage:    c.Usage,
+		Lifetime: c.Lifetime,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return chain, privKeyPEM, nil
+}
@@ -0,0 +1,149 @@
+// Package ca implements an online issuing CA, which signs certificate
+// signing requests from callers authenticated by their current mTLS
+// client certificate.
+package ca
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+)
+
+// Usage is the role a requested certificate is issued for.
+type Usage string
+
+const (
+	UsageClient Usage = "client"
+	UsageServer Usage = "server"
+)
+
+// extKeyUsage returns the extended key usage of certs issued for the
+// usage.
+func (u Usage) extKeyUsage() x509.ExtKeyUsage {
+	if u == UsageServer {
+		return x509.ExtKeyUsageServerAuth
+	}
+	return x509.ExtKeyUsageClientAuth
+}
+
+// Request is a certificate issuance request sent to the CA.
+type Request struct {
+	// CSR is the PEM encoded certificate signing request.
+	CSR string `json:"csr"`
+	// Usage is the role the cert is issued for, defaulting to client.
+	Usage Usage `json:"usage,omitempty"`
+	// Lifetime is the requested lifetime, capped to the CA's maximum.
+	Lifetime time.Duration `json:"lifetime,omitempty"`
+}
+
+// Response is the CA's response to a Request.
+type Response struct {
+	// Chain is the PEM encoded issued cert, followed by the CA cert.
+	Chain string `json:"chain,omitempty"`
+	// Error is the reason the request was denied, if it was.
+	Error string `json:"error,omitempty"`
+}
+
+// Issuer signs certificate requests using a CA cert and key, once
+// they're allowed by its Policy.
+type Issuer struct {
+	caCertPEM    []byte
+	caPrivKeyPEM []byte
+	policy       Policy
+	maxLifetime  time.Duration
+	recorder     cert.Recorder
+}
+
+// NewIssuer creates a new Issuer from the PEM encoded CA private key and
+// cert, applying the given Option(s). By default, the IdentityPolicy is
+// used with the DefaultMaxLifetime.
+func NewIssuer(caPrivKeyPEM, caCertPEM io.Reader, opts ...Option) (*Issuer, error) {
+	issuerOptions := &Options{
+		Policy:      IdentityPolicy{},
+		MaxLifetime: DefaultMaxLifetime,
+	}
+
+	for _, opt := range opts {
+		err := opt(issuerOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	caCertPEMBytes, err := ioutil.ReadAll(caCertPEM)
+	if err != nil {
+		return nil, err
+	}
+	caPrivKeyPEMBytes, err := ioutil.ReadAll(caPrivKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	// make sure the CA cert and key can be used before accepting requests
+	_, _, err = cert.ReadCertAndKey(bytes.NewReader(caCertPEMBytes), bytes.NewReader(caPrivKeyPEMBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Issuer{
+		caCertPEM:    caCertPEMBytes,
+		caPrivKeyPEM: caPrivKeyPEMBytes,
+		policy:       issuerOptions.Policy,
+		maxLifetime:  issuerOptions.MaxLifetime,
+		recorder:     issuerOptions.Recorder,
+	}, nil
+}
+
+// Issue signs the request for the given caller, returning the PEM encoded
+// chain of the issued cert followed by the CA cert.
+func (i *Issuer) Issue(caller *x509.Certificate, req *Request) ([]byte, error) {
+	csr, err := cert.ReadCSR([]byte(req.CSR))
+	if err != nil {
+		return nil, err
+	}
+
+	usage := req.Usage
+	if usage == "" {
+		usage = UsageClient
+	}
+	if usage != UsageClient && usage != UsageServer {
+		return nil, fmt.Errorf("unknown usage %q", req.Usage)
+	}
+
+	err = i.policy.Authorize(caller, csr, usage)
+	if err != nil {
+		return nil, err
+	}
+
+	lifetime := req.Lifetime
+	if lifetime <= 0 || lifetime > i.maxLifetime {
+		lifetime = i.maxLifetime
+	}
+
+	opts := []cert.CertOption{cert.IsValidFor(lifetime)}
+	if usage == UsageServer {
+		opts = append(opts, cert.IsServer())
+	} else {
+		opts = append(opts, cert.IsClient())
+	}
+	if i.recorder != nil {
+		opts = append(opts, cert.WithRecorder(i.recorder), cert.WithRequester(caller.Subject.CommonName))
+	}
+
+	certPEM, err := cert.NewFromCSR(
+		bytes.NewReader(i.caPrivKeyPEM),
+		bytes.NewReader(i.caCertPEM),
+		csr,
+		opts...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(certPEM, i.caCertPEM...), nil
+}
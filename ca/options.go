@@ -0,0 +1,52 @@
+package ca
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+)
+
+// DefaultMaxLifetime is the default maximum lifetime of issued certs.
+const DefaultMaxLifetime = 24 * time.Hour
+
+// Options contains each available configuration option
+// for an Issuer.
+type Options struct {
+	Policy      Policy
+	MaxLifetime time.Duration
+	Recorder    cert.Recorder
+}
+
+// Option implements a hook to customize an Issuer
+// using the NewIssuer function.
+type Option func(*Options) error
+
+// WithPolicy sets the Policy used to authorize requests.
+func WithPolicy(p Policy) Option {
+	return func(o *Options) error {
+		o.Policy = p
+		return nil
+	}
+}
+
+// WithMaxLifetime sets the maximum lifetime of issued certs. Requests
+// for longer lifetimes are capped to it.
+func WithMaxLifetime(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return fmt.Errorf("max lifetime %v must be positive", d)
+		}
+		o.MaxLifetime = d
+		return nil
+	}
+}
+
+// WithRecorder records every issued cert using the given Recorder, with
+// the caller's common name as the requester.
+func WithRecorder(r cert.Recorder) Option {
+	return func(o *Options) error {
+		o.Recorder = r
+		return nil
+	}
+}
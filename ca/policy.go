@@ -0,0 +1,100 @@
+package ca
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Policy decides if a caller, identified by its verified mTLS client
+// certificate, may be issued a certificate for a CSR with the given
+// usage.
+type Policy interface {
+	Authorize(caller *x509.Certificate, csr *x509.CertificateRequest, usage Usage) error
+}
+
+// PolicyFunc implements a Policy using a function.
+type PolicyFunc func(caller *x509.Certificate, csr *x509.CertificateRequest, usage Usage) error
+
+// Authorize calls the function.
+func (f PolicyFunc) Authorize(caller *x509.Certificate, csr *x509.CertificateRequest, usage Usage) error {
+	return f(caller, csr, usage)
+}
+
+// IdentityPolicy only allows callers to request certs for their own
+// identity: the CSR's common name must match the caller's, every
+// requested SAN must already be in the caller's certificate, and so must
+// the extended key usage of the requested usage. A client-only caller
+// can't be issued a server cert.
+type IdentityPolicy struct{}
+
+// Authorize implements the Policy interface.
+func (IdentityPolicy) Authorize(caller *x509.Certificate, csr *x509.CertificateRequest, usage Usage) error {
+	if !hasExtKeyUsage(caller, usage.extKeyUsage()) {
+		return fmt.Errorf("%s usage is not allowed for caller %q", usage, caller.Subject.CommonName)
+	}
+	if csr.Subject.CommonName != caller.Subject.CommonName {
+		return fmt.Errorf("common name %q is not allowed for caller %q", csr.Subject.CommonName, caller.Subject.CommonName)
+	}
+	for _, name := range csr.DNSNames {
+		if !containsFold(caller.DNSNames, name) {
+			return fmt.Errorf("DNS name %q is not allowed for caller %q", name, caller.Subject.CommonName)
+		}
+	}
+	for _, email := range csr.EmailAddresses {
+		if !containsFold(caller.EmailAddresses, email) {
+			return fmt.Errorf("email address %q is not allowed for caller %q", email, caller.Subject.CommonName)
+		}
+	}
+	for _, ip := range csr.IPAddresses {
+		if !containsIP(caller.IPAddresses, ip) {
+			return fmt.Errorf("IP address %s is not allowed for caller %q", ip, caller.Subject.CommonName)
+		}
+	}
+	for _, uri := range csr.URIs {
+		allowed := false
+		for _, callerURI := range caller.URIs {
+			if uri.String() == callerURI.String() {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("URI %q is not allowed for caller %q", uri, caller.Subject.CommonName)
+		}
+	}
+	return nil
+}
+
+// hasExtKeyUsage reports whether the cert may be used for the extended
+// key usage. Like crypto/x509, a cert without any allows every usage.
+func hasExtKeyUsage(c *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	if len(c.ExtKeyUsage) == 0 {
+		return true
+	}
+	for _, u := range c.ExtKeyUsage {
+		if u == usage || u == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, v := range ips {
+		if v.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package ca
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/picatz/mtls/identity"
+	"github.com/picatz/mtls/server"
+)
+
+// requestTimeout limits how long a connection may take to send its
+// request and read the response.
+const requestTimeout = 30 * time.Second
+
+// HandleConn reads a single JSON encoded Request from the connection
+// and writes back a JSON encoded Response. It can be used as a
+// server.Server handler. Requests are only accepted from clients whose
+// certificate was verified during the handshake.
+func (i *Issuer) HandleConn(conn *tls.Conn) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+
+	err := conn.Handshake()
+	if err != nil {
+		log.Printf("ca: handshake-error: %s", err)
+		return
+	}
+
+	resp := &Response{}
+
+	id, idErr := identity.FromConnectionState(conn.ConnectionState())
+	req := &Request{}
+	switch {
+	case idErr != nil:
+		resp.Error = "a verified client certificate is required"
+	default:
+		err = json.NewDecoder(conn).Decode(req)
+		if err != nil {
+			resp.Error = "invalid request: " + err.Error()
+			break
+		}
+		chain, err := i.Issue(id.Certificate, req)
+		if err != nil {
+			log.Printf("ca: denied request from %q: %s", id.CommonName, err)
+			resp.Error = err.Error()
+			break
+		}
+		log.Printf("ca: issued cert to %q", id.CommonName)
+		resp.Chain = string(chain)
+	}
+
+	err = json.NewEncoder(conn).Encode(resp)
+	if err != nil {
+		log.Printf("ca: failed to write response: %s", err)
+	}
+}
+
+// NewServer creates a new server.Server which handles connections
+// using the Issuer. The server's TLS config should require client
+// certificates, for example using tlsconf.WithMutualAuthentication.
+func NewServer(i *Issuer, opts ...server.Option) (*server.Server, error) {
+	allOpts := []server.Option{}
+	allOpts = append(allOpts, opts...)
+	allOpts = append(allOpts, server.WithHandler(i.HandleConn))
+	return server.New(allOpts...)
+}
@@ -1,6 +1,7 @@
 package cert
 
 import (
+	"crypto"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
@@ -20,6 +21,28 @@ func SaveCertAndKey(prefix string, caCertPEM, caPrivKeyPEM []byte) error {
 	return nil
 }
 
+// KeyMismatchError is returned when a private key doesn't belong to
+// the public key of the cert it is read with.
+type KeyMismatchError struct {
+	Subject string
+}
+
+func (e *KeyMismatchError) Error() string {
+	return fmt.Sprintf("private key does not match the public key of cert %q", e.Subject)
+}
+
+// KeyMatches reports whether the private key belongs to the public key.
+func KeyMatches(pub crypto.PublicKey, priv interface{}) bool {
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return false
+	}
+	k, ok := pub.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(signer.Public())
+}
+
+// ReadCertAndKey reads a PEM encoded cert and PKCS #8 private key,
+// checking the key belongs to the cert.
 func ReadCertAndKey(caCertPEM, caPrivKeyPEM io.Reader) (*x509.Certificate, interface{}, error) {
 	// Decode CA cert from PEM encoded io.Reader bytes
 	var cert *x509.Certificate
@@ -57,6 +80,9 @@ func ReadCertAndKey(caCertPEM, caPrivKeyPEM io.Reader) (*x509.Certificate, inter
 	if key == nil {
 		return nil, nil, fmt.Errorf("no priv key found")
 	}
+	if !KeyMatches(cert.PublicKey, key) {
+		return nil, nil, &KeyMismatchError{Subject: cert.Subject.CommonName}
+	}
 
 	// Return
 	return cert, key, nil
@@ -71,3 +97,19 @@ func NewCA(opts ...CertOption) ([]byte, []byte, error) {
 		allOpts...,
 	)
 }
+
+// NewIntermediateFromCA generates a PEM encoded sub-CA cert and private
+// key signed by the given CA. Name constraint options can be used to
+// limit the names the sub-CA can issue certs for.
+func NewIntermediateFromCA(caPrivKeyPEM, caCertPEM io.Reader, opts ...CertOption) ([]byte, []byte, error) {
+	caCert, caPrivKey, err := ReadCertAndKey(caCertPEM, caPrivKeyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	allOpts := []CertOption{}
+	allOpts = append(allOpts, IsCA(), WithNewECDSAKey())
+	allOpts = append(allOpts, opts...)
+	allOpts = append(allOpts, WithParent(caCert, caPrivKey))
+	return New(allOpts...)
+}
@@ -1,6 +1,8 @@
 package cert
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"testing"
 )
@@ -26,3 +28,33 @@ func TestNewCAWithNewRSAKey(t *testing.T) {
 	fmt.Println(string(caPEM))
 	fmt.Println(string(caPrivKeyPEM))
 }
+
+func TestReadCertAndKeyMismatch(t *testing.T) {
+	caPEM, caPrivKeyPEM, err := NewCA(WithCommonName("ca"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPrivKeyPEM, err := NewCA(WithCommonName("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = ReadCertAndKey(bytes.NewReader(caPEM), bytes.NewReader(caPrivKeyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = ReadCertAndKey(bytes.NewReader(caPEM), bytes.NewReader(otherPrivKeyPEM))
+	var mismatchErr *KeyMismatchError
+	if !errors.As(err, &mismatchErr) {
+		t.Fatalf("expected a key mismatch error, got %v", err)
+	}
+	if mismatchErr.Subject != "ca" {
+		t.Fatalf("unexpected subject %q", mismatchErr.Subject)
+	}
+
+	_, _, err = NewServerFromCA(bytes.NewReader(otherPrivKeyPEM), bytes.NewReader(caPEM), WithCommonName("server"))
+	if !errors.As(err, &mismatchErr) {
+		t.Fatalf("expected a key mismatch error, got %v", err)
+	}
+}
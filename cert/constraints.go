@@ -0,0 +1,344 @@
+package cert
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// WithPermittedDNSDomains restricts the CA to issuing certs for the
+// given DNS domains and their subdomains. A domain with a leading "."
+// only permits subdomains.
+func WithPermittedDNSDomains(domains ...string) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.PermittedDNSDomains = append(o.cert.PermittedDNSDomains, domains...)
+		o.cert.PermittedDNSDomainsCritical = true
+		return nil
+	}
+}
+
+// WithExcludedDNSDomains prevents the CA from issuing certs for the
+// given DNS domains and their subdomains.
+func WithExcludedDNSDomains(domains ...string) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.ExcludedDNSDomains = append(o.cert.ExcludedDNSDomains, domains...)
+		o.cert.PermittedDNSDomainsCritical = true
+		return nil
+	}
+}
+
+// WithPermittedIPRanges restricts the CA to issuing certs for IP
+// addresses in the given ranges.
+func WithPermittedIPRanges(ranges ...*net.IPNet) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.PermittedIPRanges = append(o.cert.PermittedIPRanges, ranges...)
+		o.cert.PermittedDNSDomainsCritical = true
+		return nil
+	}
+}
+
+// WithExcludedIPRanges prevents the CA from issuing certs for IP
+// addresses in the given ranges.
+func WithExcludedIPRanges(ranges ...*net.IPNet) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.ExcludedIPRanges = append(o.cert.ExcludedIPRanges, ranges...)
+		o.cert.PermittedDNSDomainsCritical = true
+		return nil
+	}
+}
+
+// WithPermittedURIDomains restricts the CA to issuing certs for URIs
+// whose host is in the given domains.
+func WithPermittedURIDomains(domains ...string) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.PermittedURIDomains = append(o.cert.PermittedURIDomains, domains...)
+		o.cert.PermittedDNSDomainsCritical = true
+		return nil
+	}
+}
+
+// WithExcludedURIDomains prevents the CA from issuing certs for URIs
+// whose host is in the given domains.
+func WithExcludedURIDomains(domains ...string) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.ExcludedURIDomains = append(o.cert.ExcludedURIDomains, domains...)
+		o.cert.PermittedDNSDomainsCritical = true
+		return nil
+	}
+}
+
+// WithPermittedEmailAddresses restricts the CA to issuing certs for the
+// given mailboxes, or mailboxes in the given domains.
+func WithPermittedEmailAddresses(emails ...string) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.PermittedEmailAddresses = append(o.cert.PermittedEmailAddresses, emails...)
+		o.cert.PermittedDNSDomainsCritical = true
+		return nil
+	}
+}
+
+// WithExcludedEmailAddresses prevents the CA from issuing certs for the
+// given mailboxes, or mailboxes in the given domains.
+func WithExcludedEmailAddresses(emails ...string) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.ExcludedEmailAddresses = append(o.cert.ExcludedEmailAddresses, emails...)
+		o.cert.PermittedDNSDomainsCritical = true
+		return nil
+	}
+}
+
+// WithPolicyOIDs adds the given certificate policy OIDs.
+func WithPolicyOIDs(oids ...asn1.ObjectIdentifier) CertOption {
+	return func(o *CertOptions) error {
+		for _, oid := range oids {
+			components := make([]uint64, len(oid))
+			for i, c := range oid {
+				components[i] = uint64(c)
+			}
+			policy, err := x509.OIDFromInts(components)
+			if err != nil {
+				return fmt.Errorf("invalid policy OID %s: %w", oid, err)
+			}
+			o.cert.Policies = append(o.cert.Policies, policy)
+		}
+		o.cert.PolicyIdentifiers = append(o.cert.PolicyIdentifiers, oids...)
+		return nil
+	}
+}
+
+// NameConstraintError is returned when a cert is requested for a name
+// outside of its parent's name constraints, or a CA cert is requested
+// with name constraints wider than its parent's.
+type NameConstraintError struct {
+	Name   string
+	Reason string
+}
+
+func (e *NameConstraintError) Error() string {
+	return fmt.Sprintf("name %q is not allowed by the parent's name constraints: %s", e.Name, e.Reason)
+}
+
+// checkNameConstraints checks every SAN of the cert is allowed by the
+// parent's name constraints.
+func checkNameConstraints(parent, cert *x509.Certificate) error {
+	for _, name := range cert.DNSNames {
+		err := checkConstraints(name, parent.PermittedDNSDomains, parent.ExcludedDNSDomains, matchDomain)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, ip := range cert.IPAddresses {
+		for _, r := range parent.ExcludedIPRanges {
+			if r.Contains(ip) {
+				return &NameConstraintError{Name: ip.String(), Reason: fmt.Sprintf("excluded by %q", r)}
+			}
+		}
+		permitted := len(parent.PermittedIPRanges) == 0
+		for _, r := range parent.PermittedIPRanges {
+			if r.Contains(ip) {
+				permitted = true
+				break
+			}
+		}
+		if !permitted {
+			return &NameConstraintError{Name: ip.String(), Reason: fmt.Sprintf("not in permitted %v", parent.PermittedIPRanges)}
+		}
+	}
+
+	for _, uri := range cert.URIs {
+		host := uri.Hostname()
+		if host == "" && len(parent.PermittedURIDomains) > 0 {
+			return &NameConstraintError{Name: uri.String(), Reason: "URI has no host"}
+		}
+		err := checkConstraints(host, parent.PermittedURIDomains, parent.ExcludedURIDomains, matchDomain)
+		if err != nil {
+			err.(*NameConstraintError).Name = uri.String()
+			return err
+		}
+	}
+
+	for _, email := range cert.EmailAddresses {
+		err := checkConstraints(email, parent.PermittedEmailAddresses, parent.ExcludedEmailAddresses, matchEmail)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkCAConstraints checks the name constraints of a CA cert are no
+// wider than the parent's, so the parent's constraints still hold for
+// certs the CA issues, which are only checked against the CA's own.
+func checkCAConstraints(parent, cert *x509.Certificate) error {
+	err := checkConstraintsWithin(
+		cert.PermittedDNSDomains, cert.ExcludedDNSDomains,
+		parent.PermittedDNSDomains, parent.ExcludedDNSDomains,
+		domainWithin,
+	)
+	if err != nil {
+		return err
+	}
+	err = checkConstraintsWithin(
+		cert.PermittedURIDomains, cert.ExcludedURIDomains,
+		parent.PermittedURIDomains, parent.ExcludedURIDomains,
+		domainWithin,
+	)
+	if err != nil {
+		return err
+	}
+	err = checkConstraintsWithin(
+		cert.PermittedEmailAddresses, cert.ExcludedEmailAddresses,
+		parent.PermittedEmailAddresses, parent.ExcludedEmailAddresses,
+		emailWithin,
+	)
+	if err != nil {
+		return err
+	}
+	return checkConstraintsWithin(
+		ipRangeStrings(cert.PermittedIPRanges), ipRangeStrings(cert.ExcludedIPRanges),
+		ipRangeStrings(parent.PermittedIPRanges), ipRangeStrings(parent.ExcludedIPRanges),
+		ipRangeWithin,
+	)
+}
+
+// checkConstraintsWithin checks every permitted constraint is within a
+// permitted parent constraint, and that every excluded parent
+// constraint which overlaps the permitted ones is also excluded.
+// within reports whether the first constraint is within the second.
+func checkConstraintsWithin(permitted, excluded, parentPermitted, parentExcluded []string, within func(a, b string) bool) error {
+	if len(parentPermitted) > 0 && len(permitted) == 0 {
+		return &NameConstraintError{Name: "*", Reason: fmt.Sprintf("CA must be constrained to permitted %v", parentPermitted)}
+	}
+	for _, constraint := range permitted {
+		ok := len(parentPermitted) == 0
+		for _, parentConstraint := range parentPermitted {
+			if within(constraint, parentConstraint) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return &NameConstraintError{Name: constraint, Reason: fmt.Sprintf("not in permitted %v", parentPermitted)}
+		}
+	}
+
+	for _, parentConstraint := range parentExcluded {
+		overlaps := len(permitted) == 0
+		for _, constraint := range permitted {
+			if within(constraint, parentConstraint) || within(parentConstraint, constraint) {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			continue
+		}
+		ok := false
+		for _, constraint := range excluded {
+			if within(parentConstraint, constraint) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return &NameConstraintError{Name: parentConstraint, Reason: "CA must also exclude it"}
+		}
+	}
+	return nil
+}
+
+// domainWithin reports whether every domain matched by the constraint
+// is matched by the parent constraint.
+func domainWithin(constraint, parent string) bool {
+	if !strings.HasPrefix(constraint, ".") {
+		return matchDomain(constraint, parent)
+	}
+	if strings.HasPrefix(parent, ".") {
+		return strings.HasSuffix(strings.ToLower(constraint), strings.ToLower(parent))
+	}
+	return matchDomain(constraint[1:], parent)
+}
+
+// emailWithin reports whether every email matched by the constraint is
+// matched by the parent constraint.
+func emailWithin(constraint, parent string) bool {
+	if strings.Contains(constraint, "@") {
+		return matchEmail(constraint, parent)
+	}
+	if strings.Contains(parent, "@") {
+		return false
+	}
+	return domainWithin(constraint, parent)
+}
+
+// ipRangeWithin reports whether the first CIDR range is within the
+// second.
+func ipRangeWithin(constraint, parent string) bool {
+	_, r, err := net.ParseCIDR(constraint)
+	if err != nil {
+		return false
+	}
+	_, parentRange, err := net.ParseCIDR(parent)
+	if err != nil {
+		return false
+	}
+	ones, bits := r.Mask.Size()
+	parentOnes, parentBits := parentRange.Mask.Size()
+	return bits == parentBits && parentOnes <= ones && parentRange.Contains(r.IP)
+}
+
+func ipRangeStrings(ranges []*net.IPNet) []string {
+	var s []string
+	for _, r := range ranges {
+		s = append(s, r.String())
+	}
+	return s
+}
+
+func checkConstraints(name string, permitted, excluded []string, match func(name, constraint string) bool) error {
+	for _, constraint := range excluded {
+		if match(name, constraint) {
+			return &NameConstraintError{Name: name, Reason: fmt.Sprintf("excluded by %q", constraint)}
+		}
+	}
+	if len(permitted) == 0 {
+		return nil
+	}
+	for _, constraint := range permitted {
+		if match(name, constraint) {
+			return nil
+		}
+	}
+	return &NameConstraintError{Name: name, Reason: fmt.Sprintf("not in permitted %v", permitted)}
+}
+
+// matchDomain reports whether the domain is the constraint or one of its
+// subdomains. Constraints with a leading "." only match subdomains.
+func matchDomain(domain, constraint string) bool {
+	domain = strings.ToLower(domain)
+	constraint = strings.ToLower(constraint)
+	if constraint == "" {
+		return true
+	}
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(domain, constraint)
+	}
+	return domain == constraint || strings.HasSuffix(domain, "."+constraint)
+}
+
+// matchEmail reports whether the email is the constraint mailbox, or is
+// in the constraint domain.
+func matchEmail(email, constraint string) bool {
+	if strings.Contains(constraint, "@") {
+		return strings.EqualFold(email, constraint)
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	return matchDomain(email[at+1:], constraint)
+}
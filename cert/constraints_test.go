@@ -0,0 +1,184 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestNameConstraints(t *testing.T) {
+	rootPEM, rootPrivKeyPEM, err := NewCA(WithCommonName("root"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, internalNet, _ := net.ParseCIDR("10.1.0.0/16")
+	policy := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+
+	subCAPEM, subCAPrivKeyPEM, err := NewIntermediateFromCA(
+		bytes.NewReader(rootPrivKeyPEM),
+		bytes.NewReader(rootPEM),
+		WithCommonName("team-a"),
+		WithPermittedDNSDomains("team-a.internal"),
+		WithExcludedDNSDomains("secret.team-a.internal"),
+		WithPermittedIPRanges(internalNet),
+		WithPermittedURIDomains("team-a.internal"),
+		WithPermittedEmailAddresses("team-a.internal"),
+		WithPolicyOIDs(policy),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(subCAPEM)
+	subCA, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !subCA.PermittedDNSDomainsCritical || len(subCA.PermittedDNSDomains) != 1 || len(subCA.ExcludedDNSDomains) != 1 {
+		t.Fatalf("unexpected name constraints %v %v", subCA.PermittedDNSDomains, subCA.ExcludedDNSDomains)
+	}
+	if len(subCA.PolicyIdentifiers) != 1 || !subCA.PolicyIdentifiers[0].Equal(policy) {
+		t.Fatalf("unexpected policy identifiers %v", subCA.PolicyIdentifiers)
+	}
+	if len(subCA.Policies) != 1 || subCA.Policies[0].String() != policy.String() {
+		t.Fatalf("unexpected policies %v", subCA.Policies)
+	}
+	_, _, err = NewCA(WithCommonName("bad-policy"), WithPolicyOIDs(asn1.ObjectIdentifier{3, 1}))
+	if err == nil {
+		t.Fatal("expected an error for an invalid policy OID")
+	}
+
+	spiffe, _ := url.Parse("spiffe://team-a.internal/web")
+	other, _ := url.Parse("spiffe://team-b.internal/web")
+
+	tests := map[string]struct {
+		opts    []CertOption
+		allowed bool
+	}{
+		"permitted domain": {[]CertOption{WithDNSNames("team-a.internal")}, true},
+		"permitted sub":    {[]CertOption{WithDNSNames("web.team-a.internal")}, true},
+		"other domain":     {[]CertOption{WithDNSNames("web.team-b.internal")}, false},
+		"suffix only":      {[]CertOption{WithDNSNames("evilteam-a.internal")}, false},
+		"excluded domain":  {[]CertOption{WithDNSNames("db.secret.team-a.internal")}, false},
+		"permitted ip":     {[]CertOption{WithIPAddresses(net.ParseIP("10.1.2.3"))}, true},
+		"other ip":         {[]CertOption{WithIPAddresses(net.ParseIP("10.2.2.3"))}, false},
+		"permitted uri":    {[]CertOption{WithURIs(spiffe)}, true},
+		"other uri":        {[]CertOption{WithURIs(other)}, false},
+		"permitted email":  {[]CertOption{WithEmailAddresses("ops@team-a.internal")}, true},
+		"other email":      {[]CertOption{WithEmailAddresses("ops@team-b.internal")}, false},
+		"one name outside": {[]CertOption{WithDNSNames("web.team-a.internal", "web.team-b.internal")}, false},
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(rootPEM)
+	intermediates := x509.NewCertPool()
+	intermediates.AppendCertsFromPEM(subCAPEM)
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := append([]CertOption{WithCommonName("leaf")}, test.opts...)
+			certPEM, _, err := NewServerFromCA(
+				bytes.NewReader(subCAPrivKeyPEM),
+				bytes.NewReader(subCAPEM),
+				opts...,
+			)
+			if !test.allowed {
+				var constraintErr *NameConstraintError
+				if !errors.As(err, &constraintErr) {
+					t.Fatalf("expected a NameConstraintError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// certs issued within the constraints also pass verification
+			block, _ := pem.Decode(certPEM)
+			leaf, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = leaf.Verify(x509.VerifyOptions{
+				Roots:         roots,
+				Intermediates: intermediates,
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestCAConstraintsWithinParent(t *testing.T) {
+	rootPEM, rootPrivKeyPEM, err := NewCA(WithCommonName("root"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, internalNet, _ := net.ParseCIDR("10.1.0.0/16")
+	subCAPEM, subCAPrivKeyPEM, err := NewIntermediateFromCA(
+		bytes.NewReader(rootPrivKeyPEM),
+		bytes.NewReader(rootPEM),
+		WithCommonName("team-a"),
+		WithPermittedDNSDomains("team-a.internal"),
+		WithExcludedDNSDomains("secret.team-a.internal"),
+		WithPermittedIPRanges(internalNet),
+		WithPermittedEmailAddresses("team-a.internal"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, webNet, _ := net.ParseCIDR("10.1.2.0/24")
+	_, otherNet, _ := net.ParseCIDR("10.0.0.0/8")
+	within := []CertOption{
+		WithPermittedIPRanges(webNet),
+		WithPermittedEmailAddresses("ops@team-a.internal"),
+	}
+
+	tests := map[string]struct {
+		opts    []CertOption
+		allowed bool
+	}{
+		"narrower":              {[]CertOption{WithPermittedDNSDomains("web.team-a.internal")}, true},
+		"subdomains only":       {[]CertOption{WithPermittedDNSDomains(".team-a.internal"), WithExcludedDNSDomains("secret.team-a.internal")}, true},
+		"unconstrained":         {nil, false},
+		"other domain":          {[]CertOption{WithPermittedDNSDomains("team-b.internal")}, false},
+		"exclusion dropped":     {[]CertOption{WithPermittedDNSDomains("team-a.internal")}, false},
+		"exclusion kept":        {[]CertOption{WithPermittedDNSDomains("team-a.internal"), WithExcludedDNSDomains("secret.team-a.internal")}, true},
+		"wider ip range":        {[]CertOption{WithPermittedDNSDomains("web.team-a.internal"), WithPermittedIPRanges(otherNet)}, false},
+		"email domain to other": {[]CertOption{WithPermittedDNSDomains("web.team-a.internal"), WithPermittedEmailAddresses("team-b.internal")}, false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := []CertOption{WithCommonName("sub")}
+			if test.opts != nil {
+				opts = append(opts, within...)
+			}
+			opts = append(opts, test.opts...)
+			_, _, err := NewIntermediateFromCA(
+				bytes.NewReader(subCAPrivKeyPEM),
+				bytes.NewReader(subCAPEM),
+				opts...,
+			)
+			if !test.allowed {
+				var constraintErr *NameConstraintError
+				if !errors.As(err, &constraintErr) {
+					t.Fatalf("expected a NameConstraintError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
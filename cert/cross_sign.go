@@ -0,0 +1,178 @@
+package cert
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// CrossSign generates a PEM encoded cert for the subject CA cert's name
+// and public key, signed by the signer CA. Certs issued by the subject CA
+// then also chain to the signer CA when the cross-signed cert is sent as
+// an intermediate. The validity is limited to the signer's.
+func CrossSign(signerPrivKeyPEM, signerCertPEM io.Reader, subjectCertPEM []byte, opts ...CertOption) ([]byte, error) {
+	subjects, err := ParseCertificates(subjectCertPEM)
+	if err != nil {
+		return nil, err
+	}
+	subject := subjects[0]
+	if !subject.IsCA {
+		return nil, fmt.Errorf("only CA certs can be cross-signed, %q is not a CA", subject.Subject)
+	}
+
+	signerCert, signerKey, err := ReadCertAndKey(signerCertPEM, signerPrivKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	notBefore, notAfter := subject.NotBefore, subject.NotAfter
+	if signerCert.NotBefore.After(notBefore) {
+		notBefore = signerCert.NotBefore
+	}
+	if signerCert.NotAfter.Before(notAfter) {
+		notAfter = signerCert.NotAfter
+	}
+
+	allOpts := []CertOption{
+		WithPublicKey(subject.PublicKey),
+		WithSubject(subject.Subject),
+		// the subject key identifier is kept, so chains can be built
+		// through either cert
+		WithSubjectKeyID(subject.SubjectKeyId),
+		func(o *CertOptions) error {
+			o.cert.IsCA = true
+			o.cert.KeyUsage = subject.KeyUsage
+			o.cert.ExtKeyUsage = subject.ExtKeyUsage
+			o.cert.MaxPathLen = subject.MaxPathLen
+			o.cert.MaxPathLenZero = subject.MaxPathLenZero
+			o.cert.PermittedDNSDomainsCritical = subject.PermittedDNSDomainsCritical
+			o.cert.PermittedDNSDomains = subject.PermittedDNSDomains
+			o.cert.ExcludedDNSDomains = subject.ExcludedDNSDomains
+			o.cert.PermittedIPRanges = subject.PermittedIPRanges
+			o.cert.ExcludedIPRanges = subject.ExcludedIPRanges
+			o.cert.PermittedURIDomains = subject.PermittedURIDomains
+			o.cert.ExcludedURIDomains = subject.ExcludedURIDomains
+			o.cert.PermittedEmailAddresses = subject.PermittedEmailAddresses
+			o.cert.ExcludedEmailAddresses = subject.ExcludedEmailAddresses
+			o.cert.PolicyIdentifiers = subject.PolicyIdentifiers
+			o.cert.Policies = subject.Policies
+			o.cert.NotBefore = notBefore
+			o.cert.NotAfter = notAfter
+			return nil
+		},
+	}
+	allOpts = append(allOpts, opts...)
+	allOpts = append(allOpts, WithParent(signerCert, signerKey))
+
+	certPEM, _, err := New(allOpts...)
+	return certPEM, err
+}
+
+// RolloverPhase is a phase of replacing an old root CA with a new one.
+type RolloverPhase int
+
+const (
+	// PhaseInitial is before the rollover: only the old root is trusted
+	// and it issues every cert.
+	PhaseInitial RolloverPhase = iota
+	// PhaseIntroduce adds the new root to trust stores, while the old
+	// root keeps issuing certs. Certs are sent with the old root
+	// cross-signed by the new one, so peers trusting only the new root
+	// accept them.
+	PhaseIntroduce
+	// PhaseIssueNew switches issuance to the new root. Certs are sent
+	// with the new root cross-signed by the old one, so peers still
+	// trusting only the old root accept them.
+	PhaseIssueNew
+	// PhaseRetire removes the old root from trust stores, once every
+	// cert issued by it has been replaced.
+	PhaseRetire
+)
+
+// RolloverPhases contains every RolloverPhase, in order.
+var RolloverPhases = []RolloverPhase{PhaseInitial, PhaseIntroduce, PhaseIssueNew, PhaseRetire}
+
+func (p RolloverPhase) String() string {
+	switch p {
+	case PhaseInitial:
+		return "initial"
+	case PhaseIntroduce:
+		return "introduce"
+	case PhaseIssueNew:
+		return "issue-new"
+	case PhaseRetire:
+		return "retire"
+	default:
+		return fmt.Sprintf("phase(%d)", int(p))
+	}
+}
+
+// Rollover contains the PEM encoded roots and cross-signed certs used to
+// replace an old root CA with a new one.
+type Rollover struct {
+	OldRoot []byte
+	NewRoot []byte
+	// OldSignedByNew is the old root cross-signed by the new root.
+	OldSignedByNew []byte
+	// NewSignedByOld is the new root cross-signed by the old root.
+	NewSignedByOld []byte
+
+	oldPrivKey []byte
+	newPrivKey []byte
+}
+
+// NewRollover cross-signs the old and new root CAs with each other.
+func NewRollover(oldPrivKeyPEM, oldCertPEM, newPrivKeyPEM, newCertPEM []byte) (*Rollover, error) {
+	oldSignedByNew, err := CrossSign(bytes.NewReader(newPrivKeyPEM), bytes.NewReader(newCertPEM), oldCertPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cross-sign the old root: %w", err)
+	}
+	newSignedByOld, err := CrossSign(bytes.NewReader(oldPrivKeyPEM), bytes.NewReader(oldCertPEM), newCertPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cross-sign the new root: %w", err)
+	}
+
+	return &Rollover{
+		OldRoot:        oldCertPEM,
+		NewRoot:        newCertPEM,
+		OldSignedByNew: oldSignedByNew,
+		NewSignedByOld: newSignedByOld,
+		oldPrivKey:     oldPrivKeyPEM,
+		newPrivKey:     newPrivKeyPEM,
+	}, nil
+}
+
+// RolloverBundles is what peers use during a RolloverPhase.
+type RolloverBundles struct {
+	// Trust is the PEM encoded roots peers trust.
+	Trust []byte
+	// Chain is the PEM encoded intermediates peers send after their
+	// leaf cert, if any.
+	Chain []byte
+	// IssuerCert and IssuerPrivKey are the PEM encoded CA cert and key
+	// that issue leaf certs.
+	IssuerCert    []byte
+	IssuerPrivKey []byte
+}
+
+// Bundles returns what peers use during the given phase. Peers only need
+// to be updated between adjacent phases: peers of a phase interoperate
+// with peers of the phase before it, with peers trusting only the old
+// root until PhaseRetire, and with peers trusting only the new root from
+// PhaseIntroduce on.
+func (r *Rollover) Bundles(phase RolloverPhase) (*RolloverBundles, error) {
+	both := append(append([]byte{}, r.OldRoot...), r.NewRoot...)
+
+	switch phase {
+	case PhaseInitial:
+		return &RolloverBundles{Trust: r.OldRoot, IssuerCert: r.OldRoot, IssuerPrivKey: r.oldPrivKey}, nil
+	case PhaseIntroduce:
+		return &RolloverBundles{Trust: both, Chain: r.OldSignedByNew, IssuerCert: r.OldRoot, IssuerPrivKey: r.oldPrivKey}, nil
+	case PhaseIssueNew:
+		return &RolloverBundles{Trust: both, Chain: r.NewSignedByOld, IssuerCert: r.NewRoot, IssuerPrivKey: r.newPrivKey}, nil
+	case PhaseRetire:
+		return &RolloverBundles{Trust: r.NewRoot, IssuerCert: r.NewRoot, IssuerPrivKey: r.newPrivKey}, nil
+	default:
+		return nil, fmt.Errorf("unknown rollover phase %d", int(phase))
+	}
+}
@@ -0,0 +1,196 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"testing"
+)
+
+// rolloverPeer is an mTLS client or server configured during a root
+// rollover.
+type rolloverPeer struct {
+	name    string
+	trust   *x509.CertPool
+	keyPair tls.Certificate
+}
+
+func newRolloverPeer(t *testing.T, name string, bundles *RolloverBundles) *rolloverPeer {
+	certPEM, keyPEM, err := NewFromProfile(
+		bytes.NewReader(bundles.IssuerPrivKey),
+		bytes.NewReader(bundles.IssuerCert),
+		DualUseProfile,
+		WithCommonName(name),
+		WithDNSNames("localhost"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyPair, err := tls.X509KeyPair(append(certPEM, bundles.Chain...), keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trust := x509.NewCertPool()
+	if !trust.AppendCertsFromPEM(bundles.Trust) {
+		t.Fatal("no trusted roots")
+	}
+
+	return &rolloverPeer{name: name, trust: trust, keyPair: keyPair}
+}
+
+// rolloverHandshake does an mTLS handshake between the peers over
+// loopback, returning the first error of either side.
+func rolloverHandshake(server, client *rolloverPeer) error {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{server.keyPair},
+		ClientCAs:    server.trust,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+		serverErr <- conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{
+		ServerName:   "localhost",
+		RootCAs:      client.trust,
+		Certificates: []tls.Certificate{client.keyPair},
+	})
+	if err == nil {
+		// TLS 1.3 clients finish before the server verifies them
+		_, err = conn.Read(make([]byte, 1))
+		if err != nil && err.Error() == "EOF" {
+			err = nil
+		}
+		conn.Close()
+	}
+	if sErr := <-serverErr; sErr != nil {
+		return fmt.Errorf("server %s: %w", server.name, sErr)
+	}
+	if err != nil {
+		return fmt.Errorf("client %s: %w", client.name, err)
+	}
+	return nil
+}
+
+func TestRollover(t *testing.T) {
+	oldPEM, oldPrivKeyPEM, err := NewCA(WithCommonName("old-root"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPEM, newPrivKeyPEM, err := NewCA(WithCommonName("new-root"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRollover(oldPrivKeyPEM, oldPEM, newPrivKeyPEM, newPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initial, _ := r.Bundles(PhaseInitial)
+	retire, _ := r.Bundles(PhaseRetire)
+
+	// peers which are never updated during the rollover, or are
+	// installed after it
+	oldOnly := newRolloverPeer(t, "old-only", initial)
+	newOnly := newRolloverPeer(t, "new-only", retire)
+
+	var previous *rolloverPeer
+	for _, phase := range RolloverPhases {
+		t.Run(phase.String(), func(t *testing.T) {
+			bundles, err := r.Bundles(phase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			current := newRolloverPeer(t, phase.String(), bundles)
+
+			others := []*rolloverPeer{current}
+			if previous != nil {
+				others = append(others, previous)
+			}
+			if phase < PhaseRetire {
+				others = append(others, oldOnly)
+			}
+			if phase >= PhaseIntroduce {
+				others = append(others, newOnly)
+			}
+
+			for _, other := range others {
+				if err := rolloverHandshake(current, other); err != nil {
+					t.Errorf("%s client with %s server: %v", other.name, current.name, err)
+				}
+				if err := rolloverHandshake(other, current); err != nil {
+					t.Errorf("%s client with %s server: %v", current.name, other.name, err)
+				}
+			}
+
+			previous = current
+		})
+	}
+
+	// without the cross-signed cert, peers trusting only the old root
+	// reject certs issued by the new one
+	issueNew, _ := r.Bundles(PhaseIssueNew)
+	issueNew.Chain = nil
+	if err := rolloverHandshake(oldOnly, newRolloverPeer(t, "no-chain", issueNew)); err == nil {
+		t.Fatal("expected the handshake to fail without the cross-signed cert")
+	}
+}
+
+func TestCrossSign(t *testing.T) {
+	oldPEM, oldPrivKeyPEM, err := NewCA(WithCommonName("old-root"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+	newPEM, _, err := NewCA(WithCommonName("new-root"), WithPermittedDNSDomains("internal"), WithPolicyOIDs(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crossPEM, err := CrossSign(bytes.NewReader(oldPrivKeyPEM), bytes.NewReader(oldPEM), newPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cross := parseCertPEM(t, crossPEM)
+	newRoot := parseCertPEM(t, newPEM)
+	oldRoot := parseCertPEM(t, oldPEM)
+	if cross.Subject.String() != newRoot.Subject.String() || cross.Issuer.String() != oldRoot.Subject.String() {
+		t.Fatalf("unexpected subject %q or issuer %q", cross.Subject, cross.Issuer)
+	}
+	if !bytes.Equal(cross.SubjectKeyId, newRoot.SubjectKeyId) || !bytes.Equal(cross.AuthorityKeyId, oldRoot.SubjectKeyId) {
+		t.Fatal("unexpected key identifiers")
+	}
+	if !cross.IsCA || len(cross.PermittedDNSDomains) != 1 {
+		t.Fatal("expected the CA flag and name constraints to be kept")
+	}
+	if len(cross.Policies) != 1 || cross.Policies[0].String() != policy.String() {
+		t.Fatalf("expected the policies to be kept, got %v", cross.Policies)
+	}
+
+	leafPEM, _, err := New(WithNewECDSAKey(), WithCommonName("leaf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = CrossSign(bytes.NewReader(oldPrivKeyPEM), bytes.NewReader(oldPEM), leafPEM)
+	if err == nil {
+		t.Fatal("expected an error cross-signing a non-CA cert")
+	}
+}
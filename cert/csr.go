@@ -0,0 +1,125 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+)
+
+// NewCSR generates a PEM encoded certificate signing request and private
+// key. The subject common name and SANs are taken from the given options,
+// and a new ECDSA key is used unless another key option is given.
+func NewCSR(opts ...CertOption) ([]byte, []byte, error) {
+	bc, err := baseCert()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cerOpts := &CertOptions{
+		cert: bc,
+	}
+
+	allOpts := []CertOption{}
+	allOpts = append(allOpts, WithNewECDSAKey())
+	allOpts = append(allOpts, opts...)
+
+	for _, opt := range allOpts {
+		err := opt(cerOpts)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if cerOpts.key == nil {
+		return nil, nil, fmt.Errorf("a private key is required to sign a CSR")
+	}
+
+	template := &x509.CertificateRequest{
+		Subject:        cerOpts.cert.Subject,
+		DNSNames:       cerOpts.cert.DNSNames,
+		IPAddresses:    cerOpts.cert.IPAddresses,
+		URIs:           cerOpts.cert.URIs,
+		EmailAddresses: cerOpts.cert.EmailAddresses,
+	}
+
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, template, cerOpts.key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	csrPEMBuffer := new(bytes.Buffer)
+	err = pem.Encode(csrPEMBuffer, &pem.Block{
+		Type:  "CERTIFICATE REQUEST",
+		Bytes: csrBytes,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b, err := x509.MarshalPKCS8PrivateKey(cerOpts.key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privKeyPEMBuffer := new(bytes.Buffer)
+	err = pem.Encode(privKeyPEMBuffer, &pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: b,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return csrPEMBuffer.Bytes(), privKeyPEMBuffer.Bytes(), nil
+}
+
+// ReadCSR decodes a PEM encoded certificate signing request, checking
+// its signature.
+func ReadCSR(csrPEM []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("no CSR found")
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = csr.CheckSignature()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSR signature: %w", err)
+	}
+
+	return csr, nil
+}
+
+// NewFromCSR generates a PEM encoded x509 cert for the public key of the
+// given certificate signing request, signed by the given CA. Only the
+// subject common name and SANs are copied from the CSR. Options, such
+// as IsServer or IsClient, are applied after them.
+func NewFromCSR(caPrivKeyPEM, caCertPEM io.Reader, csr *x509.CertificateRequest, opts ...CertOption) ([]byte, error) {
+	allOpts := []CertOption{
+		WithPublicKey(csr.PublicKey),
+		WithCommonName(csr.Subject.CommonName),
+		WithDNSNames(csr.DNSNames...),
+		WithIPAddresses(csr.IPAddresses...),
+		WithURIs(csr.URIs...),
+		WithEmailAddresses(csr.EmailAddresses...),
+	}
+	allOpts = append(allOpts, opts...)
+
+	// Decode CA cert and private key from PEM encoded io.Reader bytes
+	caCert, caPrivKey, err := ReadCertAndKey(caCertPEM, caPrivKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	allOpts = append(allOpts, WithParent(caCert, caPrivKey))
+
+	certPEM, _, err := New(allOpts...)
+	return certPEM, err
+}
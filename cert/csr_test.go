@@ -0,0 +1,75 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestNewFromCSR(t *testing.T) {
+	caPEM, caPrivKeyPEM, err := NewCA(
+		WithCommonName("ca"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csrPEM, privKeyPEM, err := NewCSR(
+		WithCommonName("client"),
+		WithDNSNames("client.example.com"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csr, err := ReadCSR(csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := NewFromCSR(
+		bytes.NewReader(caPrivKeyPEM),
+		bytes.NewReader(caPEM),
+		csr,
+		IsClient(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tls.X509KeyPair(certPEM, privKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(certPEM)
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Subject.CommonName != "client" || len(c.DNSNames) != 1 || c.DNSNames[0] != "client.example.com" {
+		t.Fatalf("unexpected subject %q and DNS names %v", c.Subject.CommonName, c.DNSNames)
+	}
+	if len(c.ExtKeyUsage) != 1 || c.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth {
+		t.Fatalf("unexpected ext key usage %v", c.ExtKeyUsage)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	_, err = c.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadCSRInvalid(t *testing.T) {
+	_, err := ReadCSR([]byte("not a CSR"))
+	if err == nil {
+		t.Fatal("expected error for missing CSR")
+	}
+}
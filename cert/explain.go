@@ -0,0 +1,232 @@
+package cert
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ChainReason is a reason a certificate chain fails verification.
+type ChainReason string
+
+const (
+	ChainExpired          ChainReason = "expired"
+	ChainNotYetValid      ChainReason = "not_yet_valid"
+	ChainWrongEKU         ChainReason = "wrong_eku"
+	ChainUnknownAuthority ChainReason = "unknown_authority"
+	ChainNameConstraint   ChainReason = "name_constraint"
+	ChainHostnameMismatch ChainReason = "hostname_mismatch"
+	ChainNotAuthorized    ChainReason = "not_authorized_to_sign"
+	ChainOther            ChainReason = "other"
+)
+
+// ChainIssue is a single reason a chain fails verification, and the
+// subject of the certificate it applies to.
+type ChainIssue struct {
+	Reason      ChainReason `json:"reason"`
+	Certificate string      `json:"certificate"`
+	Message     string      `json:"message"`
+}
+
+// ChainExplanation reports whether a certificate chains to a trusted
+// root, and if not, every reason it doesn't.
+type ChainExplanation struct {
+	Valid  bool         `json:"valid"`
+	Chains [][]string   `json:"chains,omitempty"`
+	Issues []ChainIssue `json:"issues,omitempty"`
+}
+
+func (e *ChainExplanation) add(reason ChainReason, c *x509.Certificate, format string, args ...interface{}) {
+	for _, issue := range e.Issues {
+		if issue.Reason == reason && issue.Certificate == c.Subject.String() {
+			return
+		}
+	}
+	e.Issues = append(e.Issues, ChainIssue{
+		Reason:      reason,
+		Certificate: c.Subject.String(),
+		Message:     fmt.Sprintf(format, args...),
+	})
+}
+
+// String formats the explanation as human readable text.
+func (e *ChainExplanation) String() string {
+	var b strings.Builder
+	if e.Valid {
+		b.WriteString("valid\n")
+		for _, chain := range e.Chains {
+			fmt.Fprintf(&b, "  %s\n", strings.Join(chain, " <- "))
+		}
+		return b.String()
+	}
+	b.WriteString("invalid\n")
+	for _, issue := range e.Issues {
+		fmt.Fprintf(&b, "  %s: %s (%s)\n", issue.Reason, issue.Message, issue.Certificate)
+	}
+	return b.String()
+}
+
+type explainOptions struct {
+	intermediates *x509.CertPool
+	dnsName       string
+	keyUsages     []x509.ExtKeyUsage
+	now           time.Time
+}
+
+// ExplainOption customizes the checks done by ExplainChain.
+type ExplainOption func(*explainOptions)
+
+// WithIntermediates sets the intermediate certs used to build chains.
+func WithIntermediates(pool *x509.CertPool) ExplainOption {
+	return func(o *explainOptions) {
+		o.intermediates = pool
+	}
+}
+
+// ForDNSName checks the leaf is valid for the given host name.
+func ForDNSName(name string) ExplainOption {
+	return func(o *explainOptions) {
+		o.dnsName = name
+	}
+}
+
+// ForKeyUsages checks the chain is valid for one of the given extended
+// key usages, instead of server auth.
+func ForKeyUsages(usages ...x509.ExtKeyUsage) ExplainOption {
+	return func(o *explainOptions) {
+		o.keyUsages = usages
+	}
+}
+
+// At checks the chain at the given time, instead of now.
+func At(t time.Time) ExplainOption {
+	return func(o *explainOptions) {
+		o.now = t
+	}
+}
+
+// ExplainChain verifies the leaf chains to one of the roots, reporting
+// every problem found instead of only the first one, as x509 does.
+func ExplainChain(leaf *x509.Certificate, roots *x509.CertPool, opts ...ExplainOption) *ChainExplanation {
+	o := &explainOptions{
+		keyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		now:       time.Now(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	e := &ChainExplanation{}
+
+	// problems with the leaf itself are checked first, since x509 stops
+	// at the first problem it finds while building chains
+	verifyAt := o.now
+	switch {
+	case o.now.After(leaf.NotAfter):
+		e.add(ChainExpired, leaf, "expired at %s", leaf.NotAfter.Format(time.RFC3339))
+		verifyAt = leaf.NotAfter
+	case o.now.Before(leaf.NotBefore):
+		e.add(ChainNotYetValid, leaf, "not valid until %s", leaf.NotBefore.Format(time.RFC3339))
+		verifyAt = leaf.NotBefore
+	}
+
+	if !hasExtKeyUsage(leaf, o.keyUsages) {
+		e.add(ChainWrongEKU, leaf, "ext key usages %v do not include %v", extKeyUsageStrings(leaf.ExtKeyUsage), extKeyUsageStrings(o.keyUsages))
+	}
+
+	if o.dnsName != "" {
+		err := leaf.VerifyHostname(o.dnsName)
+		if err != nil {
+			e.add(ChainHostnameMismatch, leaf, "%s", err)
+		}
+	}
+
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: o.intermediates,
+		CurrentTime:   verifyAt,
+		KeyUsages:     o.keyUsages,
+	})
+	if err != nil {
+		explainVerifyError(e, leaf, o.now, err)
+	}
+
+	if len(e.Issues) > 0 {
+		return e
+	}
+
+	e.Valid = true
+	for _, chain := range chains {
+		var subjects []string
+		for _, c := range chain {
+			subjects = append(subjects, c.Subject.String())
+		}
+		e.Chains = append(e.Chains, subjects)
+	}
+	return e
+}
+
+func hasExtKeyUsage(c *x509.Certificate, usages []x509.ExtKeyUsage) bool {
+	if len(c.ExtKeyUsage) == 0 {
+		return true
+	}
+	for _, have := range c.ExtKeyUsage {
+		if have == x509.ExtKeyUsageAny {
+			return true
+		}
+		for _, want := range usages {
+			if have == want || want == x509.ExtKeyUsageAny {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// explainVerifyError adds the issue described by an error returned by
+// x509 when verifying the leaf.
+func explainVerifyError(e *ChainExplanation, leaf *x509.Certificate, now time.Time, err error) {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		invalid          x509.CertificateInvalidError
+		hostname         x509.HostnameError
+	)
+	switch {
+	case errors.As(err, &unknownAuthority):
+		c := leaf
+		if unknownAuthority.Cert != nil {
+			c = unknownAuthority.Cert
+		}
+		e.add(ChainUnknownAuthority, c, "issuer %q is not trusted", c.Issuer.String())
+	case errors.As(err, &invalid):
+		c := leaf
+		if invalid.Cert != nil {
+			c = invalid.Cert
+		}
+		switch invalid.Reason {
+		case x509.Expired:
+			// chains are verified at a time the leaf is valid, so issuers
+			// which are valid now, but weren't then, are not a problem
+			switch {
+			case now.Before(c.NotBefore):
+				e.add(ChainNotYetValid, c, "not valid until %s", c.NotBefore.Format(time.RFC3339))
+			case now.After(c.NotAfter):
+				e.add(ChainExpired, c, "expired at %s", c.NotAfter.Format(time.RFC3339))
+			}
+		case x509.IncompatibleUsage, x509.CANotAuthorizedForExtKeyUsage:
+			e.add(ChainWrongEKU, c, "%s", invalid.Error())
+		case x509.CANotAuthorizedForThisName:
+			e.add(ChainNameConstraint, c, "%s", invalid.Error())
+		case x509.NotAuthorizedToSign:
+			e.add(ChainNotAuthorized, c, "%s", invalid.Error())
+		default:
+			e.add(ChainOther, c, "%s", invalid.Error())
+		}
+	case errors.As(err, &hostname):
+		e.add(ChainHostnameMismatch, leaf, "%s", hostname.Error())
+	default:
+		e.add(ChainOther, leaf, "%s", err)
+	}
+}
@@ -0,0 +1,112 @@
+package cert
+
+import (
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+)
+
+// WithExtension adds an extension with the given OID and DER encoded
+// value. Peers using crypto/x509 reject certs with critical extensions
+// they don't handle, so custom extensions should be non-critical.
+func WithExtension(oid asn1.ObjectIdentifier, critical bool, value []byte) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.ExtraExtensions = append(o.cert.ExtraExtensions, pkix.Extension{
+			Id:       oid,
+			Critical: critical,
+			Value:    value,
+		})
+		return nil
+	}
+}
+
+// WithExtensionValue adds an extension with the given OID, whose value
+// is the ASN.1 encoding of v, such as a string or an int.
+func WithExtensionValue(oid asn1.ObjectIdentifier, critical bool, v interface{}) CertOption {
+	return func(o *CertOptions) error {
+		value, err := asn1.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to encode extension %s: %w", oid, err)
+		}
+		return WithExtension(oid, critical, value)(o)
+	}
+}
+
+// WithSubjectKeyID sets the subject key identifier, instead of the one
+// computed from the public key.
+func WithSubjectKeyID(id []byte) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.SubjectKeyId = id
+		return nil
+	}
+}
+
+// KeyID computes the key identifier of a public key, which is the SHA-1
+// hash of its subjectPublicKey bit string (RFC 5280, section 4.2.1.2).
+func KeyID(pub interface{}) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	var spki struct {
+		Algorithm        pkix.AlgorithmIdentifier
+		SubjectPublicKey asn1.BitString
+	}
+	_, err = asn1.Unmarshal(der, &spki)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum(spki.SubjectPublicKey.Bytes)
+	return sum[:], nil
+}
+
+// setKeyIDs computes the subject key identifier of the cert, unless it
+// was given, and the authority key identifier from its parent's key when
+// the parent has no subject key identifier.
+func setKeyIDs(cert *x509.Certificate, pub interface{}, parent *x509.Certificate) error {
+	if len(cert.SubjectKeyId) == 0 {
+		id, err := KeyID(pub)
+		if err != nil {
+			return err
+		}
+		cert.SubjectKeyId = id
+	}
+
+	if parent != nil && len(parent.SubjectKeyId) == 0 {
+		id, err := KeyID(parent.PublicKey)
+		if err != nil {
+			return err
+		}
+		cert.AuthorityKeyId = id
+	}
+	return nil
+}
+
+// FindExtension returns the extension of the cert with the given OID.
+func FindExtension(c *x509.Certificate, oid asn1.ObjectIdentifier) (pkix.Extension, bool) {
+	for _, ext := range c.Extensions {
+		if ext.Id.Equal(oid) {
+			return ext, true
+		}
+	}
+	return pkix.Extension{}, false
+}
+
+// ExtensionValue decodes the ASN.1 value of the cert's extension with the
+// given OID into v, reporting whether the extension was found.
+func ExtensionValue(c *x509.Certificate, oid asn1.ObjectIdentifier, v interface{}) (bool, error) {
+	ext, ok := FindExtension(c, oid)
+	if !ok {
+		return false, nil
+	}
+	rest, err := asn1.Unmarshal(ext.Value, v)
+	if err != nil {
+		return true, fmt.Errorf("failed to decode extension %s: %w", oid, err)
+	}
+	if len(rest) > 0 {
+		return true, fmt.Errorf("trailing data after extension %s", oid)
+	}
+	return true, nil
+}
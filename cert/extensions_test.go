@@ -0,0 +1,79 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"testing"
+)
+
+func parseCertPEM(t *testing.T, certPEM []byte) *x509.Certificate {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		t.Fatal("no cert found")
+	}
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSubjectAndExtensions(t *testing.T) {
+	caPEM, caPrivKeyPEM, err := NewCA(WithCommonName("ca"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roleOID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 2}
+
+	certPEM, _, err := NewClientFromCA(
+		bytes.NewReader(caPrivKeyPEM),
+		bytes.NewReader(caPEM),
+		WithOrganization("Example"),
+		WithOrganizationalUnit("payments"),
+		WithCountry("US"),
+		WithLocality("Springfield"),
+		WithCommonName("client"),
+		WithExtensionValue(roleOID, true, "deployer"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := parseCertPEM(t, certPEM)
+
+	if c.Subject.CommonName != "client" || len(c.Subject.Organization) != 1 || c.Subject.OrganizationalUnit[0] != "payments" ||
+		c.Subject.Country[0] != "US" || c.Subject.Locality[0] != "Springfield" {
+		t.Fatalf("unexpected subject %q", c.Subject)
+	}
+
+	var role string
+	found, err := ExtensionValue(c, roleOID, &role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || role != "deployer" {
+		t.Fatalf("unexpected extension value %q", role)
+	}
+	if ext, _ := FindExtension(c, roleOID); !ext.Critical {
+		t.Fatal("expected a critical extension")
+	}
+
+	found, err = ExtensionValue(c, asn1.ObjectIdentifier{1, 2, 3}, &role)
+	if found || err != nil {
+		t.Fatalf("unexpected result for missing extension: %v %v", found, err)
+	}
+
+	ca := parseCertPEM(t, caPEM)
+	ski, err := KeyID(c.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c.SubjectKeyId, ski) {
+		t.Fatalf("unexpected subject key id %x, expected %x", c.SubjectKeyId, ski)
+	}
+	if len(ca.SubjectKeyId) == 0 || !bytes.Equal(c.AuthorityKeyId, ca.SubjectKeyId) {
+		t.Fatalf("authority key id %x does not match CA subject key id %x", c.AuthorityKeyId, ca.SubjectKeyId)
+	}
+}
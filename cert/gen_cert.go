@@ -28,7 +28,11 @@ func baseCert() (*x509.Certificate, error) {
 	}, nil
 }
 
-// New generates a PEM encoded x509 cert and private key.
+// New generates a PEM encoded x509 cert and private key. Certs with a
+// parent are signed by the parent, otherwise they are self signed.
+//
+// When only a public key is given using WithPublicKey, the returned
+// private key is nil.
 func New(opts ...CertOption) ([]byte, []byte, error) {
 	bc, err := baseCert()
 	if err != nil {
@@ -58,17 +62,47 @@ func New(opts ...CertOption) ([]byte, []byte, error) {
 	case *rsa.PrivateKey:
 		pubKey = &k.PublicKey
 		privKey = k
+	case nil:
+		if cerOpts.publicKey == nil {
+			return nil, nil, fmt.Errorf("no key given")
+		}
+		pubKey = cerOpts.publicKey
 	default:
 		return nil, nil, fmt.Errorf("%T key type not implemented (probably missing)", k)
 	}
 
 	cert := cerOpts.cert
 
+	err = setKeyIDs(cert, pubKey, cerOpts.parent.cert)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cerOpts.profile != nil {
+		err = checkProfile(cerOpts.profile, cert, pubKey)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	var certBytes []byte
 
-	if cert.IsCA { // self sign
+	if cerOpts.parent.cert == nil { // self sign
+		if privKey == nil {
+			return nil, nil, fmt.Errorf("a private key is required to self sign")
+		}
 		certBytes, err = x509.CreateCertificate(rand.Reader, cert, cert, pubKey, privKey)
 	} else { // sign with parent cert
+		err = checkNameConstraints(cerOpts.parent.cert, cert)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cert.IsCA {
+			err = checkCAConstraints(cerOpts.parent.cert, cert)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
 		certBytes, err = x509.CreateCertificate(rand.Reader, cert, cerOpts.parent.cert, pubKey, cerOpts.parent.key)
 	}
 
@@ -76,6 +110,21 @@ func New(opts ...CertOption) ([]byte, []byte, error) {
 		return nil, nil, err
 	}
 
+	recorder := cerOpts.recorder
+	if recorder == nil {
+		recorder = getDefaultRecorder()
+	}
+	if recorder != nil {
+		issued, err := x509.ParseCertificate(certBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = recorder.RecordCertificate(issued, cerOpts.requester)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to record issued cert: %w", err)
+		}
+	}
+
 	certPEMBuffer := new(bytes.Buffer)
 	err = pem.Encode(certPEMBuffer, &pem.Block{
 		Type:  "CERTIFICATE",
@@ -85,6 +134,10 @@ func New(opts ...CertOption) ([]byte, []byte, error) {
 		return nil, nil, err
 	}
 
+	if privKey == nil {
+		return certPEMBuffer.Bytes(), nil, nil
+	}
+
 	b, err := x509.MarshalPKCS8PrivateKey(privKey)
 	if err != nil {
 		return nil, nil, err
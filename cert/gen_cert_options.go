@@ -7,6 +7,8 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"net"
+	"net/url"
 	"time"
 )
 
@@ -15,8 +17,12 @@ type CertOptions struct {
 		key  interface{}
 		cert *x509.Certificate
 	}
-	key  interface{}
-	cert *x509.Certificate
+	key       interface{}
+	publicKey interface{}
+	cert      *x509.Certificate
+	recorder  Recorder
+	requester string
+	profile   *Profile
 }
 
 type CertOption func(*CertOptions) error
@@ -32,6 +38,17 @@ func WithParent(cert *x509.Certificate, key interface{}) CertOption {
 func WithKey(key interface{}) CertOption {
 	return func(o *CertOptions) error {
 		o.key = key
+		o.publicKey = nil
+		return nil
+	}
+}
+
+// WithPublicKey issues the cert for the given public key, such as one
+// from a certificate signing request, instead of a private key.
+func WithPublicKey(pub interface{}) CertOption {
+	return func(o *CertOptions) error {
+		o.key = nil
+		o.publicKey = pub
 		return nil
 	}
 }
@@ -43,6 +60,7 @@ func WithNewECDSAKey() CertOption {
 			return err
 		}
 		o.key = privKey
+		o.publicKey = nil
 		return nil
 	}
 }
@@ -54,6 +72,7 @@ func WithNewRSAKey() CertOption {
 			return err
 		}
 		o.key = privKey
+		o.publicKey = nil
 		return nil
 	}
 }
@@ -87,17 +106,115 @@ func IsClient() CertOption {
 
 func IsValidFor(d time.Duration) CertOption {
 	return func(o *CertOptions) error {
-		o.cert.NotBefore = time.Now()
-		o.cert.NotAfter = time.Now().Add(d)
+		now := time.Now()
+		o.cert.NotBefore = now
+		o.cert.NotAfter = now.Add(d)
 		return nil
 	}
 }
 
+// WithCommonName sets the subject common name, keeping any other
+// subject attributes.
 func WithCommonName(name string) CertOption {
 	return func(o *CertOptions) error {
-		o.cert.Subject = pkix.Name{
-			CommonName: name,
-		}
+		o.cert.Subject.CommonName = name
+		return nil
+	}
+}
+
+// WithSubject replaces the entire subject.
+func WithSubject(name pkix.Name) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.Subject = name
+		return nil
+	}
+}
+
+// WithOrganization adds the given subject organizations (O).
+func WithOrganization(orgs ...string) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.Subject.Organization = append(o.cert.Subject.Organization, orgs...)
+		return nil
+	}
+}
+
+// WithOrganizationalUnit adds the given subject organizational units (OU).
+func WithOrganizationalUnit(units ...string) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.Subject.OrganizationalUnit = append(o.cert.Subject.OrganizationalUnit, units...)
+		return nil
+	}
+}
+
+// WithCountry adds the given subject countries (C).
+func WithCountry(countries ...string) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.Subject.Country = append(o.cert.Subject.Country, countries...)
+		return nil
+	}
+}
+
+// WithProvince adds the given subject states or provinces (ST).
+func WithProvince(provinces ...string) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.Subject.Province = append(o.cert.Subject.Province, provinces...)
+		return nil
+	}
+}
+
+// WithLocality adds the given subject localities (L).
+func WithLocality(localities ...string) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.Subject.Locality = append(o.cert.Subject.Locality, localities...)
+		return nil
+	}
+}
+
+// WithStreetAddress adds the given subject street addresses.
+func WithStreetAddress(addresses ...string) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.Subject.StreetAddress = append(o.cert.Subject.StreetAddress, addresses...)
+		return nil
+	}
+}
+
+// WithPostalCode adds the given subject postal codes.
+func WithPostalCode(codes ...string) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.Subject.PostalCode = append(o.cert.Subject.PostalCode, codes...)
+		return nil
+	}
+}
+
+// WithDNSNames adds the given DNS subject alternative names.
+func WithDNSNames(names ...string) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.DNSNames = append(o.cert.DNSNames, names...)
+		return nil
+	}
+}
+
+// WithIPAddresses adds the given IP address subject alternative names.
+func WithIPAddresses(ips ...net.IP) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.IPAddresses = append(o.cert.IPAddresses, ips...)
+		return nil
+	}
+}
+
+// WithURIs adds the given URI subject alternative names, such as
+// SPIFFE IDs.
+func WithURIs(uris ...*url.URL) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.URIs = append(o.cert.URIs, uris...)
+		return nil
+	}
+}
+
+// WithEmailAddresses adds the given email subject alternative names.
+func WithEmailAddresses(emails ...string) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.EmailAddresses = append(o.cert.EmailAddresses, emails...)
 		return nil
 	}
 }
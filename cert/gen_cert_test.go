@@ -0,0 +1,60 @@
+package cert
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNewSignsWithParent(t *testing.T) {
+	caPEM, caPrivKeyPEM, err := NewCA(WithCommonName("ca"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, caPrivKey, err := ReadCertAndKey(bytes.NewReader(caPEM), bytes.NewReader(caPrivKeyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a CA cert with a parent is signed by the parent, not self signed
+	intermediatePEM, _, err := New(IsCA(), WithNewECDSAKey(), WithCommonName("intermediate"), WithParent(caCert, caPrivKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate, err := ParseCertificates(intermediatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := intermediate[0].CheckSignatureFrom(caCert); err != nil {
+		t.Fatalf("expected intermediate to be signed by the CA: %v", err)
+	}
+
+	// a cert without a parent is self signed, even if it isn't a CA
+	leafPEM, _, err := New(WithNewECDSAKey(), WithCommonName("leaf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := ParseCertificates(leafPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf[0].Issuer.CommonName != "leaf" {
+		t.Fatalf("expected leaf to be self signed, got issuer %q", leaf[0].Issuer.CommonName)
+	}
+
+	// self signing needs the cert's own private key
+	_, _, err = New(WithPublicKey(caCert.PublicKey), WithCommonName("public-key-only"))
+	if err == nil {
+		t.Fatal("expected an error self signing without a private key")
+	}
+	publicKeyOnlyPEM, _, err := New(WithPublicKey(caCert.PublicKey), WithCommonName("public-key-only"), WithParent(caCert, caPrivKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyOnly, err := ParseCertificates(publicKeyOnlyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := publicKeyOnly[0].CheckSignatureFrom(caCert); err != nil {
+		t.Fatalf("expected a cert with only a public key to be signed by the CA: %v", err)
+	}
+}
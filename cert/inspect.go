@@ -0,0 +1,166 @@
+package cert
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Info is a structured description of a certificate.
+type Info struct {
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	SerialNumber       string    `json:"serial_number"`
+	DNSNames           []string  `json:"dns_names,omitempty"`
+	IPAddresses        []string  `json:"ip_addresses,omitempty"`
+	URIs               []string  `json:"uris,omitempty"`
+	EmailAddresses     []string  `json:"email_addresses,omitempty"`
+	KeyType            string    `json:"key_type"`
+	KeySize            int       `json:"key_size"`
+	IsCA               bool      `json:"is_ca"`
+	KeyUsages          []string  `json:"key_usages,omitempty"`
+	ExtKeyUsages       []string  `json:"ext_key_usages,omitempty"`
+	NotBefore          time.Time `json:"not_before"`
+	NotAfter           time.Time `json:"not_after"`
+	SignatureAlgorithm string    `json:"signature_algorithm"`
+	SubjectKeyID       string    `json:"subject_key_id,omitempty"`
+	AuthorityKeyID     string    `json:"authority_key_id,omitempty"`
+	SPKIPin            string    `json:"spki_pin"`
+	Fingerprint        string    `json:"sha256_fingerprint"`
+}
+
+// ParseCertificates parses every certificate in a PEM bundle, in order.
+func ParseCertificates(certsPEM []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for len(certsPEM) > 0 {
+		var block *pem.Block
+		block, certsPEM = pem.Decode(certsPEM)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cert %d: %w", len(certs)+1, err)
+		}
+		certs = append(certs, c)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no cert found")
+	}
+	return certs, nil
+}
+
+// Inspect describes every certificate in a PEM bundle, in order.
+func Inspect(certsPEM []byte) ([]*Info, error) {
+	certs, err := ParseCertificates(certsPEM)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*Info, 0, len(certs))
+	for _, c := range certs {
+		infos = append(infos, InspectCertificate(c))
+	}
+	return infos, nil
+}
+
+// InspectCertificate describes a parsed certificate.
+func InspectCertificate(c *x509.Certificate) *Info {
+	fingerprint := sha256.Sum256(c.Raw)
+
+	info := &Info{
+		Subject:            c.Subject.String(),
+		Issuer:             c.Issuer.String(),
+		SerialNumber:       fmt.Sprintf("%x", c.SerialNumber),
+		DNSNames:           c.DNSNames,
+		EmailAddresses:     c.EmailAddresses,
+		IsCA:               c.IsCA,
+		NotBefore:          c.NotBefore,
+		NotAfter:           c.NotAfter,
+		SignatureAlgorithm: c.SignatureAlgorithm.String(),
+		SubjectKeyID:       hex.EncodeToString(c.SubjectKeyId),
+		AuthorityKeyID:     hex.EncodeToString(c.AuthorityKeyId),
+		SPKIPin:            SPKIPin(c),
+		Fingerprint:        hex.EncodeToString(fingerprint[:]),
+	}
+	for _, ip := range c.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	for _, uri := range c.URIs {
+		info.URIs = append(info.URIs, uri.String())
+	}
+
+	switch k := c.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		info.KeyType, info.KeySize = "ECDSA", k.Curve.Params().BitSize
+	case *rsa.PublicKey:
+		info.KeyType, info.KeySize = "RSA", k.N.BitLen()
+	case ed25519.PublicKey:
+		info.KeyType, info.KeySize = "Ed25519", 256
+	default:
+		info.KeyType = fmt.Sprintf("%T", k)
+	}
+
+	for name, ku := range keyUsageNames {
+		if c.KeyUsage&ku != 0 {
+			info.KeyUsages = append(info.KeyUsages, name)
+		}
+	}
+	sort.Strings(info.KeyUsages)
+	info.ExtKeyUsages = extKeyUsageStrings(c.ExtKeyUsage)
+
+	return info
+}
+
+func extKeyUsageStrings(usages []x509.ExtKeyUsage) []string {
+	var names []string
+	for _, eku := range usages {
+		name := fmt.Sprintf("unknown(%d)", eku)
+		for n, u := range extKeyUsageNames {
+			if u == eku {
+				name = n
+			}
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// String formats the description as human readable text.
+func (i *Info) String() string {
+	var b strings.Builder
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%-20s %s\n", name+":", value)
+		}
+	}
+	field("Subject", i.Subject)
+	field("Issuer", i.Issuer)
+	field("Serial Number", i.SerialNumber)
+	field("DNS Names", strings.Join(i.DNSNames, ", "))
+	field("IP Addresses", strings.Join(i.IPAddresses, ", "))
+	field("URIs", strings.Join(i.URIs, ", "))
+	field("Email Addresses", strings.Join(i.EmailAddresses, ", "))
+	field("Key", fmt.Sprintf("%s %d", i.KeyType, i.KeySize))
+	field("CA", fmt.Sprintf("%t", i.IsCA))
+	field("Key Usages", strings.Join(i.KeyUsages, ", "))
+	field("Ext Key Usages", strings.Join(i.ExtKeyUsages, ", "))
+	field("Not Before", i.NotBefore.Format(time.RFC3339))
+	field("Not After", i.NotAfter.Format(time.RFC3339))
+	field("Signature", i.SignatureAlgorithm)
+	field("Subject Key ID", i.SubjectKeyID)
+	field("Authority Key ID", i.AuthorityKeyID)
+	field("SPKI Pin", "sha256/"+i.SPKIPin)
+	field("SHA-256 Fingerprint", i.Fingerprint)
+	return b.String()
+}
@@ -0,0 +1,223 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestInspect(t *testing.T) {
+	caPEM, caPrivKeyPEM, err := NewCA(WithCommonName("ca"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverPEM, _, err := NewServerFromCA(
+		bytes.NewReader(caPrivKeyPEM),
+		bytes.NewReader(caPEM),
+		WithCommonName("server"),
+		WithDNSNames("server.internal"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := Inspect(append(serverPEM, caPEM...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 certs, got %d", len(infos))
+	}
+
+	server := infos[0]
+	if server.Subject != "CN=server" || server.Issuer != "CN=ca" || server.IsCA {
+		t.Fatalf("unexpected subject %q, issuer %q or CA %t", server.Subject, server.Issuer, server.IsCA)
+	}
+	if len(server.DNSNames) != 1 || server.KeyType != "ECDSA" || server.KeySize != 256 {
+		t.Fatalf("unexpected SANs %v or key %s %d", server.DNSNames, server.KeyType, server.KeySize)
+	}
+	if len(server.ExtKeyUsages) != 1 || server.ExtKeyUsages[0] != "server_auth" || server.KeyUsages[0] != "digital_signature" {
+		t.Fatalf("unexpected usages %v %v", server.KeyUsages, server.ExtKeyUsages)
+	}
+	pin, _ := SPKIPinFromPEM(serverPEM)
+	if server.SPKIPin != pin || len(server.Fingerprint) != 64 {
+		t.Fatalf("unexpected pin %q or fingerprint %q", server.SPKIPin, server.Fingerprint)
+	}
+	if !infos[1].IsCA {
+		t.Fatal("expected the second cert to be the CA")
+	}
+
+	b, err := json.Marshal(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Info
+	err = json.Unmarshal(b, &decoded)
+	if err != nil || decoded.SPKIPin != server.SPKIPin {
+		t.Fatalf("unexpected JSON round trip %s: %v", b, err)
+	}
+
+	_, err = Inspect([]byte("not a cert"))
+	if err == nil {
+		t.Fatal("expected an error without certs")
+	}
+}
+
+// testCert creates a cert signed by parent, or self signed if parent is
+// nil, without any of the checks New does.
+func testCert(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.BasicConstraintsValid = true
+	if template.NotAfter.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+		template.NotAfter = time.Now().Add(time.Hour)
+	}
+	if template.IsCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, key
+}
+
+func TestExplainChain(t *testing.T) {
+	root, rootKey := testCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "root"}, IsCA: true}, nil, nil)
+	otherRoot, _ := testCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "other"}, IsCA: true}, nil, nil)
+	intermediate, intermediateKey := testCert(t, &x509.Certificate{
+		Subject:             pkix.Name{CommonName: "intermediate"},
+		IsCA:                true,
+		PermittedDNSDomains: []string{"team-a.internal"},
+	}, root, rootKey)
+	expiredIntermediate, expiredIntermediateKey := testCert(t, &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "expired-intermediate"},
+		IsCA:      true,
+		NotBefore: time.Now().Add(-48 * time.Hour),
+		NotAfter:  time.Now().Add(-24 * time.Hour),
+	}, root, rootKey)
+
+	leaf := func(parent *x509.Certificate, parentKey *ecdsa.PrivateKey, template *x509.Certificate) *x509.Certificate {
+		template.Subject = pkix.Name{CommonName: "leaf"}
+		if template.ExtKeyUsage == nil {
+			template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		}
+		c, _ := testCert(t, template, parent, parentKey)
+		return c
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(intermediate)
+	intermediates.AddCert(expiredIntermediate)
+
+	tests := map[string]struct {
+		leaf    *x509.Certificate
+		roots   *x509.CertPool
+		opts    []ExplainOption
+		reasons []ChainReason
+	}{
+		"valid": {
+			leaf: leaf(intermediate, intermediateKey, &x509.Certificate{DNSNames: []string{"web.team-a.internal"}}),
+			opts: []ExplainOption{ForDNSName("web.team-a.internal")},
+		},
+		"expired": {
+			leaf: leaf(intermediate, intermediateKey, &x509.Certificate{
+				DNSNames:  []string{"web.team-a.internal"},
+				NotBefore: time.Now().Add(-48 * time.Hour),
+				NotAfter:  time.Now().Add(-24 * time.Hour),
+			}),
+			reasons: []ChainReason{ChainExpired},
+		},
+		"wrong EKU": {
+			leaf: leaf(intermediate, intermediateKey, &x509.Certificate{
+				DNSNames:    []string{"web.team-a.internal"},
+				ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			}),
+			reasons: []ChainReason{ChainWrongEKU},
+		},
+		"unknown authority": {
+			leaf:    leaf(intermediate, intermediateKey, &x509.Certificate{DNSNames: []string{"web.team-a.internal"}}),
+			roots:   func() *x509.CertPool { p := x509.NewCertPool(); p.AddCert(otherRoot); return p }(),
+			reasons: []ChainReason{ChainUnknownAuthority},
+		},
+		"name constraint": {
+			leaf:    leaf(intermediate, intermediateKey, &x509.Certificate{DNSNames: []string{"web.team-b.internal"}}),
+			reasons: []ChainReason{ChainNameConstraint},
+		},
+		"hostname mismatch": {
+			leaf:    leaf(intermediate, intermediateKey, &x509.Certificate{DNSNames: []string{"web.team-a.internal"}}),
+			opts:    []ExplainOption{ForDNSName("db.team-a.internal")},
+			reasons: []ChainReason{ChainHostnameMismatch},
+		},
+		"expired intermediate": {
+			leaf: leaf(expiredIntermediate, expiredIntermediateKey, &x509.Certificate{
+				DNSNames:  []string{"web.internal"},
+				NotBefore: time.Now().Add(-time.Hour),
+				NotAfter:  time.Now().Add(time.Hour),
+			}),
+			reasons: []ChainReason{ChainExpired},
+		},
+		"several problems": {
+			leaf: leaf(intermediate, intermediateKey, &x509.Certificate{
+				DNSNames:    []string{"web.team-a.internal"},
+				ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+				NotBefore:   time.Now().Add(-48 * time.Hour),
+				NotAfter:    time.Now().Add(-24 * time.Hour),
+			}),
+			opts:    []ExplainOption{ForDNSName("db.team-a.internal")},
+			reasons: []ChainReason{ChainExpired, ChainWrongEKU, ChainHostnameMismatch},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			pool := roots
+			if test.roots != nil {
+				pool = test.roots
+			}
+			e := ExplainChain(test.leaf, pool, append([]ExplainOption{WithIntermediates(intermediates)}, test.opts...)...)
+
+			if len(test.reasons) == 0 {
+				if !e.Valid || len(e.Chains) == 0 {
+					t.Fatalf("expected a valid chain, got %s", e)
+				}
+				return
+			}
+			if e.Valid {
+				t.Fatal("expected an invalid chain")
+			}
+			var reasons []ChainReason
+			for _, issue := range e.Issues {
+				reasons = append(reasons, issue.Reason)
+			}
+			if len(reasons) != len(test.reasons) {
+				t.Fatalf("expected reasons %v, got %v", test.reasons, reasons)
+			}
+			for i := range reasons {
+				if reasons[i] != test.reasons[i] {
+					t.Fatalf("expected reasons %v, got %v", test.reasons, reasons)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package cert
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+)
+
+// SPKIPin returns the base64 encoded SHA-256 hash of the certificate's
+// DER encoded SubjectPublicKeyInfo, which stays the same when a cert is
+// re-issued for the same key.
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// SPKIPinFromPEM returns the SPKI pin of the first certificate in the
+// given PEM encoded bytes.
+func SPKIPinFromPEM(certPEM []byte) (string, error) {
+	for len(certPEM) > 0 {
+		var block *pem.Block
+		block, certPEM = pem.Decode(certPEM)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return "", err
+		}
+		return SPKIPin(cert), nil
+	}
+	return "", fmt.Errorf("no cert found")
+}
@@ -0,0 +1,40 @@
+package cert
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSPKIPinFromPEM(t *testing.T) {
+	caPEM, caPrivKeyPEM, err := NewCA(WithCommonName("ca"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pin, err := SPKIPinFromPEM(caPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverPEM, _, err := NewServerFromCA(
+		bytes.NewReader(caPrivKeyPEM),
+		bytes.NewReader(caPEM),
+		WithCommonName("server"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverPin, err := SPKIPinFromPEM(serverPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serverPin == pin {
+		t.Fatal("expected server and CA pins to differ")
+	}
+
+	_, err = SPKIPinFromPEM([]byte("not a PEM file"))
+	if err == nil {
+		t.Fatal("expected error for missing cert")
+	}
+}
@@ -0,0 +1,213 @@
+package cert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SANType is a type of subject alternative name.
+type SANType string
+
+const (
+	SANTypeDNS   SANType = "dns"
+	SANTypeIP    SANType = "ip"
+	SANTypeURI   SANType = "uri"
+	SANTypeEmail SANType = "email"
+)
+
+// KeyAlgorithm is the algorithm and size of a cert's key.
+type KeyAlgorithm string
+
+const (
+	KeyAlgorithmECDSAP256 KeyAlgorithm = "ecdsa-p256"
+	KeyAlgorithmECDSAP384 KeyAlgorithm = "ecdsa-p384"
+	KeyAlgorithmRSA2048   KeyAlgorithm = "rsa-2048"
+	KeyAlgorithmRSA4096   KeyAlgorithm = "rsa-4096"
+)
+
+// Profile is a named set of key usages, lifetime, SAN and key
+// requirements that are applied together when issuing a cert.
+type Profile struct {
+	Name            string
+	IsCA            bool
+	KeyUsage        x509.KeyUsage
+	ExtKeyUsage     []x509.ExtKeyUsage
+	MaxLifetime     time.Duration
+	RequiredSANs    []SANType
+	KeyAlgorithm    KeyAlgorithm
+	ExtraExtensions []pkix.Extension
+}
+
+// WebServerProfile is for TLS servers reached by DNS name.
+var WebServerProfile = Profile{
+	Name:         "web-server",
+	KeyUsage:     x509.KeyUsageDigitalSignature,
+	ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	MaxLifetime:  90 * 24 * time.Hour,
+	RequiredSANs: []SANType{SANTypeDNS},
+	KeyAlgorithm: KeyAlgorithmECDSAP256,
+}
+
+// ServiceClientProfile is for services authenticating as mTLS clients.
+var ServiceClientProfile = Profile{
+	Name:         "service-client",
+	KeyUsage:     x509.KeyUsageDigitalSignature,
+	ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	MaxLifetime:  30 * 24 * time.Hour,
+	KeyAlgorithm: KeyAlgorithmECDSAP256,
+}
+
+// CodeSigningProfile is for signing code and artifacts.
+var CodeSigningProfile = Profile{
+	Name:         "code-signing",
+	KeyUsage:     x509.KeyUsageDigitalSignature,
+	ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	MaxLifetime:  365 * 24 * time.Hour,
+	KeyAlgorithm: KeyAlgorithmECDSAP256,
+}
+
+// DualUseProfile is for services acting as both mTLS clients and
+// servers.
+var DualUseProfile = Profile{
+	Name:         "dual-use",
+	KeyUsage:     x509.KeyUsageDigitalSignature,
+	ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	MaxLifetime:  90 * 24 * time.Hour,
+	KeyAlgorithm: KeyAlgorithmECDSAP256,
+}
+
+// Profiles contains each built-in Profile by name.
+var Profiles = map[string]Profile{
+	WebServerProfile.Name:     WebServerProfile,
+	ServiceClientProfile.Name: ServiceClientProfile,
+	CodeSigningProfile.Name:   CodeSigningProfile,
+	DualUseProfile.Name:       DualUseProfile,
+}
+
+// ProfileByName returns the built-in Profile with the given name.
+func ProfileByName(name string) (Profile, error) {
+	p, ok := Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown cert profile %q", name)
+	}
+	return p, nil
+}
+
+// ProfileError is returned when a cert doesn't meet the requirements of
+// the profile it is issued with.
+type ProfileError struct {
+	Profile string
+	Reason  string
+}
+
+func (e *ProfileError) Error() string {
+	return fmt.Sprintf("cert does not meet the requirements of profile %q: %s", e.Profile, e.Reason)
+}
+
+// WithProfile applies the profile's key usages and extensions. Its
+// lifetime, SAN and key requirements are checked before signing.
+func WithProfile(p Profile) CertOption {
+	return func(o *CertOptions) error {
+		o.cert.IsCA = p.IsCA
+		o.cert.KeyUsage = p.KeyUsage
+		o.cert.ExtKeyUsage = append([]x509.ExtKeyUsage{}, p.ExtKeyUsage...)
+		o.cert.ExtraExtensions = append(o.cert.ExtraExtensions, p.ExtraExtensions...)
+		o.profile = &p
+		return nil
+	}
+}
+
+// newKey generates a private key using the given algorithm.
+func newKey(alg KeyAlgorithm) (interface{}, error) {
+	switch alg {
+	case KeyAlgorithmECDSAP256, "":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyAlgorithmECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyAlgorithmRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case KeyAlgorithmRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	default:
+		return nil, fmt.Errorf("unknown key algorithm %q", alg)
+	}
+}
+
+// keyAlgorithm returns the KeyAlgorithm of a public key.
+func keyAlgorithm(pub interface{}) KeyAlgorithm {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		return KeyAlgorithm(fmt.Sprintf("ecdsa-p%d", k.Curve.Params().BitSize))
+	case *rsa.PublicKey:
+		return KeyAlgorithm(fmt.Sprintf("rsa-%d", k.N.BitLen()))
+	default:
+		return KeyAlgorithm(fmt.Sprintf("%T", pub))
+	}
+}
+
+// checkProfile checks the cert and its public key meet the profile's
+// requirements.
+func checkProfile(p *Profile, cert *x509.Certificate, pub interface{}) error {
+	if p.MaxLifetime > 0 && cert.NotAfter.Sub(cert.NotBefore) > p.MaxLifetime {
+		return &ProfileError{Profile: p.Name, Reason: fmt.Sprintf("lifetime %v exceeds the maximum of %v", cert.NotAfter.Sub(cert.NotBefore).Round(time.Second), p.MaxLifetime)}
+	}
+
+	for _, san := range p.RequiredSANs {
+		var found bool
+		switch san {
+		case SANTypeDNS:
+			found = len(cert.DNSNames) > 0
+		case SANTypeIP:
+			found = len(cert.IPAddresses) > 0
+		case SANTypeURI:
+			found = len(cert.URIs) > 0
+		case SANTypeEmail:
+			found = len(cert.EmailAddresses) > 0
+		}
+		if !found {
+			return &ProfileError{Profile: p.Name, Reason: fmt.Sprintf("a %s SAN is required", san)}
+		}
+	}
+
+	if p.KeyAlgorithm != "" {
+		if alg := keyAlgorithm(pub); alg != p.KeyAlgorithm {
+			return &ProfileError{Profile: p.Name, Reason: fmt.Sprintf("key algorithm %s is not %s", alg, p.KeyAlgorithm)}
+		}
+	}
+
+	return nil
+}
+
+// NewFromProfile generates a PEM encoded x509 cert and private key using
+// the given profile, signed by the given CA. The key is generated using
+// the profile's key algorithm, and the profile's maximum lifetime is used
+// unless IsValidFor is given.
+func NewFromProfile(caPrivKeyPEM, caCertPEM io.Reader, p Profile, opts ...CertOption) ([]byte, []byte, error) {
+	key, err := newKey(p.KeyAlgorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	allOpts := []CertOption{WithKey(key)}
+	if p.MaxLifetime > 0 {
+		allOpts = append(allOpts, IsValidFor(p.MaxLifetime))
+	}
+	allOpts = append(allOpts, opts...)
+	allOpts = append(allOpts, WithProfile(p))
+
+	// Decode CA cert and private key from PEM encoded io.Reader bytes
+	caCert, caPrivKey, err := ReadCertAndKey(caCertPEM, caPrivKeyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	allOpts = append(allOpts, WithParent(caCert, caPrivKey))
+
+	return New(allOpts...)
+}
@@ -0,0 +1,194 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProfilesConfig is the YAML or JSON representation of issuance
+// profiles, keyed by name:
+//
+//	profiles:
+//	  web-server:
+//	    key_usages: [digital_signature]
+//	    ext_key_usages: [server_auth]
+//	    max_lifetime: 720h
+//	    required_sans: [dns]
+//	    key_algorithm: ecdsa-p256
+type ProfilesConfig struct {
+	Profiles map[string]ProfileConfig `yaml:"profiles" json:"profiles"`
+}
+
+// ProfileConfig is the YAML or JSON representation of a Profile.
+type ProfileConfig struct {
+	IsCA         bool              `yaml:"is_ca" json:"is_ca"`
+	KeyUsages    []string          `yaml:"key_usages" json:"key_usages"`
+	ExtKeyUsages []string          `yaml:"ext_key_usages" json:"ext_key_usages"`
+	MaxLifetime  string            `yaml:"max_lifetime" json:"max_lifetime"`
+	RequiredSANs []string          `yaml:"required_sans" json:"required_sans"`
+	KeyAlgorithm string            `yaml:"key_algorithm" json:"key_algorithm"`
+	Extensions   []ExtensionConfig `yaml:"extensions" json:"extensions"`
+}
+
+// ExtensionConfig is a custom extension, with its DER encoded value in
+// base64.
+type ExtensionConfig struct {
+	OID      string `yaml:"oid" json:"oid"`
+	Critical bool   `yaml:"critical" json:"critical"`
+	Value    string `yaml:"value" json:"value"`
+}
+
+var keyUsageNames = map[string]x509.KeyUsage{
+	"digital_signature":  x509.KeyUsageDigitalSignature,
+	"content_commitment": x509.KeyUsageContentCommitment,
+	"key_encipherment":   x509.KeyUsageKeyEncipherment,
+	"data_encipherment":  x509.KeyUsageDataEncipherment,
+	"key_agreement":      x509.KeyUsageKeyAgreement,
+	"cert_sign":          x509.KeyUsageCertSign,
+	"crl_sign":           x509.KeyUsageCRLSign,
+	"encipher_only":      x509.KeyUsageEncipherOnly,
+	"decipher_only":      x509.KeyUsageDecipherOnly,
+}
+
+var extKeyUsageNames = map[string]x509.ExtKeyUsage{
+	"any":              x509.ExtKeyUsageAny,
+	"server_auth":      x509.ExtKeyUsageServerAuth,
+	"client_auth":      x509.ExtKeyUsageClientAuth,
+	"code_signing":     x509.ExtKeyUsageCodeSigning,
+	"email_protection": x509.ExtKeyUsageEmailProtection,
+	"time_stamping":    x509.ExtKeyUsageTimeStamping,
+	"ocsp_signing":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// ParseOID parses a dotted OID, such as "1.3.6.1.4.1.99999.1".
+func ParseOID(s string) (asn1.ObjectIdentifier, error) {
+	var oid asn1.ObjectIdentifier
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid OID %q", s)
+		}
+		oid = append(oid, n)
+	}
+	if len(oid) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", s)
+	}
+	return oid, nil
+}
+
+// Profile converts the config to a Profile with the given name.
+func (c *ProfileConfig) Profile(name string) (Profile, error) {
+	p := Profile{
+		Name:         name,
+		IsCA:         c.IsCA,
+		KeyAlgorithm: KeyAlgorithm(c.KeyAlgorithm),
+	}
+
+	for _, usage := range c.KeyUsages {
+		ku, ok := keyUsageNames[usage]
+		if !ok {
+			return p, fmt.Errorf("profile %q: unknown key usage %q", name, usage)
+		}
+		p.KeyUsage |= ku
+	}
+
+	for _, usage := range c.ExtKeyUsages {
+		eku, ok := extKeyUsageNames[usage]
+		if !ok {
+			return p, fmt.Errorf("profile %q: unknown ext key usage %q", name, usage)
+		}
+		p.ExtKeyUsage = append(p.ExtKeyUsage, eku)
+	}
+
+	if c.MaxLifetime != "" {
+		d, err := time.ParseDuration(c.MaxLifetime)
+		if err != nil {
+			return p, fmt.Errorf("profile %q: invalid max lifetime: %w", name, err)
+		}
+		p.MaxLifetime = d
+	}
+
+	for _, san := range c.RequiredSANs {
+		switch SANType(san) {
+		case SANTypeDNS, SANTypeIP, SANTypeURI, SANTypeEmail:
+			p.RequiredSANs = append(p.RequiredSANs, SANType(san))
+		default:
+			return p, fmt.Errorf("profile %q: unknown SAN type %q", name, san)
+		}
+	}
+
+	switch p.KeyAlgorithm {
+	case "", KeyAlgorithmECDSAP256, KeyAlgorithmECDSAP384, KeyAlgorithmRSA2048, KeyAlgorithmRSA4096:
+	default:
+		return p, fmt.Errorf("profile %q: unknown key algorithm %q", name, c.KeyAlgorithm)
+	}
+
+	for _, ext := range c.Extensions {
+		oid, err := ParseOID(ext.OID)
+		if err != nil {
+			return p, fmt.Errorf("profile %q: %w", name, err)
+		}
+		value, err := base64.StdEncoding.DecodeString(ext.Value)
+		if err != nil {
+			return p, fmt.Errorf("profile %q: extension %s value must be base64: %w", name, ext.OID, err)
+		}
+		p.ExtraExtensions = append(p.ExtraExtensions, pkix.Extension{
+			Id:       oid,
+			Critical: ext.Critical,
+			Value:    value,
+		})
+	}
+
+	return p, nil
+}
+
+// ParseProfiles parses YAML or JSON encoded profiles, returning them
+// along with the built-in profiles they don't replace. Unknown fields
+// are rejected, so misspelled settings aren't silently ignored.
+func ParseProfiles(data []byte) (map[string]Profile, error) {
+	var config ProfilesConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err := dec.Decode(&config)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	profiles := map[string]Profile{}
+	for name, p := range Profiles {
+		profiles[name] = p
+	}
+	for name, c := range config.Profiles {
+		p, err := c.Profile(name)
+		if err != nil {
+			return nil, err
+		}
+		profiles[name] = p
+	}
+	return profiles, nil
+}
+
+// LoadProfiles reads profiles from a YAML or JSON file, as described by
+// ParseProfiles.
+func LoadProfiles(path string) (map[string]Profile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := ParseProfiles(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return profiles, nil
+}
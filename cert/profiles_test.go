@@ -0,0 +1,138 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewFromProfile(t *testing.T) {
+	caPEM, caPrivKeyPEM, err := NewCA(WithCommonName("ca"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := ParseProfiles([]byte(`
+profiles:
+  build-signer:
+    key_usages: [digital_signature]
+    ext_key_usages: [code_signing]
+    max_lifetime: 24h
+    required_sans: [uri]
+    key_algorithm: rsa-2048
+    extensions:
+      - oid: 1.3.6.1.4.1.99999.1
+        value: BQA=
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := profiles[WebServerProfile.Name]; !ok {
+		t.Fatal("expected built-in profiles to be included")
+	}
+
+	issue := func(p Profile, opts ...CertOption) (*tls.Certificate, error) {
+		certPEM, keyPEM, err := NewFromProfile(bytes.NewReader(caPrivKeyPEM), bytes.NewReader(caPEM), p, opts...)
+		if err != nil {
+			return nil, err
+		}
+		keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, _ := pem.Decode(certPEM)
+		keyPair.Leaf, err = x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &keyPair, nil
+	}
+
+	keyPair, err := issue(profiles["web-server"], WithCommonName("web"), WithDNSNames("web.internal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keyPair.Leaf.ExtKeyUsage) != 1 || keyPair.Leaf.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth {
+		t.Fatalf("unexpected ext key usage %v", keyPair.Leaf.ExtKeyUsage)
+	}
+	if lifetime := keyPair.Leaf.NotAfter.Sub(keyPair.Leaf.NotBefore); lifetime != WebServerProfile.MaxLifetime {
+		t.Fatalf("expected the profile's max lifetime by default, got %v", lifetime)
+	}
+
+	keyPair, err = issue(profiles["build-signer"], WithCommonName("ci"), WithURIs(mustParseURL(t, "spiffe://ci/builder")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := keyPair.PrivateKey.(*rsa.PrivateKey); !ok {
+		t.Fatalf("expected an RSA key, got %T", keyPair.PrivateKey)
+	}
+	var found bool
+	for _, ext := range keyPair.Leaf.Extensions {
+		if ext.Id.String() == "1.3.6.1.4.1.99999.1" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("expected the profile's custom extension")
+	}
+
+	tests := map[string]struct {
+		profile Profile
+		opts    []CertOption
+	}{
+		"missing SAN":       {profiles["web-server"], []CertOption{WithCommonName("web")}},
+		"lifetime too long": {profiles["build-signer"], []CertOption{WithURIs(mustParseURL(t, "spiffe://ci/builder")), IsValidFor(48 * time.Hour)}},
+		"wrong key":         {profiles["build-signer"], []CertOption{WithURIs(mustParseURL(t, "spiffe://ci/builder")), WithNewECDSAKey()}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := issue(test.profile, test.opts...)
+			var profileErr *ProfileError
+			if !errors.As(err, &profileErr) {
+				t.Fatalf("expected a ProfileError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseProfilesErrors(t *testing.T) {
+	for _, config := range []string{
+		"profiles: {bad: {key_usages: [sign_everything]}}",
+		"profiles: {bad: {ext_key_usages: [everything]}}",
+		"profiles: {bad: {max_lifetime: forever}}",
+		"profiles: {bad: {required_sans: [phone]}}",
+		"profiles: {bad: {key_algorithm: dsa-1024}}",
+		"profiles: {bad: {extensions: [{oid: not.an.oid}]}}",
+		"profiles: {bad: {max_lifetme: 24h}}",
+		"profile: {bad: {max_lifetime: 24h}}",
+	} {
+		_, err := ParseProfiles([]byte(config))
+		if err == nil {
+			t.Fatalf("expected an error for %q", config)
+		}
+	}
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestBuiltInProfilesKeyUsage(t *testing.T) {
+	for name, p := range Profiles {
+		// key encipherment only applies to RSA key exchange
+		if !strings.HasPrefix(string(p.KeyAlgorithm), "rsa-") && p.KeyUsage&x509.KeyUsageKeyEncipherment != 0 {
+			t.Fatalf("profile %q sets key encipherment for %s keys", name, p.KeyAlgorithm)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package cert
+
+import (
+	"crypto/x509"
+	"sync"
+)
+
+// Recorder records every cert issued by New, such as in an issuance
+// database. The cert is not returned if it fails to be recorded.
+type Recorder interface {
+	RecordCertificate(cert *x509.Certificate, requester string) error
+}
+
+// defaultRecorder records certs issued without WithRecorder.
+var defaultRecorder struct {
+	sync.RWMutex
+	recorder Recorder
+}
+
+// SetDefaultRecorder records every cert issued by New with the given
+// Recorder, unless WithRecorder sets another one. A nil Recorder stops
+// recording certs by default.
+func SetDefaultRecorder(r Recorder) {
+	defaultRecorder.Lock()
+	defer defaultRecorder.Unlock()
+	defaultRecorder.recorder = r
+}
+
+func getDefaultRecorder() Recorder {
+	defaultRecorder.RLock()
+	defer defaultRecorder.RUnlock()
+	return defaultRecorder.recorder
+}
+
+// WithRecorder records the issued cert using the given Recorder,
+// instead of the default one.
+func WithRecorder(r Recorder) CertOption {
+	return func(o *CertOptions) error {
+		o.recorder = r
+		return nil
+	}
+}
+
+// WithRequester sets who requested the cert, which is passed to the
+// Recorder.
+func WithRequester(requester string) CertOption {
+	return func(o *CertOptions) error {
+		o.requester = requester
+		return nil
+	}
+}
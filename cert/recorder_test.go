@@ -0,0 +1,74 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"testing"
+)
+
+type recorderFunc func(cert *x509.Certificate, requester string) error
+
+func (f recorderFunc) RecordCertificate(cert *x509.Certificate, requester string) error {
+	return f(cert, requester)
+}
+
+func TestWithRecorder(t *testing.T) {
+	var recorded []string
+	certPEM, _, err := New(
+		WithNewECDSAKey(),
+		WithCommonName("recorded"),
+		WithRequester("tester"),
+		WithRecorder(recorderFunc(func(cert *x509.Certificate, requester string) error {
+			recorded = append(recorded, cert.Subject.CommonName+"/"+requester)
+			return nil
+		})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certPEM == nil || len(recorded) != 1 || recorded[0] != "recorded/tester" {
+		t.Fatalf("unexpected recorded certs %v", recorded)
+	}
+
+	// certs which fail to be recorded are not returned
+	certPEM, _, err = New(
+		WithNewECDSAKey(),
+		WithRecorder(recorderFunc(func(*x509.Certificate, string) error {
+			return errors.New("database unavailable")
+		})),
+	)
+	if err == nil || certPEM != nil {
+		t.Fatal("expected an error when the cert can't be recorded")
+	}
+}
+
+func TestSetDefaultRecorder(t *testing.T) {
+	var recorded []string
+	SetDefaultRecorder(recorderFunc(func(cert *x509.Certificate, requester string) error {
+		recorded = append(recorded, cert.Subject.CommonName)
+		return nil
+	}))
+	defer SetDefaultRecorder(nil)
+
+	caPEM, caPrivKeyPEM, err := NewCA(WithCommonName("ca"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = NewClientFromCA(bytes.NewReader(caPrivKeyPEM), bytes.NewReader(caPEM), WithCommonName("client"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// WithRecorder takes the place of the default recorder
+	_, _, err = New(WithNewECDSAKey(), WithCommonName("other"), WithRecorder(recorderFunc(func(*x509.Certificate, string) error {
+		return nil
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorded) != 2 || recorded[0] != "ca" || recorded[1] != "client" {
+		t.Fatalf("unexpected recorded certs %v", recorded)
+	}
+}
@@ -2,12 +2,21 @@ package client
 
 import (
 	"crypto/tls"
+	"sync"
+
+	"github.com/picatz/mtls/mux"
+	"github.com/picatz/mtls/renew"
 )
 
 // Client implements an mTLS SSH client.
 type Client struct {
-	addr      string
-	tlsConfig *tls.Config
+	addr       string
+	tlsConfig  *tls.Config
+	muxOptions []mux.Option
+	agent      *renew.Agent
+
+	mu      sync.Mutex
+	session *mux.Session
 }
 
 // New implements a wrappeer to create a new Client,
@@ -26,6 +35,18 @@ func New(opts ...Option) (*Client, error) {
 
 	client.addr = clientOptions.Addr
 	client.tlsConfig = clientOptions.TLSConfig
+	client.muxOptions = clientOptions.MuxOptions
+	client.agent = clientOptions.Agent
+
+	if client.agent != nil {
+		config := &tls.Config{}
+		if client.tlsConfig != nil {
+			config = client.tlsConfig.Clone()
+		}
+		config.Certificates = nil
+		config.GetClientCertificate = client.agent.GetClientCertificate
+		client.tlsConfig = config
+	}
 
 	// Deprecated:
 	// client.tlsConfig.BuildNameToCertificate()
@@ -33,6 +54,71 @@ func New(opts ...Option) (*Client, error) {
 	return client, nil
 }
 
+// Addr returns the address the Client dials.
+func (c *Client) Addr() string {
+	return c.addr
+}
+
+// TLSConfig returns the TLS config used for the Client's connections.
+func (c *Client) TLSConfig() *tls.Config {
+	return c.tlsConfig
+}
+
+// Agent returns the renewal agent providing the Client's cert, if any.
+func (c *Client) Agent() *renew.Agent {
+	return c.agent
+}
+
 func (c *Client) Dial() (*tls.Conn, error) {
 	return tls.Dial("tcp", c.addr, c.tlsConfig)
 }
+
+// OpenStream opens a stream multiplexed over a connection shared by
+// every stream, dialing a new connection if there isn't one or it has
+// been closed. The server must use a stream handler.
+func (c *Client) OpenStream() (*mux.Stream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session != nil {
+		stream, err := c.session.Open()
+		if err == nil {
+			return stream, nil
+		}
+		if err == mux.ErrStreamLimit {
+			return nil, err
+		}
+		// the connection is closed, or the server stopped accepting
+		// new streams on it and closes it once its streams are done,
+		// so a new one is dialed
+		if err != mux.ErrGoAway {
+			c.session.Close()
+		}
+		c.session = nil
+	}
+
+	conn, err := c.Dial()
+	if err != nil {
+		return nil, err
+	}
+	session, err := mux.Client(conn, c.muxOptions...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.session = session
+	return session.Open()
+}
+
+// Close closes the connection shared by streams, if there is one.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session == nil {
+		return nil
+	}
+	err := c.session.Close()
+	c.session = nil
+	return err
+}
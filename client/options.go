@@ -1,12 +1,19 @@
 package client
 
-import "crypto/tls"
+import (
+	"crypto/tls"
+
+	"github.com/picatz/mtls/mux"
+	"github.com/picatz/mtls/renew"
+)
 
 // Options contains each available configuration option
 // for an mTLS SSH Client.
 type Options struct {
-	Addr      string
-	TLSConfig *tls.Config
+	Addr       string
+	TLSConfig  *tls.Config
+	MuxOptions []mux.Option
+	Agent      *renew.Agent
 }
 
 // Option implements a hook to custom a Client
@@ -28,3 +35,21 @@ func WithTLSConfig(config *tls.Config) Option {
 		return nil
 	}
 }
+
+// WithMuxOptions sets the options of the session used by OpenStream.
+func WithMuxOptions(opts ...mux.Option) Option {
+	return func(o *Options) error {
+		o.MuxOptions = opts
+		return nil
+	}
+}
+
+// WithRenewAgent presents the agent's current cert on every new
+// connection, instead of the certs of the TLS config, so renewed certs
+// are used without creating a new Client.
+func WithRenewAgent(agent *renew.Agent) Option {
+	return func(o *Options) error {
+		o.Agent = agent
+		return nil
+	}
+}
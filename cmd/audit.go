@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/picatz/mtls/auditlog"
+	"github.com/spf13/cobra"
+)
+
+var auditCommand = &cobra.Command{
+	Use:   "audit",
+	Short: "CA audit log commands",
+}
+
+var auditVerifyFlags = struct {
+	log    string
+	caCert string
+	head   string
+}{}
+
+var auditVerifyCommand = &cobra.Command{
+	Use:   "verify",
+	Short: "verify an audit log has no gaps or edits",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if auditVerifyFlags.log == "" || auditVerifyFlags.caCert == "" {
+			return fmt.Errorf("--log and --ca-cert are required")
+		}
+
+		caCertPEM, err := ioutil.ReadFile(auditVerifyFlags.caCert)
+		if err != nil {
+			return err
+		}
+		block, _ := pem.Decode(caCertPEM)
+		if block == nil {
+			return fmt.Errorf("no cert found in %q", auditVerifyFlags.caCert)
+		}
+		caCert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(auditVerifyFlags.log)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		head, err := auditlog.Verify(f, caCert.PublicKey)
+		if err != nil {
+			return err
+		}
+		if auditVerifyFlags.head != "" && auditVerifyFlags.head != head.Hash {
+			return fmt.Errorf("log head %s does not match expected head %s, entries were added or removed", head.Hash, auditVerifyFlags.head)
+		}
+
+		fmt.Printf("ok: %d entries, head %s\n", head.Seq, head.Hash)
+		return nil
+	},
+}
+
+// openAuditLog opens the audit log at path, signing entries with the
+// PKCS #8 encoded CA key in caKeyFile.
+func openAuditLog(path, caKeyFile string) (*auditlog.Log, error) {
+	if caKeyFile == "" {
+		return nil, fmt.Errorf("a CA key is required to sign the audit log")
+	}
+	keyPEM, err := ioutil.ReadFile(caKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no private key found in %q", caKeyFile)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%T keys can't sign the audit log", key)
+	}
+	return auditlog.Open(path, signer)
+}
+
+func init() {
+	flags := auditVerifyCommand.Flags()
+	flags.StringVar(&auditVerifyFlags.log, "log", "", "audit log file")
+	flags.StringVar(&auditVerifyFlags.caCert, "ca-cert", "", "PEM encoded CA cert which signed the log")
+	flags.StringVar(&auditVerifyFlags.head, "head", "", "expected hash of the last entry, from a previous verification")
+
+	auditCommand.AddCommand(auditVerifyCommand)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/picatz/mtls/ca"
+	"github.com/picatz/mtls/cert"
+	"github.com/picatz/mtls/client"
+	"github.com/picatz/mtls/renew"
+	"github.com/picatz/mtls/tlsconf"
+	"github.com/spf13/cobra"
+)
+
+var certAgentFlags = struct {
+	cert          string
+	key           string
+	caCert        string
+	caKey         string
+	caAddr        string
+	usage         string
+	lifetime      time.Duration
+	renewAfter    float64
+	checkInterval time.Duration
+}{}
+
+var certAgentCommand = &cobra.Command{
+	Use:   "agent",
+	Short: "keep a cert and key pair renewed from a CA",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		required := map[string]string{
+			"--cert":    certAgentFlags.cert,
+			"--key":     certAgentFlags.key,
+			"--ca-cert": certAgentFlags.caCert,
+		}
+		if certAgentFlags.caAddr == "" {
+			required["--ca-key"] = certAgentFlags.caKey
+		}
+		for flag, value := range required {
+			if value == "" {
+				return fmt.Errorf("%s is required", flag)
+			}
+		}
+
+		var (
+			agent  *renew.Agent
+			issuer renew.Issuer
+		)
+		if certAgentFlags.caAddr != "" {
+			// the online CA authenticates the agent by its current cert
+			tlsConfig, err := tlsconf.Build(
+				tlsconf.WithRootCAFile(certAgentFlags.caCert),
+				func(config *tls.Config) error {
+					config.GetClientCertificate = func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+						return agent.GetClientCertificate(info)
+					}
+					return nil
+				},
+			)
+			if err != nil {
+				return err
+			}
+			c, err := client.New(
+				client.WithAddr(certAgentFlags.caAddr),
+				client.WithTLSConfig(tlsConfig),
+			)
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+
+			remoteCA := ca.NewClient(c)
+			remoteCA.Usage = ca.Usage(certAgentFlags.usage)
+			remoteCA.Lifetime = certAgentFlags.lifetime
+			issuer = remoteCA
+		} else {
+			localCA := &renew.LocalCA{
+				CACertFile: certAgentFlags.caCert,
+				CAKeyFile:  certAgentFlags.caKey,
+				Lifetime:   certAgentFlags.lifetime,
+			}
+			recorder, _, closeRecorder, err := openRecorder(certAgentFlags.caKey)
+			if err != nil {
+				return err
+			}
+			defer closeRecorder()
+			if recorder != nil {
+				localCA.Options = append(localCA.Options, cert.WithRecorder(recorder), cert.WithRequester("agent"))
+			}
+			issuer = localCA
+		}
+
+		agent, err := renew.New(
+			certAgentFlags.cert,
+			certAgentFlags.key,
+			issuer,
+			renew.WithRenewAfter(certAgentFlags.renewAfter),
+			renew.WithCheckInterval(certAgentFlags.checkInterval),
+		)
+		if err != nil {
+			return err
+		}
+
+		events := agent.Subscribe()
+		go func() {
+			for event := range events {
+				if event.Err != nil {
+					log.Printf("agent: %s", event.Err)
+					continue
+				}
+				log.Printf("agent: renewed %q, valid until %s", event.Certificate.Subject.CommonName, event.Certificate.NotAfter.Format(time.RFC3339))
+			}
+		}()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		go func() {
+			<-interrupt
+			cancel()
+		}()
+
+		err = agent.Run(ctx)
+		if err == context.Canceled {
+			return nil
+		}
+		return err
+	},
+}
+
+func init() {
+	flags := certAgentCommand.Flags()
+	flags.StringVar(&certAgentFlags.cert, "cert", "", "PEM encoded cert file to keep renewed")
+	flags.StringVar(&certAgentFlags.key, "key", "", "PEM encoded private key file to keep renewed")
+	flags.StringVar(&certAgentFlags.caCert, "ca-cert", "", "PEM encoded CA cert file, which verifies the online CA with --ca-addr")
+	flags.StringVar(&certAgentFlags.caKey, "ca-key", "", "PEM encoded CA private key file")
+	flags.StringVar(&certAgentFlags.caAddr, "ca-addr", "", "address of an online CA to renew from, instead of --ca-key")
+	flags.StringVar(&certAgentFlags.usage, "usage", string(ca.UsageClient), "usage requested from the online CA (client or server)")
+	flags.DurationVar(&certAgentFlags.lifetime, "lifetime", 24*time.Hour, "lifetime of issued certs")
+	flags.Float64Var(&certAgentFlags.renewAfter, "renew-after", renew.DefaultRenewAfter, "fraction of a cert's lifetime after which it is renewed")
+	flags.DurationVar(&certAgentFlags.checkInterval, "interval", renew.DefaultCheckInterval, "interval between checks")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/picatz/mtls/auditlog"
+	"github.com/picatz/mtls/cert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func runCertCommand(t *testing.T, args ...string) {
+	certCommand.SetArgs(args)
+	require.NoError(t, certCommand.Execute(), strings.Join(args, " "))
+}
+
+func TestCertCommandsAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "audit.jsonl")
+	root := filepath.Join(dir, "root")
+	next := filepath.Join(dir, "next")
+
+	runCertCommand(t, "ca", "--cn", "root", "--out", root, "--audit-log", logFile)
+	runCertCommand(t, "ca", "--cn", "next", "--out", next, "--audit-log", "")
+
+	runCertCommand(t, "issue",
+		"--profile", "web-server",
+		"--ca-cert", root+".cert.pem",
+		"--ca-key", root+".priv.key.pem",
+		"--cn", "app",
+		"--dns", "app.internal",
+		"--out", filepath.Join(dir, "app"),
+		"--requester", "deploy",
+		"--audit-log", logFile,
+	)
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	pubFile := filepath.Join(dir, "id_ed25519.pub")
+	require.NoError(t, ioutil.WriteFile(pubFile, ssh.MarshalAuthorizedKey(sshPub), 0644))
+
+	runCertCommand(t, "ssh", "sign",
+		"--ca-cert", root+".cert.pem",
+		"--ca-key", root+".priv.key.pem",
+		"--pub", pubFile,
+		"--key-id", "alice",
+		"--principals", "alice",
+		"--requester", "alice",
+		"--audit-log", logFile,
+	)
+
+	runCertCommand(t, "rollover",
+		"--old-cert", root+".cert.pem",
+		"--old-key", root+".priv.key.pem",
+		"--new-cert", next+".cert.pem",
+		"--new-key", next+".priv.key.pem",
+		"--out", filepath.Join(dir, "rollover"),
+		"--audit-log", logFile,
+	)
+
+	data, err := ioutil.ReadFile(logFile)
+	require.NoError(t, err)
+
+	rootPEM, err := ioutil.ReadFile(root + ".cert.pem")
+	require.NoError(t, err)
+	rootCert, err := cert.ParseCertificates(rootPEM)
+	require.NoError(t, err)
+	_, err = auditlog.Verify(bytes.NewReader(data), rootCert[0].PublicKey)
+	require.NoError(t, err)
+
+	var ops []auditlog.Op
+	var requesters []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var e auditlog.Entry
+		require.NoError(t, json.Unmarshal([]byte(line), &e))
+		ops = append(ops, e.Op)
+		requesters = append(requesters, e.Requester)
+	}
+	require.Equal(t, []auditlog.Op{
+		auditlog.OpCACreate,
+		auditlog.OpIssue,
+		auditlog.OpKeyExport,
+		auditlog.OpSSHIssue,
+		auditlog.OpCACreate,
+		auditlog.OpCACreate,
+	}, ops)
+	require.Equal(t, []string{"", "deploy", "deploy", "alice", "", ""}, requesters)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/spf13/cobra"
+)
+
+var certCAFlags = struct {
+	commonName string
+	orgs       []string
+	lifetime   time.Duration
+	out        string
+}{}
+
+var certCACommand = &cobra.Command{
+	Use:   "ca",
+	Short: "create a root CA cert and key pair",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if certCAFlags.out == "" {
+			return fmt.Errorf("--out is required")
+		}
+
+		opts := []cert.CertOption{
+			cert.WithCommonName(certCAFlags.commonName),
+			cert.WithOrganization(certCAFlags.orgs...),
+		}
+		if certCAFlags.lifetime > 0 {
+			opts = append(opts, cert.IsValidFor(certCAFlags.lifetime))
+		}
+
+		caPEM, caPrivKeyPEM, err := cert.NewCA(opts...)
+		if err != nil {
+			return err
+		}
+		err = cert.SaveCertAndKey(certCAFlags.out, caPEM, caPrivKeyPEM)
+		if err != nil {
+			return err
+		}
+
+		// the new CA's key signs its audit log, starting with its creation
+		auditLog, closeAuditLog, err := openCertAuditLog(certCAFlags.out + ".priv.key.pem")
+		if err != nil || auditLog == nil {
+			return err
+		}
+		defer closeAuditLog()
+
+		caCert, err := cert.ParseCertificates(caPEM)
+		if err != nil {
+			return err
+		}
+		return auditLog.RecordCA(caCert[0])
+	},
+}
+
+func init() {
+	flags := certCACommand.Flags()
+	flags.StringVar(&certCAFlags.commonName, "cn", "", "subject common name")
+	flags.StringSliceVar(&certCAFlags.orgs, "org", nil, "subject organizations (O)")
+	flags.DurationVar(&certCAFlags.lifetime, "lifetime", 0, "lifetime of the CA cert")
+	flags.StringVar(&certCAFlags.out, "out", "", "prefix of the written .cert.pem and .priv.key.pem files")
+
+	certCommand.AddCommand(certCACommand)
+}
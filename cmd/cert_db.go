@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/picatz/mtls/auditlog"
+	"github.com/picatz/mtls/cert"
+	"github.com/picatz/mtls/store"
+	"github.com/spf13/cobra"
+)
+
+var certDBFlag string
+
+var certListFlags = struct {
+	name      string
+	requester string
+	status    string
+	since     string
+	until     string
+	json      bool
+}{}
+
+// parseTime parses an RFC 3339 time or date, or a duration before now.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339, YYYY-MM-DD or a duration", value)
+	}
+	return t, nil
+}
+
+var certAuditLogFlag string
+
+func openCertDB() (*store.FileStore, error) {
+	if certDBFlag == "" {
+		return nil, fmt.Errorf("--db is required")
+	}
+	return store.Open(certDBFlag)
+}
+
+// openCertAuditLog opens the audit log given by the --audit-log flag,
+// or returns a nil log if it isn't set.
+func openCertAuditLog(caKeyFile string) (*auditlog.Log, func(), error) {
+	if certAuditLogFlag == "" {
+		return nil, func() {}, nil
+	}
+	log, err := openAuditLog(certAuditLogFlag, caKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return log, func() { log.Close() }, nil
+}
+
+// openCertStore opens the issuance database, recording changes in the
+// audit log when one is given, which is also returned.
+func openCertStore(caKeyFile string) (store.Store, *auditlog.Log, func(), error) {
+	db, err := openCertDB()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	log, closeLog, err := openCertAuditLog(caKeyFile)
+	if err != nil {
+		db.Close()
+		return nil, nil, nil, err
+	}
+	if log == nil {
+		return db, nil, func() { db.Close() }, nil
+	}
+	return auditlog.Store(db, log), log, func() {
+		closeLog()
+		db.Close()
+	}, nil
+}
+
+// openRecorder returns a cert.Recorder for the issuance database and
+// audit log flags, or nil if neither is given. The audit log is also
+// returned, or nil if it isn't given.
+func openRecorder(caKeyFile string) (cert.Recorder, *auditlog.Log, func(), error) {
+	switch {
+	case certDBFlag != "":
+		s, log, closeStore, err := openCertStore(caKeyFile)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return store.Recorder(s), log, closeStore, nil
+	case certAuditLogFlag != "":
+		log, closeLog, err := openCertAuditLog(caKeyFile)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return log, log, closeLog, nil
+	default:
+		return nil, nil, func() {}, nil
+	}
+}
+
+var certListCommand = &cobra.Command{
+	Use:   "list",
+	Short: "list and search issued certs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		since, err := parseTime(certListFlags.since)
+		if err != nil {
+			return err
+		}
+		until, err := parseTime(certListFlags.until)
+		if err != nil {
+			return err
+		}
+
+		db, err := openCertDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		records, err := db.List(store.Query{
+			Name:         certListFlags.name,
+			Requester:    certListFlags.requester,
+			Status:       store.Status(certListFlags.status),
+			IssuedAfter:  since,
+			IssuedBefore: until,
+		})
+		if err != nil {
+			return err
+		}
+
+		if certListFlags.json {
+			enc := json.NewEncoder(os.Stdout)
+			for _, r := range records {
+				err := enc.Encode(r)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "SERIAL\tSTATUS\tNAMES\tREQUESTER\tISSUED\tEXPIRES")
+		for _, r := range records {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				r.Serial,
+				r.StatusAt(time.Now()),
+				strings.Join(r.Names(), ","),
+				r.Requester,
+				r.IssuedAt.Format(time.RFC3339),
+				r.NotAfter.Format(time.RFC3339),
+			)
+		}
+		return w.Flush()
+	},
+}
+
+var (
+	certRevokeReason string
+	certRevokeCAKey  string
+)
+
+var certRevokeCommand = &cobra.Command{
+	Use:   "revoke SERIAL...",
+	Short: "mark issued certs as revoked",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, _, closeDB, err := openCertStore(certRevokeCAKey)
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+
+		for _, serial := range args {
+			err := db.Revoke(serial, certRevokeReason)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	certCommand.PersistentFlags().StringVar(&certDBFlag, "db", "", "issuance database file")
+	certCommand.PersistentFlags().StringVar(&certAuditLogFlag, "audit-log", "", "CA audit log file")
+
+	flags := certListCommand.Flags()
+	flags.StringVar(&certListFlags.name, "name", "", "only certs with this common name or SAN")
+	flags.StringVar(&certListFlags.requester, "requester", "", "only certs requested by this requester")
+	flags.StringVar(&certListFlags.status, "status", "", "only certs with this status (valid, revoked or expired)")
+	flags.StringVar(&certListFlags.since, "since", "", "only certs issued after this time or duration ago")
+	flags.StringVar(&certListFlags.until, "until", "", "only certs issued before this time or duration ago")
+	flags.BoolVar(&certListFlags.json, "json", false, "print records as JSON lines")
+
+	certRevokeCommand.Flags().StringVar(&certRevokeReason, "reason", "", "reason for the revocation")
+	certRevokeCommand.Flags().StringVar(&certRevokeCAKey, "ca-key", "", "PEM encoded CA private key file, used to sign the audit log")
+
+	certCommand.AddCommand(certListCommand)
+	certCommand.AddCommand(certRevokeCommand)
+}
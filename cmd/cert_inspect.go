@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/spf13/cobra"
+)
+
+var certInspectJSON bool
+
+var certInspectCommand = &cobra.Command{
+	Use:   "inspect FILE...",
+	Short: "describe every cert in PEM bundles",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var infos []*cert.Info
+		for _, file := range args {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			fileInfos, err := cert.Inspect(data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+			infos = append(infos, fileInfos...)
+		}
+
+		if certInspectJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(infos)
+		}
+		for i, info := range infos {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Print(info)
+		}
+		return nil
+	},
+}
+
+var certExplainFlags = struct {
+	roots         string
+	intermediates string
+	host          string
+	usage         string
+	json          bool
+}{}
+
+var certExplainCommand = &cobra.Command{
+	Use:   "explain FILE",
+	Short: "explain why a cert chain does or doesn't verify",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if certExplainFlags.roots == "" {
+			return fmt.Errorf("--ca-cert is required")
+		}
+
+		leafPEM, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		// the leaf is the first cert, and any others are intermediates
+		leafCerts, err := cert.ParseCertificates(leafPEM)
+		if err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+
+		roots, err := readCertPool(certExplainFlags.roots)
+		if err != nil {
+			return err
+		}
+		intermediates := x509.NewCertPool()
+		for _, c := range leafCerts[1:] {
+			intermediates.AddCert(c)
+		}
+		if certExplainFlags.intermediates != "" {
+			data, err := ioutil.ReadFile(certExplainFlags.intermediates)
+			if err != nil {
+				return err
+			}
+			intermediates.AppendCertsFromPEM(data)
+		}
+
+		opts := []cert.ExplainOption{cert.WithIntermediates(intermediates)}
+		if certExplainFlags.host != "" {
+			opts = append(opts, cert.ForDNSName(certExplainFlags.host))
+		}
+		switch certExplainFlags.usage {
+		case "server":
+			opts = append(opts, cert.ForKeyUsages(x509.ExtKeyUsageServerAuth))
+		case "client":
+			opts = append(opts, cert.ForKeyUsages(x509.ExtKeyUsageClientAuth))
+		case "any":
+			opts = append(opts, cert.ForKeyUsages(x509.ExtKeyUsageAny))
+		default:
+			return fmt.Errorf("unknown usage %q, expected server, client or any", certExplainFlags.usage)
+		}
+
+		e := cert.ExplainChain(leafCerts[0], roots, opts...)
+		if certExplainFlags.json {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(e)
+			if err != nil {
+				return err
+			}
+		} else {
+			fmt.Print(e)
+		}
+		if !e.Valid {
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+func readCertPool(file string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certs found in %q", file)
+	}
+	return pool, nil
+}
+
+func init() {
+	certInspectCommand.Flags().BoolVar(&certInspectJSON, "json", false, "print descriptions as JSON")
+
+	flags := certExplainCommand.Flags()
+	flags.StringVar(&certExplainFlags.roots, "ca-cert", "", "PEM encoded trusted root certs")
+	flags.StringVar(&certExplainFlags.intermediates, "intermediates", "", "PEM encoded intermediate certs")
+	flags.StringVar(&certExplainFlags.host, "host", "", "host name the cert must be valid for")
+	flags.StringVar(&certExplainFlags.usage, "usage", "server", "usage the chain must be valid for: server, client or any")
+	flags.BoolVar(&certExplainFlags.json, "json", false, "print the explanation as JSON")
+
+	certCommand.AddCommand(certInspectCommand)
+	certCommand.AddCommand(certExplainCommand)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/picatz/mtls/store"
+	"github.com/spf13/cobra"
+)
+
+var certIssueFlags = struct {
+	profile      string
+	profilesFile string
+	caCert       string
+	caKey        string
+	commonName   string
+	orgs         []string
+	units        []string
+	dnsNames     []string
+	ips          []string
+	uris         []string
+	emails       []string
+	lifetime     time.Duration
+	out          string
+	requester    string
+}{}
+
+var certIssueCommand = &cobra.Command{
+	Use:   "issue",
+	Short: "issue a cert and key pair using a named profile",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for flag, value := range map[string]string{
+			"--profile": certIssueFlags.profile,
+			"--ca-cert": certIssueFlags.caCert,
+			"--ca-key":  certIssueFlags.caKey,
+			"--out":     certIssueFlags.out,
+		} {
+			if value == "" {
+				return fmt.Errorf("%s is required", flag)
+			}
+		}
+
+		profiles := cert.Profiles
+		if certIssueFlags.profilesFile != "" {
+			var err error
+			profiles, err = cert.LoadProfiles(certIssueFlags.profilesFile)
+			if err != nil {
+				return err
+			}
+		}
+		profile, ok := profiles[certIssueFlags.profile]
+		if !ok {
+			var names []string
+			for name := range profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("unknown profile %q, expected one of %v", certIssueFlags.profile, names)
+		}
+
+		opts := []cert.CertOption{
+			cert.WithCommonName(certIssueFlags.commonName),
+			cert.WithOrganization(certIssueFlags.orgs...),
+			cert.WithOrganizationalUnit(certIssueFlags.units...),
+			cert.WithDNSNames(certIssueFlags.dnsNames...),
+			cert.WithEmailAddresses(certIssueFlags.emails...),
+		}
+		for _, s := range certIssueFlags.ips {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return fmt.Errorf("invalid IP address %q", s)
+			}
+			opts = append(opts, cert.WithIPAddresses(ip))
+		}
+		for _, s := range certIssueFlags.uris {
+			uri, err := url.Parse(s)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, cert.WithURIs(uri))
+		}
+		if certIssueFlags.lifetime > 0 {
+			opts = append(opts, cert.IsValidFor(certIssueFlags.lifetime))
+		}
+
+		recorder, auditLog, closeRecorder, err := openRecorder(certIssueFlags.caKey)
+		if err != nil {
+			return err
+		}
+		defer closeRecorder()
+		if recorder != nil {
+			opts = append(opts, cert.WithRecorder(recorder), cert.WithRequester(certIssueFlags.requester))
+		}
+
+		caCertFile, err := os.Open(certIssueFlags.caCert)
+		if err != nil {
+			return err
+		}
+		defer caCertFile.Close()
+		caKeyFile, err := os.Open(certIssueFlags.caKey)
+		if err != nil {
+			return err
+		}
+		defer caKeyFile.Close()
+
+		certPEM, keyPEM, err := cert.NewFromProfile(caKeyFile, caCertFile, profile, opts...)
+		if err != nil {
+			return err
+		}
+
+		err = cert.SaveCertAndKey(certIssueFlags.out, certPEM, keyPEM)
+		if err != nil || auditLog == nil {
+			return err
+		}
+
+		// the private key was generated here, and left the CA
+		issued, err := cert.ParseCertificates(certPEM)
+		if err != nil {
+			return err
+		}
+		return auditLog.RecordKeyExport(store.FormatSerial(issued[0]), certIssueFlags.requester, "private key written to "+certIssueFlags.out+".priv.key.pem")
+	},
+}
+
+func init() {
+	flags := certIssueCommand.Flags()
+	flags.StringVar(&certIssueFlags.profile, "profile", "", "name of the issuance profile")
+	flags.StringVar(&certIssueFlags.profilesFile, "profiles", "", "YAML or JSON file with additional issuance profiles")
+	flags.StringVar(&certIssueFlags.caCert, "ca-cert", "", "PEM encoded CA cert file")
+	flags.StringVar(&certIssueFlags.caKey, "ca-key", "", "PEM encoded CA private key file")
+	flags.StringVar(&certIssueFlags.commonName, "cn", "", "subject common name")
+	flags.StringSliceVar(&certIssueFlags.orgs, "org", nil, "subject organizations (O)")
+	flags.StringSliceVar(&certIssueFlags.units, "ou", nil, "subject organizational units (OU)")
+	flags.StringSliceVar(&certIssueFlags.dnsNames, "dns", nil, "DNS name SANs")
+	flags.StringSliceVar(&certIssueFlags.ips, "ip", nil, "IP address SANs")
+	flags.StringSliceVar(&certIssueFlags.uris, "uri", nil, "URI SANs")
+	flags.StringSliceVar(&certIssueFlags.emails, "email", nil, "email address SANs")
+	flags.DurationVar(&certIssueFlags.lifetime, "lifetime", 0, "lifetime of the cert, defaults to the profile's maximum")
+	flags.StringVar(&certIssueFlags.out, "out", "", "prefix of the written .cert.pem and .priv.key.pem files")
+	flags.StringVar(&certIssueFlags.requester, "requester", os.Getenv("USER"), "who requested the cert, recorded in the issuance database")
+
+	certCommand.AddCommand(certIssueCommand)
+}
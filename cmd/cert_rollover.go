@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/spf13/cobra"
+)
+
+var certRolloverFlags = struct {
+	oldCert string
+	oldKey  string
+	newCert string
+	newKey  string
+	out     string
+}{}
+
+var certRolloverCommand = &cobra.Command{
+	Use:   "rollover",
+	Short: "cross-sign two root CAs and write the bundles for each rollover phase",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		files := map[string]string{
+			"--old-cert": certRolloverFlags.oldCert,
+			"--old-key":  certRolloverFlags.oldKey,
+			"--new-cert": certRolloverFlags.newCert,
+			"--new-key":  certRolloverFlags.newKey,
+			"--out":      certRolloverFlags.out,
+		}
+		data := map[string][]byte{}
+		for flag, file := range files {
+			if file == "" {
+				return fmt.Errorf("%s is required", flag)
+			}
+			if flag == "--out" {
+				continue
+			}
+			b, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			data[flag] = b
+		}
+
+		r, err := cert.NewRollover(data["--old-key"], data["--old-cert"], data["--new-key"], data["--new-cert"])
+		if err != nil {
+			return err
+		}
+
+		write := func(path string, b []byte) error {
+			if len(b) == 0 {
+				return nil
+			}
+			err := os.MkdirAll(filepath.Dir(path), 0755)
+			if err != nil {
+				return err
+			}
+			return ioutil.WriteFile(path, b, 0644)
+		}
+
+		err = write(filepath.Join(certRolloverFlags.out, "old-signed-by-new.pem"), r.OldSignedByNew)
+		if err != nil {
+			return err
+		}
+		err = write(filepath.Join(certRolloverFlags.out, "new-signed-by-old.pem"), r.NewSignedByOld)
+		if err != nil {
+			return err
+		}
+
+		auditLog, closeAuditLog, err := openCertAuditLog(certRolloverFlags.oldKey)
+		if err != nil {
+			return err
+		}
+		defer closeAuditLog()
+		if auditLog != nil {
+			for _, crossSigned := range [][]byte{r.NewSignedByOld, r.OldSignedByNew} {
+				certs, err := cert.ParseCertificates(crossSigned)
+				if err != nil {
+					return err
+				}
+				for _, c := range certs {
+					err := auditLog.RecordCA(c)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		for _, phase := range cert.RolloverPhases {
+			bundles, err := r.Bundles(phase)
+			if err != nil {
+				return err
+			}
+			dir := filepath.Join(certRolloverFlags.out, fmt.Sprintf("%d-%s", int(phase), phase))
+			err = write(filepath.Join(dir, "trust.pem"), bundles.Trust)
+			if err != nil {
+				return err
+			}
+			err = write(filepath.Join(dir, "chain.pem"), bundles.Chain)
+			if err != nil {
+				return err
+			}
+			err = write(filepath.Join(dir, "issuer.pem"), bundles.IssuerCert)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	flags := certRolloverCommand.Flags()
+	flags.StringVar(&certRolloverFlags.oldCert, "old-cert", "", "PEM encoded old root CA cert file")
+	flags.StringVar(&certRolloverFlags.oldKey, "old-key", "", "PEM encoded old root CA private key file")
+	flags.StringVar(&certRolloverFlags.newCert, "new-cert", "", "PEM encoded new root CA cert file")
+	flags.StringVar(&certRolloverFlags.newKey, "new-key", "", "PEM encoded new root CA private key file")
+	flags.StringVar(&certRolloverFlags.out, "out", "", "directory the bundles are written to")
+
+	certCommand.AddCommand(certRolloverCommand)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/picatz/mtls/sshca"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+var certSSHCommand = &cobra.Command{
+	Use:   "ssh",
+	Short: "sign OpenSSH certs with the CA key and write SSH trust lines",
+}
+
+var certSSHSignFlags = struct {
+	caCert          string
+	caKey           string
+	pubKey          string
+	host            bool
+	keyID           string
+	principals      []string
+	lifetime        time.Duration
+	forceCommand    string
+	sourceAddresses []string
+	extensions      []string
+	noExtensions    bool
+	out             string
+	requester       string
+}{}
+
+var certSSHSignCommand = &cobra.Command{
+	Use:   "sign",
+	Short: "sign an OpenSSH user or host cert for a public key",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for flag, value := range map[string]string{
+			"--ca-cert": certSSHSignFlags.caCert,
+			"--ca-key":  certSSHSignFlags.caKey,
+			"--pub":     certSSHSignFlags.pubKey,
+		} {
+			if value == "" {
+				return fmt.Errorf("%s is required", flag)
+			}
+		}
+
+		pubBytes, err := ioutil.ReadFile(certSSHSignFlags.pubKey)
+		if err != nil {
+			return err
+		}
+		pub, _, _, _, err := ssh.ParseAuthorizedKey(pubBytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse %q: %w", certSSHSignFlags.pubKey, err)
+		}
+
+		opts := []sshca.Option{
+			sshca.WithKeyID(certSSHSignFlags.keyID),
+			sshca.WithPrincipals(certSSHSignFlags.principals...),
+			sshca.IsValidFor(certSSHSignFlags.lifetime),
+		}
+		if certSSHSignFlags.forceCommand != "" {
+			opts = append(opts, sshca.WithForceCommand(certSSHSignFlags.forceCommand))
+		}
+		if len(certSSHSignFlags.sourceAddresses) > 0 {
+			opts = append(opts, sshca.WithSourceAddress(certSSHSignFlags.sourceAddresses...))
+		}
+		if certSSHSignFlags.noExtensions {
+			opts = append(opts, sshca.WithExtensions(nil))
+		}
+		for _, ext := range certSSHSignFlags.extensions {
+			name, value := ext, ""
+			if i := strings.Index(ext, "="); i >= 0 {
+				name, value = ext[:i], ext[i+1:]
+			}
+			opts = append(opts, sshca.WithExtension(name, value))
+		}
+
+		caCertFile, err := os.Open(certSSHSignFlags.caCert)
+		if err != nil {
+			return err
+		}
+		defer caCertFile.Close()
+		caKeyFile, err := os.Open(certSSHSignFlags.caKey)
+		if err != nil {
+			return err
+		}
+		defer caKeyFile.Close()
+
+		ca, err := sshca.New(caKeyFile, caCertFile)
+		if err != nil {
+			return err
+		}
+
+		sign := ca.SignUserCert
+		if certSSHSignFlags.host {
+			sign = ca.SignHostCert
+		}
+		c, err := sign(pub, opts...)
+		if err != nil {
+			return err
+		}
+
+		auditLog, closeAuditLog, err := openCertAuditLog(certSSHSignFlags.caKey)
+		if err != nil {
+			return err
+		}
+		defer closeAuditLog()
+		if auditLog != nil {
+			err := auditLog.RecordSSHCertificate(c, certSSHSignFlags.requester)
+			if err != nil {
+				return err
+			}
+		}
+
+		out := certSSHSignFlags.out
+		if out == "" {
+			out = strings.TrimSuffix(certSSHSignFlags.pubKey, ".pub") + "-cert.pub"
+		}
+		return ioutil.WriteFile(out, sshca.MarshalCertificate(c), 0644)
+	},
+}
+
+var certSSHKnownHostsFlags = struct {
+	caCert string
+	hosts  []string
+}{}
+
+var certSSHKnownHostsCommand = &cobra.Command{
+	Use:   "known-hosts",
+	Short: "print a known_hosts line trusting host certs signed by the CA",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		caPub, err := readSSHCAPublicKey(certSSHKnownHostsFlags.caCert)
+		if err != nil {
+			return err
+		}
+		fmt.Println(sshca.KnownHostsLine(caPub, certSSHKnownHostsFlags.hosts...))
+		return nil
+	},
+}
+
+var certSSHTrustedUserCAKeysFlags = struct {
+	caCert string
+}{}
+
+var certSSHTrustedUserCAKeysCommand = &cobra.Command{
+	Use:   "trusted-user-ca-keys",
+	Short: "print a TrustedUserCAKeys line trusting user certs signed by the CA",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		caPub, err := readSSHCAPublicKey(certSSHTrustedUserCAKeysFlags.caCert)
+		if err != nil {
+			return err
+		}
+		fmt.Println(sshca.TrustedUserCAKeysLine(caPub))
+		return nil
+	},
+}
+
+// readSSHCAPublicKey reads the SSH public key of a PEM encoded CA cert.
+func readSSHCAPublicKey(caCertFile string) (ssh.PublicKey, error) {
+	if caCertFile == "" {
+		return nil, fmt.Errorf("--ca-cert is required")
+	}
+	caCertPEM, err := ioutil.ReadFile(caCertFile)
+	if err != nil {
+		return nil, err
+	}
+	return sshca.PublicKeyFromCert(caCertPEM)
+}
+
+func init() {
+	flags := certSSHSignCommand.Flags()
+	flags.StringVar(&certSSHSignFlags.caCert, "ca-cert", "", "PEM encoded CA cert file")
+	flags.StringVar(&certSSHSignFlags.caKey, "ca-key", "", "PEM encoded CA private key file")
+	flags.StringVar(&certSSHSignFlags.pubKey, "pub", "", "OpenSSH public key file to sign")
+	flags.BoolVar(&certSSHSignFlags.host, "host", false, "sign a host cert instead of a user cert")
+	flags.StringVar(&certSSHSignFlags.keyID, "key-id", "", "key ID logged by sshd when the cert is used")
+	flags.StringSliceVar(&certSSHSignFlags.principals, "principals", nil, "user or host names the cert is valid for")
+	flags.DurationVar(&certSSHSignFlags.lifetime, "lifetime", sshca.DefaultLifetime, "lifetime of the cert")
+	flags.StringVar(&certSSHSignFlags.forceCommand, "force-command", "", "force-command critical option")
+	flags.StringSliceVar(&certSSHSignFlags.sourceAddresses, "source-address", nil, "source-address critical option CIDRs")
+	flags.StringSliceVar(&certSSHSignFlags.extensions, "extension", nil, "user cert extensions, as NAME or NAME=VALUE")
+	flags.BoolVar(&certSSHSignFlags.noExtensions, "no-default-extensions", false, "don't add the default user cert extensions")
+	flags.StringVar(&certSSHSignFlags.requester, "requester", os.Getenv("USER"), "who requested the cert, recorded in the audit log")
+	flags.StringVar(&certSSHSignFlags.out, "out", "", "cert file to write, defaults to the public key file with a -cert.pub suffix")
+
+	certSSHKnownHostsCommand.Flags().StringVar(&certSSHKnownHostsFlags.caCert, "ca-cert", "", "PEM encoded CA cert file")
+	certSSHKnownHostsCommand.Flags().StringSliceVar(&certSSHKnownHostsFlags.hosts, "hosts", nil, "host name patterns the CA is trusted for, defaults to any host")
+
+	certSSHTrustedUserCAKeysCommand.Flags().StringVar(&certSSHTrustedUserCAKeysFlags.caCert, "ca-cert", "", "PEM encoded CA cert file")
+
+	certSSHCommand.AddCommand(certSSHSignCommand)
+	certSSHCommand.AddCommand(certSSHKnownHostsCommand)
+	certSSHCommand.AddCommand(certSSHTrustedUserCAKeysCommand)
+	certCommand.AddCommand(certSSHCommand)
+}
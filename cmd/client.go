@@ -1,14 +1,144 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/picatz/mtls/client"
+	"github.com/picatz/mtls/mtlsssh"
+	"github.com/picatz/mtls/server"
+	"github.com/picatz/mtls/tlsconf"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
 )
 
+var clientFlags = struct {
+	config string
+	addr   string
+	user   string
+	echo   bool
+}{}
+
 var clientCommand = &cobra.Command{
-	Use:   "client",
+	Use:   "client [COMMAND...]",
 	Short: "mTLS SSH client commands",
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Not yet implemented!")
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		if clientFlags.echo {
+			return echoClient(c)
+		}
+
+		sshClient, err := mtlsssh.Dial(c, clientFlags.user)
+		if err != nil {
+			return err
+		}
+		defer sshClient.Close()
+
+		err = runSession(sshClient, strings.Join(args, " "))
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			sshClient.Close()
+			os.Exit(exitErr.ExitStatus())
+		}
+		return err
 	},
 }
+
+// newClient creates a client from the --config and --addr flags.
+func newClient() (*client.Client, error) {
+	if clientFlags.config == "" {
+		return nil, fmt.Errorf("--config is required")
+	}
+
+	tlsConfig, err := tlsconf.FromFile(clientFlags.config)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.New(
+		client.WithAddr(clientFlags.addr),
+		client.WithTLSConfig(tlsConfig),
+	)
+}
+
+// runSession runs the command, or an interactive shell if it's empty,
+// requesting a terminal if stdin is one.
+func runSession(sshClient *ssh.Client, command string) error {
+	session, err := sshClient.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			return err
+		}
+		termType := os.Getenv("TERM")
+		if termType == "" {
+			termType = "xterm"
+		}
+		err = session.RequestPty(termType, height, width, ssh.TerminalModes{})
+		if err != nil {
+			return err
+		}
+
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(fd, state)
+
+		stop := watchWindowSize(fd, session)
+		defer stop()
+	}
+
+	if command == "" {
+		err = session.Shell()
+		if err != nil {
+			return err
+		}
+		return session.Wait()
+	}
+	return session.Run(command)
+}
+
+// echoClient copies stdin to the connection, and the connection to
+// stdout.
+func echoClient(c *client.Client) error {
+	conn, err := c.Dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if peers := conn.ConnectionState().PeerCertificates; len(peers) > 0 {
+		log.Printf("client: server common name: %s", peers[0].Subject.CommonName)
+	}
+
+	go io.Copy(conn, os.Stdin)
+	_, err = io.Copy(os.Stdout, conn)
+	return err
+}
+
+func init() {
+	clientCommand.PersistentFlags().StringVar(&clientFlags.config, "config", "", "TLS config file (YAML or JSON)")
+	clientCommand.PersistentFlags().StringVar(&clientFlags.addr, "addr", server.DefaultAddr, "address to connect to")
+	clientCommand.PersistentFlags().StringVarP(&clientFlags.user, "user", "l", "", "local user to log in as, defaults to the user the client cert maps to")
+	clientCommand.Flags().BoolVar(&clientFlags.echo, "echo", false, "copy stdin and stdout to an echo server instead of running an SSH session")
+}
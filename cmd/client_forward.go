@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/picatz/mtls/mtlsssh"
+	"github.com/spf13/cobra"
+)
+
+var clientForwardFlags = struct {
+	local  []string
+	remote []string
+}{}
+
+var clientForwardCommand = &cobra.Command{
+	Use:   "forward",
+	Short: "forward TCP ports through the mTLS SSH server, like ssh -L and -R",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(clientForwardFlags.local) == 0 && len(clientForwardFlags.remote) == 0 {
+			return fmt.Errorf("at least one -L or -R forward is required")
+		}
+
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		sshClient, err := mtlsssh.Dial(c, clientFlags.user)
+		if err != nil {
+			return err
+		}
+		defer sshClient.Close()
+
+		var forwarders []*mtlsssh.Forwarder
+		defer func() {
+			for _, f := range forwarders {
+				f.Close()
+			}
+		}()
+
+		for _, spec := range clientForwardFlags.local {
+			f, err := mtlsssh.ParseForward(spec)
+			if err != nil {
+				return err
+			}
+			forwarder, err := mtlsssh.LocalForward(sshClient, f)
+			if err != nil {
+				return err
+			}
+			forwarders = append(forwarders, forwarder)
+			log.Printf("client: forwarding local %s to %s", forwarder.Addr(), f.TargetAddr)
+			go forwarder.Serve()
+		}
+		for _, spec := range clientForwardFlags.remote {
+			f, err := mtlsssh.ParseForward(spec)
+			if err != nil {
+				return err
+			}
+			forwarder, err := mtlsssh.RemoteForward(sshClient, f)
+			if err != nil {
+				return err
+			}
+			forwarders = append(forwarders, forwarder)
+			log.Printf("client: forwarding remote %s to %s", forwarder.Addr(), f.TargetAddr)
+			go forwarder.Serve()
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- sshClient.Wait()
+		}()
+
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		select {
+		case <-interrupt:
+			return nil
+		case err := <-done:
+			return fmt.Errorf("connection closed: %v", err)
+		}
+	},
+}
+
+func init() {
+	flags := clientForwardCommand.Flags()
+	flags.StringArrayVarP(&clientForwardFlags.local, "local", "L", nil, "[bind_address:]port:host:hostport to listen on locally and forward through the server")
+	flags.StringArrayVarP(&clientForwardFlags.remote, "remote", "R", nil, "[bind_address:]port:host:hostport for the server to listen on and forward back through the client")
+
+	clientCommand.AddCommand(clientForwardCommand)
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// watchWindowSize sends the terminal's size to the session whenever it
+// changes, until the returned function is called.
+func watchWindowSize(fd int, session *ssh.Session) func() {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		for range winch {
+			width, height, err := term.GetSize(fd)
+			if err == nil {
+				session.WindowChange(height, width)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(winch)
+		close(winch)
+	}
+}
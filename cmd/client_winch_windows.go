@@ -0,0 +1,8 @@
+package main
+
+import "golang.org/x/crypto/ssh"
+
+// watchWindowSize does nothing on Windows, which has no SIGWINCH.
+func watchWindowSize(fd int, session *ssh.Session) func() {
+	return func() {}
+}
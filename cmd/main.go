@@ -10,5 +10,6 @@ func main() {
 	rootCmd.AddCommand(clientCommand)
 	rootCmd.AddCommand(certCommand)
 	rootCmd.AddCommand(proxyCommand)
+	rootCmd.AddCommand(auditCommand)
 	rootCmd.Execute()
 }
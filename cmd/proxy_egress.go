@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/picatz/mtls/proxy"
+	"github.com/spf13/cobra"
+)
+
+var proxyEgressFlags = struct {
+	addr         string
+	destinations string
+}{}
+
+var proxyEgressCommand = &cobra.Command{
+	Use:   "egress",
+	Short: "HTTP forward proxy for local apps, originating mTLS with a client cert per destination",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if proxyEgressFlags.destinations == "" {
+			return fmt.Errorf("--destinations is required")
+		}
+
+		config, err := proxy.LoadEgressConfig(proxyEgressFlags.destinations)
+		if err != nil {
+			return err
+		}
+		egress, err := proxy.NewEgress(config)
+		if err != nil {
+			return err
+		}
+
+		listener, err := net.Listen("tcp", proxyEgressFlags.addr)
+		if err != nil {
+			return err
+		}
+		s := &http.Server{
+			Handler:           egress,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		log.Printf("proxy: listening on %s", listener.Addr())
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- s.Serve(listener)
+		}()
+
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		select {
+		case err := <-errs:
+			return err
+		case <-interrupt:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err = s.Shutdown(ctx)
+		if err != nil && err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	flags := proxyEgressCommand.Flags()
+	flags.StringVar(&proxyEgressFlags.addr, "addr", proxy.DefaultEgressAddr, "address to listen on for local apps")
+	flags.StringVar(&proxyEgressFlags.destinations, "destinations", "", "YAML or JSON file with the client cert and CA bundle for each destination")
+
+	proxyCommand.AddCommand(proxyEgressCommand)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/picatz/mtls/mtlshttp"
+	"github.com/picatz/mtls/proxy"
+	"github.com/picatz/mtls/server"
+	"github.com/picatz/mtls/tlsconf"
+	"github.com/spf13/cobra"
+)
+
+var proxyReverseFlags = struct {
+	config string
+	addr   string
+	routes string
+}{}
+
+var proxyReverseCommand = &cobra.Command{
+	Use:   "reverse",
+	Short: "terminate mTLS and proxy HTTP requests to plaintext backends, adding identity headers",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if proxyReverseFlags.config == "" {
+			return fmt.Errorf("--config is required")
+		}
+		if proxyReverseFlags.routes == "" {
+			return fmt.Errorf("--routes is required")
+		}
+
+		tlsConfig, err := tlsconf.FromFile(proxyReverseFlags.config)
+		if err != nil {
+			return err
+		}
+		routes, err := proxy.LoadReverseConfig(proxyReverseFlags.routes)
+		if err != nil {
+			return err
+		}
+		reverse, err := proxy.NewReverse(routes)
+		if err != nil {
+			return err
+		}
+
+		s, err := mtlshttp.NewServer(reverse,
+			server.WithAddr(proxyReverseFlags.addr),
+			server.WithTLSConfig(tlsConfig),
+		)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("proxy: listening on %s", s.Addr())
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- s.Serve()
+		}()
+
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		select {
+		case err := <-errs:
+			return err
+		case <-interrupt:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err = s.Shutdown(ctx)
+		if err != nil && err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	flags := proxyReverseCommand.Flags()
+	flags.StringVar(&proxyReverseFlags.config, "config", "", "TLS config file (YAML or JSON)")
+	flags.StringVar(&proxyReverseFlags.addr, "addr", server.DefaultAddr, "address to listen on")
+	flags.StringVar(&proxyReverseFlags.routes, "routes", "", "YAML or JSON file with the routes and identity headers")
+
+	proxyCommand.AddCommand(proxyReverseCommand)
+}
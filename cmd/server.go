@@ -1,14 +1,130 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/picatz/mtls/authz"
+	"github.com/picatz/mtls/identity"
+	"github.com/picatz/mtls/mtlsssh"
+	"github.com/picatz/mtls/server"
+	"github.com/picatz/mtls/tlsconf"
 	"github.com/spf13/cobra"
 )
 
+var serverFlags = struct {
+	config    string
+	addr      string
+	users     string
+	minUID    int
+	acceptEnv []string
+	policy    string
+	shell     string
+	echo      bool
+}{}
+
 var serverCommand = &cobra.Command{
 	Use:   "server",
 	Short: "mTLS SSH server commands",
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Not yet implemented!")
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if serverFlags.config == "" {
+			return fmt.Errorf("--config is required")
+		}
+
+		tlsConfig, err := tlsconf.FromFile(serverFlags.config)
+		if err != nil {
+			return err
+		}
+
+		handler := echoHandler
+		if !serverFlags.echo {
+			handler, err = sshHandler(tlsConfig)
+			if err != nil {
+				return err
+			}
+		}
+
+		s, err := server.New(
+			server.WithAddr(serverFlags.addr),
+			server.WithTLSConfig(tlsConfig),
+			server.WithHandler(handler),
+		)
+		if err != nil {
+			return err
+		}
+		defer s.Shutdown()
+		s.Start()
+
+		log.Printf("server: listening on %s", s.Listener().Addr())
+
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		<-interrupt
+		return nil
 	},
 }
+
+// sshHandler runs SSH sessions over each connection, using the server's
+// TLS certificate as the host key.
+func sshHandler(tlsConfig *tls.Config) (func(*tls.Conn), error) {
+	if len(tlsConfig.Certificates) == 0 {
+		return nil, fmt.Errorf("the TLS config has no certificate to use as the SSH host key")
+	}
+
+	opts := []mtlsssh.Option{
+		mtlsssh.WithShell(serverFlags.shell),
+		mtlsssh.WithMinUID(serverFlags.minUID),
+		mtlsssh.WithAcceptEnv(serverFlags.acceptEnv...),
+	}
+	if serverFlags.users != "" {
+		table, err := identity.LoadTable(serverFlags.users)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, mtlsssh.WithMapper(table))
+	}
+	if serverFlags.policy != "" {
+		policy, err := authz.LoadPolicy(serverFlags.policy)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, mtlsssh.WithAuthorizer(policy))
+	}
+
+	sshServer, err := mtlsssh.NewServer(tlsConfig.Certificates[0], opts...)
+	if err != nil {
+		return nil, err
+	}
+	return sshServer.HandleConn, nil
+}
+
+// echoHandler writes everything read from the connection back to it.
+func echoHandler(conn *tls.Conn) {
+	defer conn.Close()
+
+	err := conn.Handshake()
+	if err != nil {
+		log.Printf("server: handshake-error: %s", err)
+		return
+	}
+	if peers := conn.ConnectionState().PeerCertificates; len(peers) > 0 {
+		log.Printf("server: client common name: %s", peers[0].Subject.CommonName)
+	}
+
+	io.Copy(conn, conn)
+}
+
+func init() {
+	serverCommand.Flags().StringVar(&serverFlags.config, "config", "", "TLS config file (YAML or JSON)")
+	serverCommand.Flags().StringVar(&serverFlags.addr, "addr", server.DefaultAddr, "address to listen on")
+	serverCommand.Flags().StringVar(&serverFlags.users, "users", "", "YAML or JSON file mapping client identities to local users, instead of using their common names")
+	serverCommand.Flags().StringVar(&serverFlags.policy, "policy", "", "YAML or JSON file with the port forwarding rules for each client identity, forwarding is denied without one")
+	serverCommand.Flags().IntVar(&serverFlags.minUID, "min-uid", mtlsssh.DefaultMinUID, "lowest uid of the local users clients may log in as, use 0 to allow root")
+	serverCommand.Flags().StringSliceVar(&serverFlags.acceptEnv, "accept-env", mtlsssh.DefaultAcceptEnv, "environment variables clients may set, which may use wildcards")
+	serverCommand.Flags().StringVar(&serverFlags.shell, "shell", mtlsssh.DefaultShell, "shell used for sessions")
+	serverCommand.Flags().BoolVar(&serverFlags.echo, "echo", false, "echo data back to clients instead of running SSH sessions")
+}
@@ -0,0 +1,80 @@
+// Package identity describes the peer of an mTLS connection, as
+// authenticated by its verified certificate.
+package identity
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// ErrNotVerified is returned when a connection has no verified peer
+// certificate to take an identity from.
+var ErrNotVerified = errors.New("no verified peer certificate")
+
+// Identity is the authenticated identity of an mTLS peer.
+type Identity struct {
+	CommonName         string   `json:"common_name"`
+	Organization       []string `json:"organization,omitempty"`
+	OrganizationalUnit []string `json:"organizational_unit,omitempty"`
+	DNSNames           []string `json:"dns_names,omitempty"`
+	EmailAddresses     []string `json:"email_addresses,omitempty"`
+	URIs               []string `json:"uris,omitempty"`
+	Serial             string   `json:"serial"`
+	Issuer             string   `json:"issuer"`
+
+	// Certificate is the verified peer certificate.
+	Certificate *x509.Certificate `json:"-"`
+}
+
+// FromCertificate returns the identity of a peer certificate, which
+// should already be verified.
+func FromCertificate(c *x509.Certificate) *Identity {
+	id := &Identity{
+		CommonName:         c.Subject.CommonName,
+		Organization:       c.Subject.Organization,
+		OrganizationalUnit: c.Subject.OrganizationalUnit,
+		DNSNames:           c.DNSNames,
+		EmailAddresses:     c.EmailAddresses,
+		Serial:             fmt.Sprintf("%x", c.SerialNumber),
+		Issuer:             c.Issuer.String(),
+		Certificate:        c,
+	}
+	for _, uri := range c.URIs {
+		id.URIs = append(id.URIs, uri.String())
+	}
+	return id
+}
+
+// FromConnectionState returns the identity of the peer's verified
+// certificate, or ErrNotVerified if the peer wasn't verified.
+func FromConnectionState(state tls.ConnectionState) (*Identity, error) {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, ErrNotVerified
+	}
+	return FromCertificate(state.VerifiedChains[0][0]), nil
+}
+
+// FromConn completes the handshake of the connection if needed, then
+// returns the identity of its verified peer.
+func FromConn(conn *tls.Conn) (*Identity, error) {
+	err := conn.Handshake()
+	if err != nil {
+		return nil, err
+	}
+	return FromConnectionState(conn.ConnectionState())
+}
+
+// Name is the identity's name used for mapping and policies: its first
+// URI SAN if it has one, such as a SPIFFE ID, or else its common name.
+func (id *Identity) Name() string {
+	if len(id.URIs) > 0 {
+		return id.URIs[0]
+	}
+	return id.CommonName
+}
+
+func (id *Identity) String() string {
+	return id.Name()
+}
@@ -0,0 +1,90 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCert(t *testing.T, opts ...cert.CertOption) *x509.Certificate {
+	caPEM, caPrivKeyPEM, err := cert.NewCA(cert.WithCommonName("ca"))
+	require.NoError(t, err)
+	certPEM, _, err := cert.NewClientFromCA(bytes.NewReader(caPrivKeyPEM), bytes.NewReader(caPEM), opts...)
+	require.NoError(t, err)
+	certs, err := cert.ParseCertificates(certPEM)
+	require.NoError(t, err)
+	return certs[0]
+}
+
+func TestIdentity(t *testing.T) {
+	spiffeID, err := url.Parse("spiffe://example.org/deploy")
+	require.NoError(t, err)
+
+	c := newTestCert(t, cert.WithCommonName("alice"), cert.WithOrganizationalUnit("payments"), cert.WithURIs(spiffeID))
+	id := FromCertificate(c)
+	require.Equal(t, "alice", id.CommonName)
+	require.Equal(t, []string{"payments"}, id.OrganizationalUnit)
+	require.Equal(t, "spiffe://example.org/deploy", id.Name())
+	require.Equal(t, "CN=ca", id.Issuer)
+	require.NotEmpty(t, id.Serial)
+
+	id = FromCertificate(newTestCert(t, cert.WithCommonName("bob")))
+	require.Equal(t, "bob", id.Name())
+
+	_, err = FromConnectionState(tls.ConnectionState{})
+	require.True(t, errors.Is(err, ErrNotVerified), err)
+
+	id, err = FromConnectionState(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{c}}})
+	require.NoError(t, err)
+	require.Equal(t, "alice", id.CommonName)
+}
+
+func TestMappers(t *testing.T) {
+	alice := FromCertificate(newTestCert(t, cert.WithCommonName("alice")))
+	anonymous := FromCertificate(newTestCert(t))
+
+	user, err := CommonNameMapper.LocalUser(alice)
+	require.NoError(t, err)
+	require.Equal(t, "alice", user)
+
+	_, err = CommonNameMapper.LocalUser(anonymous)
+	var unmappedErr *UnmappedError
+	require.True(t, errors.As(err, &unmappedErr), err)
+
+	dir, err := ioutil.TempDir("", "identity")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "users.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("users:\n  alice: deploy\n"), 0600))
+
+	table, err := LoadTable(path)
+	require.NoError(t, err)
+
+	user, err = table.LocalUser(alice)
+	require.NoError(t, err)
+	require.Equal(t, "deploy", user)
+
+	_, err = table.LocalUser(anonymous)
+	require.True(t, errors.As(err, &unmappedErr), err)
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	require.False(t, ok)
+
+	id := FromCertificate(newTestCert(t, cert.WithCommonName("alice")))
+	got, ok := FromContext(NewContext(context.Background(), id))
+	require.True(t, ok)
+	require.Equal(t, id, got)
+}
@@ -0,0 +1,74 @@
+package identity
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Mapper maps an identity to the name of a local user.
+type Mapper interface {
+	LocalUser(id *Identity) (string, error)
+}
+
+// MapperFunc implements a Mapper using a function.
+type MapperFunc func(id *Identity) (string, error)
+
+// LocalUser calls the function.
+func (f MapperFunc) LocalUser(id *Identity) (string, error) {
+	return f(id)
+}
+
+// CommonNameMapper maps identities to the local user with the same name
+// as their common name.
+var CommonNameMapper Mapper = MapperFunc(func(id *Identity) (string, error) {
+	if id.CommonName == "" {
+		return "", &UnmappedError{Name: id.Name()}
+	}
+	return id.CommonName, nil
+})
+
+// UnmappedError is returned when an identity doesn't map to a local
+// user.
+type UnmappedError struct {
+	Name string
+}
+
+func (e *UnmappedError) Error() string {
+	return fmt.Sprintf("identity %q is not mapped to a local user", e.Name)
+}
+
+// Table maps identity names, or common names, to local users.
+type Table map[string]string
+
+// LocalUser looks up the identity's name, then its common name.
+func (t Table) LocalUser(id *Identity) (string, error) {
+	if user, ok := t[id.Name()]; ok {
+		return user, nil
+	}
+	if user, ok := t[id.CommonName]; ok {
+		return user, nil
+	}
+	return "", &UnmappedError{Name: id.Name()}
+}
+
+// LoadTable reads a Table from a YAML (or JSON) file with a "users"
+// mapping of identity names to local users.
+func LoadTable(path string) (Table, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Users Table `yaml:"users"`
+	}
+	err = yaml.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", path, err)
+	}
+	if file.Users == nil {
+		file.Users = Table{}
+	}
+	return file.Users, nil
+}
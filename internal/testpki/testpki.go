@@ -0,0 +1,134 @@
+// Package testpki creates a throwaway CA and key pairs signed by it for
+// tests.
+package testpki
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/stretchr/testify/require"
+)
+
+// PKI is a CA, which fails its test if anything can't be created.
+type PKI struct {
+	t *testing.T
+
+	CAPEM        []byte
+	CAPrivKeyPEM []byte
+	// Pool contains the CA cert.
+	Pool *x509.CertPool
+}
+
+// New creates a new PKI with a CA named "ca".
+func New(t *testing.T) *PKI {
+	t.Helper()
+
+	caPEM, caPrivKeyPEM, err := cert.NewCA(cert.WithCommonName("ca"))
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(caPEM))
+
+	return &PKI{t: t, CAPEM: caPEM, CAPrivKeyPEM: caPrivKeyPEM, Pool: pool}
+}
+
+func (p *PKI) issue(newFromCA func(caPrivKeyPEM, caCertPEM io.Reader, opts ...cert.CertOption) ([]byte, []byte, error), opts []cert.CertOption) ([]byte, []byte) {
+	p.t.Helper()
+
+	certPEM, keyPEM, err := newFromCA(bytes.NewReader(p.CAPrivKeyPEM), bytes.NewReader(p.CAPEM), opts...)
+	require.NoError(p.t, err)
+	return certPEM, keyPEM
+}
+
+// ServerPEM issues a PEM encoded server cert and private key. Unless
+// overridden by the given options, the cert is named "server" and is
+// valid for localhost and 127.0.0.1.
+func (p *PKI) ServerPEM(opts ...cert.CertOption) ([]byte, []byte) {
+	p.t.Helper()
+
+	allOpts := []cert.CertOption{
+		cert.WithCommonName("server"),
+		cert.WithDNSNames("localhost"),
+		cert.WithIPAddresses(net.ParseIP("127.0.0.1")),
+	}
+	allOpts = append(allOpts, opts...)
+	return p.issue(cert.NewServerFromCA, allOpts)
+}
+
+// ClientPEM issues a PEM encoded client cert and private key.
+func (p *PKI) ClientPEM(opts ...cert.CertOption) ([]byte, []byte) {
+	p.t.Helper()
+	return p.issue(cert.NewClientFromCA, opts)
+}
+
+// KeyPair parses a PEM encoded cert and private key, setting its leaf.
+func (p *PKI) KeyPair(certPEM, keyPEM []byte) tls.Certificate {
+	p.t.Helper()
+
+	keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(p.t, err)
+
+	keyPair.Leaf, err = x509.ParseCertificate(keyPair.Certificate[0])
+	require.NoError(p.t, err)
+	return keyPair
+}
+
+// Server issues a server key pair, like ServerPEM.
+func (p *PKI) Server(opts ...cert.CertOption) tls.Certificate {
+	p.t.Helper()
+	return p.KeyPair(p.ServerPEM(opts...))
+}
+
+// Client issues a client key pair, like ClientPEM.
+func (p *PKI) Client(opts ...cert.CertOption) tls.Certificate {
+	p.t.Helper()
+	return p.KeyPair(p.ClientPEM(opts...))
+}
+
+// ServerTLSConfig returns a TLS config presenting a server key pair
+// issued with the given options, which requires and verifies client
+// certs issued by the CA.
+func (p *PKI) ServerTLSConfig(opts ...cert.CertOption) *tls.Config {
+	p.t.Helper()
+	return &tls.Config{
+		Certificates: []tls.Certificate{p.Server(opts...)},
+		ClientCAs:    p.Pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+}
+
+// ClientTLSConfig returns a TLS config presenting a client key pair
+// issued with the given options, which trusts the CA.
+func (p *PKI) ClientTLSConfig(opts ...cert.CertOption) *tls.Config {
+	p.t.Helper()
+	return &tls.Config{
+		Certificates: []tls.Certificate{p.Client(opts...)},
+		RootCAs:      p.Pool,
+	}
+}
+
+// WriteCA writes the CA's cert and private key into dir as ca.pem and
+// ca.key.pem, returning their paths.
+func (p *PKI) WriteCA(dir string) (string, string) {
+	p.t.Helper()
+	return p.Write(dir, "ca", p.CAPEM, p.CAPrivKeyPEM)
+}
+
+// Write writes a PEM encoded cert and private key into dir as
+// name.pem and name.key.pem, returning their paths.
+func (p *PKI) Write(dir, name string, certPEM, keyPEM []byte) (string, string) {
+	p.t.Helper()
+
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+".key.pem")
+	require.NoError(p.t, ioutil.WriteFile(certFile, certPEM, 0600))
+	require.NoError(p.t, ioutil.WriteFile(keyFile, keyPEM, 0600))
+	return certFile, keyFile
+}
@@ -0,0 +1,158 @@
+// Package mtlsgrpc provides gRPC transport credentials built from tlsconf
+// options, and interceptors authorizing calls using the identity of the
+// peer's verified cert.
+package mtlsgrpc
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/picatz/mtls/identity"
+	"github.com/picatz/mtls/tlsconf"
+	"google.golang.org/grpc/credentials"
+)
+
+// AuthInfo is the credentials.AuthInfo of connections made using
+// Credentials, returned by peer.FromContext.
+type AuthInfo struct {
+	credentials.TLSInfo
+
+	// Identity is the identity of the peer's verified cert, or nil if
+	// the peer wasn't verified.
+	Identity *identity.Identity
+}
+
+func newAuthInfo(info credentials.AuthInfo) credentials.AuthInfo {
+	tlsInfo, ok := info.(credentials.TLSInfo)
+	if !ok {
+		return info
+	}
+	authInfo := AuthInfo{TLSInfo: tlsInfo}
+	authInfo.Identity, _ = identity.FromConnectionState(tlsInfo.State)
+	return authInfo
+}
+
+// Credentials implements credentials.TransportCredentials using a TLS
+// config built from tlsconf options. The config can be rebuilt while in
+// use, reading its files again, and is used by every new connection.
+type Credentials struct {
+	*reloader
+	serverName string
+}
+
+// reloader is shared by every clone of the same Credentials.
+type reloader struct {
+	opts []tlsconf.TLSConfigOption
+
+	mu    sync.RWMutex
+	creds credentials.TransportCredentials
+}
+
+// NewServerCredentials creates Credentials for a gRPC server, built
+// using the given tlsconf option(s). Clients must present a cert that
+// is verified by the config's client CAs.
+func NewServerCredentials(opts ...tlsconf.TLSConfigOption) (*Credentials, error) {
+	return newCredentials(append(opts, tlsconf.WithMutualAuthentication()))
+}
+
+// NewClientCredentials creates Credentials for a gRPC client, built using
+// the given tlsconf option(s).
+func NewClientCredentials(opts ...tlsconf.TLSConfigOption) (*Credentials, error) {
+	return newCredentials(opts)
+}
+
+func newCredentials(opts []tlsconf.TLSConfigOption) (*Credentials, error) {
+	c := &Credentials{reloader: &reloader{opts: opts}}
+	err := c.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload rebuilds the TLS config from the options. Existing connections
+// are not affected. If building the config fails, the current config is
+// kept.
+func (r *reloader) Reload() error {
+	config, err := tlsconf.Build(r.opts...)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.creds = credentials.NewTLS(config)
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Run reloads the TLS config every interval until the context is done.
+// Failed reloads are logged and retried on the next interval.
+func (r *reloader) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			err := r.Reload()
+			if err != nil {
+				log.Printf("mtlsgrpc: failed to reload TLS config: %s", err)
+			}
+		}
+	}
+}
+
+func (c *Credentials) current() credentials.TransportCredentials {
+	c.mu.RLock()
+	creds := c.creds
+	c.mu.RUnlock()
+
+	if c.serverName != "" {
+		creds = creds.Clone()
+		creds.OverrideServerName(c.serverName)
+	}
+	return creds
+}
+
+// ClientHandshake implements credentials.TransportCredentials.
+func (c *Credentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, info, err := c.current().ClientHandshake(ctx, authority, rawConn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, newAuthInfo(info), nil
+}
+
+// ServerHandshake implements credentials.TransportCredentials.
+func (c *Credentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, info, err := c.current().ServerHandshake(rawConn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, newAuthInfo(info), nil
+}
+
+// Info implements credentials.TransportCredentials.
+func (c *Credentials) Info() credentials.ProtocolInfo {
+	return c.current().Info()
+}
+
+// Clone implements credentials.TransportCredentials. Clones share the
+// TLS config, so reloading one reloads all of them.
+func (c *Credentials) Clone() credentials.TransportCredentials {
+	return &Credentials{reloader: c.reloader, serverName: c.serverName}
+}
+
+// OverrideServerName implements credentials.TransportCredentials.
+//
+// Deprecated: use grpc.WithAuthority or tlsconf.WithServerName instead.
+func (c *Credentials) OverrideServerName(serverName string) error {
+	c.serverName = serverName
+	return nil
+}
@@ -0,0 +1,75 @@
+package mtlsgrpc
+
+import (
+	"context"
+
+	"github.com/picatz/mtls/authz"
+	"github.com/picatz/mtls/identity"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// PeerIdentity returns the identity of the verified cert of the peer of
+// an RPC, using the peer's AuthInfo.
+func PeerIdentity(ctx context.Context) (*identity.Identity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	info, ok := p.AuthInfo.(AuthInfo)
+	if !ok || info.Identity == nil {
+		return nil, false
+	}
+	return info.Identity, true
+}
+
+// authorize authorizes calling the method, returning the context to
+// handle the call with, which carries the peer's identity.
+func authorize(ctx context.Context, authorizer authz.Authorizer, method string) (context.Context, error) {
+	id, ok := PeerIdentity(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "no verified client certificate")
+	}
+	err := authorizer.Authorize(id, authz.ActionCall, method)
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return identity.NewContext(ctx, id), nil
+}
+
+// UnaryServerInterceptor authorizes each unary call to a method using the
+// identity of the client's verified cert. Handlers can read the identity
+// using identity.FromContext.
+func UnaryServerInterceptor(authorizer authz.Authorizer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authorize(ctx, authorizer, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor authorizes each streaming call to a method,
+// like UnaryServerInterceptor.
+func StreamServerInterceptor(authorizer authz.Authorizer) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), authorizer, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// serverStream overrides the context of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
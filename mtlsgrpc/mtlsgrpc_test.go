@@ -0,0 +1,175 @@
+package mtlsgrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/picatz/mtls/authz"
+	"github.com/picatz/mtls/cert"
+	"github.com/picatz/mtls/identity"
+	"github.com/picatz/mtls/internal/testpki"
+	"github.com/picatz/mtls/tlsconf"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const testPolicy = `
+rules:
+  - identities: [alice]
+    call: ["/grpc.health.v1.Health/*"]
+  - identities: [bob]
+    call: ["/grpc.health.v1.Health/Check"]
+`
+
+// writeCA writes the CA cert into dir, since the credentials load
+// their CAs from files, returning its path.
+func writeCA(t *testing.T, p *testpki.PKI, dir string) string {
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, ioutil.WriteFile(caFile, p.CAPEM, 0644))
+	return caFile
+}
+
+// writeServer writes a server cert and key pair into dir, returning
+// their paths.
+func writeServer(p *testpki.PKI, dir string) (string, string) {
+	certPEM, keyPEM := p.ServerPEM(cert.WithCommonName("server"))
+	return p.Write(dir, "server", certPEM, keyPEM)
+}
+
+// startServer serves the health service with a server cert written into
+// dir, returning the server's credentials and address.
+func startServer(t *testing.T, p *testpki.PKI, dir string, opts ...grpc.ServerOption) (*Credentials, string) {
+	certFile, keyFile := writeServer(p, dir)
+	creds, err := NewServerCredentials(
+		tlsconf.WithX509KeyPair(certFile, keyFile),
+		tlsconf.WithCAFile(writeCA(t, p, dir)),
+	)
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := grpc.NewServer(append(opts, grpc.Creds(creds))...)
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	return creds, listener.Addr().String()
+}
+
+// dial connects to the server in dir with a client cert for the common
+// name.
+func dial(t *testing.T, p *testpki.PKI, dir, addr, commonName string) healthpb.HealthClient {
+	creds, err := NewClientCredentials(
+		tlsconf.WithCertificates([]tls.Certificate{p.Client(cert.WithCommonName(commonName))}),
+		tlsconf.WithRootCAFile(filepath.Join(dir, "ca.pem")),
+		tlsconf.WithServerName("localhost"),
+	)
+	require.NoError(t, err)
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestCredentialsPeerIdentity(t *testing.T) {
+	p, dir := testpki.New(t), t.TempDir()
+
+	var seen *identity.Identity
+	_, addr := startServer(t, p, dir, grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		seen, _ = PeerIdentity(ctx)
+		return handler(ctx, req)
+	}))
+
+	var server peer.Peer
+	_, err := dial(t, p, dir, addr, "alice").Check(context.Background(), &healthpb.HealthCheckRequest{}, grpc.Peer(&server))
+	require.NoError(t, err)
+
+	require.NotNil(t, seen)
+	require.Equal(t, "alice", seen.CommonName)
+
+	info, ok := server.AuthInfo.(AuthInfo)
+	require.True(t, ok)
+	require.Equal(t, "server", info.Identity.CommonName)
+	require.Equal(t, "tls", info.AuthType())
+}
+
+func TestCredentialsReload(t *testing.T) {
+	p, dir := testpki.New(t), t.TempDir()
+	creds, addr := startServer(t, p, dir)
+
+	serverSerial := func() string {
+		var server peer.Peer
+		_, err := dial(t, p, dir, addr, "alice").Check(context.Background(), &healthpb.HealthCheckRequest{}, grpc.Peer(&server))
+		require.NoError(t, err)
+		return server.AuthInfo.(AuthInfo).Identity.Serial
+	}
+
+	before := serverSerial()
+	certFile, _ := writeServer(p, dir)
+	require.Equal(t, before, serverSerial())
+
+	require.NoError(t, creds.Reload())
+	require.NotEqual(t, before, serverSerial())
+
+	// a failed reload keeps the current config
+	require.NoError(t, os.Remove(certFile))
+	require.Error(t, creds.Reload())
+	serverSerial()
+}
+
+func TestInterceptors(t *testing.T) {
+	p, dir := testpki.New(t), t.TempDir()
+	policy, err := authz.ParsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+
+	var handled *identity.Identity
+	_, addr := startServer(t, p, dir,
+		grpc.ChainUnaryInterceptor(
+			UnaryServerInterceptor(policy),
+			func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				handled, _ = identity.FromContext(ctx)
+				return handler(ctx, req)
+			},
+		),
+		grpc.StreamInterceptor(StreamServerInterceptor(policy)),
+	)
+
+	watch := func(client healthpb.HealthClient) error {
+		stream, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+		if err != nil {
+			return err
+		}
+		_, err = stream.Recv()
+		return err
+	}
+
+	alice := dial(t, p, dir, addr, "alice")
+	_, err = alice.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "alice", handled.CommonName)
+	require.NoError(t, watch(alice))
+
+	bob := dial(t, p, dir, addr, "bob")
+	_, err = bob.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	err = watch(bob)
+	require.Equal(t, codes.PermissionDenied, status.Code(err), fmt.Sprint(err))
+
+	mallory := dial(t, p, dir, addr, "mallory")
+	_, err = mallory.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.Equal(t, codes.PermissionDenied, status.Code(err), fmt.Sprint(err))
+}
@@ -0,0 +1,148 @@
+package mtlshttp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/picatz/mtls/client"
+	"github.com/picatz/mtls/identity"
+	"github.com/picatz/mtls/internal/testpki"
+	"github.com/picatz/mtls/renew"
+	"github.com/picatz/mtls/server"
+	"github.com/stretchr/testify/require"
+)
+
+// startServer serves the handler over mTLS, returning the base URL.
+func startServer(t *testing.T, p *testpki.PKI, clientAuth tls.ClientAuthType, h http.Handler) string {
+	tlsConfig := p.ServerTLSConfig()
+	tlsConfig.ClientAuth = clientAuth
+
+	s, err := NewServer(h,
+		server.WithAddr("127.0.0.1:0"),
+		server.WithTLSConfig(tlsConfig),
+	)
+	require.NoError(t, err)
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+
+	return fmt.Sprintf("https://localhost:%d", s.Addr().(*net.TCPAddr).Port)
+}
+
+func get(t *testing.T, rt http.RoundTripper, url string) (int, string) {
+	resp, err := (&http.Client{Transport: rt}).Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+var whoami = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	id, ok := identity.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "no identity", http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s %s %d %s", id.Name(), id.Serial, r.ProtoMajor, r.RemoteAddr)
+})
+
+func TestServerTransport(t *testing.T) {
+	p := testpki.New(t)
+	url := startServer(t, p, tls.RequireAndVerifyClientCert, whoami)
+
+	rt, err := NewTransport(client.WithTLSConfig(p.ClientTLSConfig(cert.WithCommonName("alice"))))
+	require.NoError(t, err)
+	defer rt.Close()
+
+	status, first := get(t, rt, url)
+	require.Equal(t, http.StatusOK, status, first)
+	var name, serial, remote string
+	var proto int
+	_, err = fmt.Sscanf(first, "%s %s %d %s", &name, &serial, &proto, &remote)
+	require.NoError(t, err)
+	require.Equal(t, "alice", name)
+	require.Equal(t, 2, proto)
+
+	// the connection is reused
+	_, second := get(t, rt, url)
+	require.Equal(t, first, second)
+}
+
+func TestTransportAddr(t *testing.T) {
+	p := testpki.New(t)
+	url := startServer(t, p, tls.RequireAndVerifyClientCert, whoami)
+
+	tlsConfig := p.ClientTLSConfig(cert.WithCommonName("alice"))
+	tlsConfig.ServerName = "localhost"
+
+	rt, err := NewTransport(
+		client.WithAddr(url[len("https://"):]),
+		client.WithTLSConfig(tlsConfig),
+	)
+	require.NoError(t, err)
+	defer rt.Close()
+
+	status, body := get(t, rt, "https://service.internal/")
+	require.Equal(t, http.StatusOK, status, body)
+}
+
+func TestHandlerRequiresVerifiedCert(t *testing.T) {
+	p := testpki.New(t)
+	url := startServer(t, p, tls.VerifyClientCertIfGiven, whoami)
+
+	rt, err := NewTransport(client.WithTLSConfig(&tls.Config{RootCAs: p.Pool}))
+	require.NoError(t, err)
+	defer rt.Close()
+
+	status, _ := get(t, rt, url)
+	require.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestTransportRenewal(t *testing.T) {
+	p := testpki.New(t)
+	url := startServer(t, p, tls.RequireAndVerifyClientCert, whoami)
+
+	dir := t.TempDir()
+	caFile, caKeyFile := p.WriteCA(dir)
+	certPEM, keyPEM := p.ClientPEM(cert.WithCommonName("alice"))
+	certFile, keyFile := p.Write(dir, "alice", certPEM, keyPEM)
+	agent, err := renew.New(certFile, keyFile, &renew.LocalCA{
+		CACertFile: caFile,
+		CAKeyFile:  caKeyFile,
+	})
+	require.NoError(t, err)
+
+	rt, err := NewTransport(
+		client.WithTLSConfig(&tls.Config{RootCAs: p.Pool}),
+		client.WithRenewAgent(agent),
+	)
+	require.NoError(t, err)
+	defer rt.Close()
+
+	_, before := get(t, rt, url)
+
+	require.NoError(t, agent.Renew(context.Background()))
+	renewed := fmt.Sprintf("%x", agent.Certificate().Leaf.SerialNumber)
+
+	// new connections are made once the transport sees the renewal
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, after := get(t, rt, url)
+		var name, serial string
+		_, err = fmt.Sscanf(after, "%s %s", &name, &serial)
+		require.NoError(t, err)
+		if serial == renewed {
+			require.NotEqual(t, before, after)
+			break
+		}
+		require.True(t, time.Now().Before(deadline), "renewed cert not presented")
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,102 @@
+// Package mtlshttp serves and makes HTTP requests over mTLS connections
+// built from the server and client packages.
+package mtlshttp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/picatz/mtls/identity"
+	"github.com/picatz/mtls/server"
+)
+
+// DefaultReadHeaderTimeout is how long a Server waits for the headers of
+// a request.
+const DefaultReadHeaderTimeout = 10 * time.Second
+
+// DefaultIdleTimeout is how long a Server keeps an idle connection open.
+const DefaultIdleTimeout = 2 * time.Minute
+
+// Server serves an http.Handler on the listener of a server.Server,
+// with the identity of the verified client cert in each request's
+// context.
+type Server struct {
+	server     *server.Server
+	httpServer *http.Server
+}
+
+// NewServer creates a Server listening with the given server Option(s).
+// HTTP/2 is offered unless the TLS config sets its own NextProtos.
+func NewServer(handler http.Handler, opts ...server.Option) (*Server, error) {
+	s, err := server.New(append(opts, withHTTPProtos)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		server: s,
+		httpServer: &http.Server{
+			Handler:           Handler(handler),
+			ReadHeaderTimeout: DefaultReadHeaderTimeout,
+			IdleTimeout:       DefaultIdleTimeout,
+		},
+	}, nil
+}
+
+// withHTTPProtos offers HTTP/2 and HTTP/1.1 using ALPN.
+func withHTTPProtos(o *server.Options) error {
+	if o.TLSConfig == nil || len(o.TLSConfig.NextProtos) > 0 {
+		return nil
+	}
+	o.TLSConfig = o.TLSConfig.Clone()
+	o.TLSConfig.NextProtos = []string{"h2", "http/1.1"}
+	return nil
+}
+
+// HTTPServer returns the underlying http.Server, so its timeouts and
+// logger can be changed before calling Serve.
+func (s *Server) HTTPServer() *http.Server {
+	return s.httpServer
+}
+
+// Addr returns the address the Server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.server.Listener().Addr()
+}
+
+// Serve accepts connections until the Server is shut down or closed,
+// when http.ErrServerClosed is returned.
+func (s *Server) Serve() error {
+	return s.httpServer.Serve(s.server.Listener())
+}
+
+// Shutdown gracefully stops the Server, waiting for active requests to
+// finish until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
+
+// Close immediately closes the Server and its connections.
+func (s *Server) Close() error {
+	return s.httpServer.Close()
+}
+
+// Handler adds the identity of the verified client cert to the context
+// of each request, which can be read using identity.FromContext.
+// Requests without a verified client cert are rejected.
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		id, err := identity.FromConnectionState(*r.TLS)
+		if err != nil {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(identity.NewContext(r.Context(), id)))
+	})
+}
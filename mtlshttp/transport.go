@@ -0,0 +1,123 @@
+package mtlshttp
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/picatz/mtls/client"
+	"github.com/picatz/mtls/renew"
+)
+
+// Transport is an http.RoundTripper making requests over mTLS
+// connections built from client options. Connections are reused between
+// requests. When the client cert comes from a renewal agent, every
+// renewal starts a new pool of connections, so new requests present the
+// renewed cert while requests in flight finish on their connections.
+type Transport struct {
+	addr      string
+	tlsConfig *tls.Config
+
+	mu        sync.RWMutex
+	transport *http.Transport
+
+	agent     *renew.Agent
+	events    <-chan renew.Event
+	closeOnce sync.Once
+}
+
+// NewTransport creates a Transport using the given client Option(s). If
+// an address is set, every connection is made to it, whatever the host
+// of the request URL, which is still used to verify the server.
+func NewTransport(opts ...client.Option) (*Transport, error) {
+	c, err := client.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Transport{
+		addr:      c.Addr(),
+		tlsConfig: c.TLSConfig(),
+		agent:     c.Agent(),
+	}
+	t.transport = t.newTransport()
+
+	if t.agent != nil {
+		t.events = t.agent.Subscribe()
+		go func() {
+			// the channel is closed when the Transport is
+			for event := range t.events {
+				if event.Err == nil {
+					t.rotate()
+				}
+			}
+		}()
+	}
+
+	return t, nil
+}
+
+func (t *Transport) newTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       t.tlsConfig,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	if t.addr != "" {
+		transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, t.addr)
+		}
+	}
+	return transport
+}
+
+// rotate replaces the pool of connections. Connections of the previous
+// pool are closed once idle, after its idle timeout at the latest.
+func (t *Transport) rotate() {
+	t.mu.Lock()
+	previous := t.transport
+	t.transport = t.newTransport()
+	t.mu.Unlock()
+
+	previous.CloseIdleConnections()
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.RLock()
+	transport := t.transport
+	t.mu.RUnlock()
+
+	return transport.RoundTrip(req)
+}
+
+// CloseIdleConnections closes connections not used by a request.
+func (t *Transport) CloseIdleConnections() {
+	t.mu.RLock()
+	transport := t.transport
+	t.mu.RUnlock()
+
+	transport.CloseIdleConnections()
+}
+
+// Close stops watching for renewed certs and closes idle connections.
+func (t *Transport) Close() error {
+	t.closeOnce.Do(func() {
+		if t.agent != nil {
+			t.agent.Unsubscribe(t.events)
+		}
+	})
+	t.CloseIdleConnections()
+	return nil
+}
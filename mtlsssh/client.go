@@ -0,0 +1,72 @@
+package mtlsssh
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"github.com/picatz/mtls/client"
+	"golang.org/x/crypto/ssh"
+)
+
+// NewClient runs the SSH client handshake over an mTLS connection. The
+// user may be empty to log in as the local user the client's identity
+// maps to.
+func NewClient(conn *tls.Conn, user string) (*ssh.Client, error) {
+	err := conn.Handshake()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ClientConfig{
+		User: user,
+		Auth: []ssh.AuthMethod{
+			// the server authenticates the client by its TLS certificate,
+			// so there are no questions to answer
+			ssh.KeyboardInteractive(func(string, string, []string, []bool) ([]string, error) {
+				return nil, nil
+			}),
+		},
+		HostKeyCallback: HostKeyCallback(conn.ConnectionState()),
+	}
+
+	sshConn, channels, requests, err := ssh.NewClientConn(conn, conn.RemoteAddr().String(), config)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewClient(sshConn, channels, requests), nil
+}
+
+// Dial connects to an mTLS SSH server using the client, then runs the
+// SSH client handshake.
+func Dial(c *client.Client, user string) (*ssh.Client, error) {
+	conn, err := c.Dial()
+	if err != nil {
+		return nil, err
+	}
+	sshClient, err := NewClient(conn, user)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return sshClient, nil
+}
+
+// HostKeyCallback accepts only the SSH host key matching the public key
+// of the server's verified TLS certificate.
+func HostKeyCallback(state tls.ConnectionState) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if len(state.PeerCertificates) == 0 {
+			return fmt.Errorf("no server certificate to check the host key against")
+		}
+		want, err := ssh.NewPublicKey(state.PeerCertificates[0].PublicKey)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(want.Marshal(), key.Marshal()) {
+			return fmt.Errorf("host key does not match the server's TLS certificate")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,63 @@
+//go:build !windows
+// +build !windows
+
+package mtlsssh
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// setCredential runs the command as the given user, which requires
+// root unless it's the user the server runs as.
+func setCredential(cmd *exec.Cmd, u *user.User) error {
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return err
+	}
+	if uint64(os.Getuid()) == uid {
+		return nil
+	}
+	if os.Getuid() != 0 {
+		return fmt.Errorf("running commands as %q requires root", u.Username)
+	}
+	groupIDs, err := u.GroupIds()
+	if err != nil {
+		return fmt.Errorf("failed to look up the groups of %q: %w", u.Username, err)
+	}
+	// without supplementary groups, the command would only have the
+	// user's primary group
+	groups := make([]uint32, 0, len(groupIDs))
+	for _, groupID := range groupIDs {
+		group, err := strconv.ParseUint(groupID, 10, 32)
+		if err != nil {
+			return err
+		}
+		groups = append(groups, uint32(group))
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: groups},
+	}
+	return nil
+}
+
+// checkUID refuses users with a uid below the minimum, such as root and
+// system accounts.
+func checkUID(u *user.User, minUID int) error {
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return err
+	}
+	if uid < minUID {
+		return fmt.Errorf("local user %q has uid %d, below the minimum of %d", u.Username, uid, minUID)
+	}
+	return nil
+}
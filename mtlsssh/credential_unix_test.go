@@ -0,0 +1,37 @@
+//go:build !windows
+// +build !windows
+
+package mtlsssh
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetCredentialGroups(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing users requires root")
+	}
+	u, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("no nobody user")
+	}
+	groupIDs, err := u.GroupIds()
+	require.NoError(t, err)
+
+	cmd := exec.Command("id")
+	require.NoError(t, setCredential(cmd, u))
+
+	var groups []uint32
+	for _, groupID := range groupIDs {
+		group, err := strconv.ParseUint(groupID, 10, 32)
+		require.NoError(t, err)
+		groups = append(groups, uint32(group))
+	}
+	require.Equal(t, groups, cmd.SysProcAttr.Credential.Groups)
+}
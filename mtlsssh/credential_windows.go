@@ -0,0 +1,26 @@
+package mtlsssh
+
+import (
+	"fmt"
+	"os/exec"
+	"os/user"
+)
+
+// setCredential only allows running commands as the user the server
+// runs as, since Windows has no equivalent of setuid.
+func setCredential(cmd *exec.Cmd, u *user.User) error {
+	current, err := user.Current()
+	if err != nil {
+		return err
+	}
+	if current.Uid != u.Uid {
+		return fmt.Errorf("running commands as %q is not supported on Windows", u.Username)
+	}
+	return nil
+}
+
+// checkUID does nothing, since Windows has no numeric uids, and
+// setCredential only allows the user the server runs as.
+func checkUID(u *user.User, minUID int) error {
+	return nil
+}
@@ -0,0 +1,327 @@
+package mtlsssh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/picatz/mtls/authz"
+	"github.com/picatz/mtls/identity"
+	"golang.org/x/crypto/ssh"
+)
+
+// dialTimeout is how long the server waits to connect to a forwarding
+// destination.
+const dialTimeout = 10 * time.Second
+
+// directTCPIP is the payload of a "direct-tcpip" channel, RFC 4254
+// section 7.2.
+type directTCPIP struct {
+	Host       string
+	Port       uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+// tcpipForward is the payload of a "tcpip-forward" or
+// "cancel-tcpip-forward" request, RFC 4254 section 7.1.
+type tcpipForward struct {
+	Addr string
+	Port uint32
+}
+
+// forwardedTCPIP is the payload of a "forwarded-tcpip" channel, RFC 4254
+// section 7.2.
+type forwardedTCPIP struct {
+	Addr       string
+	Port       uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+// handleDirectTCPIP connects a local forwarding channel to its
+// destination, if the identity is allowed to connect to it.
+func (s *Server) handleDirectTCPIP(newChannel ssh.NewChannel, id *identity.Identity) {
+	var req directTCPIP
+	err := ssh.Unmarshal(newChannel.ExtraData(), &req)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "invalid direct-tcpip request")
+		return
+	}
+
+	addr := net.JoinHostPort(req.Host, strconv.Itoa(int(req.Port)))
+	err = s.authorizer.Authorize(id, authz.ActionConnect, addr)
+	if err != nil {
+		s.logger.Printf("mtlsssh: %s", err)
+		newChannel.Reject(ssh.Prohibited, err.Error())
+		return
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	s.logger.Printf("mtlsssh: identity %q connected to %s", id, addr)
+	pipe(channel, conn)
+}
+
+// handleGlobalRequests handles remote forwarding requests for the
+// connection, closing its listeners once the connection is closed.
+func (s *Server) handleGlobalRequests(sshConn *ssh.ServerConn, requests <-chan *ssh.Request, id *identity.Identity) {
+	listeners := map[string]net.Listener{}
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+
+	for req := range requests {
+		switch req.Type {
+		case "tcpip-forward":
+			var fwd tcpipForward
+			if ssh.Unmarshal(req.Payload, &fwd) != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			addr := net.JoinHostPort(fwd.Addr, strconv.Itoa(int(fwd.Port)))
+			err := s.authorizer.Authorize(id, authz.ActionListen, addr)
+			if err != nil {
+				s.logger.Printf("mtlsssh: %s", err)
+				req.Reply(false, nil)
+				continue
+			}
+			l, err := net.Listen("tcp", addr)
+			if err != nil {
+				s.logger.Printf("mtlsssh: identity %q failed to listen on %s: %s", id, addr, err)
+				req.Reply(false, nil)
+				continue
+			}
+			port := uint32(l.Addr().(*net.TCPAddr).Port)
+			listeners[net.JoinHostPort(fwd.Addr, strconv.Itoa(int(port)))] = l
+
+			var reply []byte
+			if fwd.Port == 0 {
+				reply = ssh.Marshal(struct{ Port uint32 }{port})
+			}
+			req.Reply(true, reply)
+
+			s.logger.Printf("mtlsssh: identity %q listening on %s", id, l.Addr())
+			go s.acceptForwarded(sshConn, l, fwd.Addr, port)
+		case "cancel-tcpip-forward":
+			var fwd tcpipForward
+			if ssh.Unmarshal(req.Payload, &fwd) != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			key := net.JoinHostPort(fwd.Addr, strconv.Itoa(int(fwd.Port)))
+			l, ok := listeners[key]
+			if ok {
+				l.Close()
+				delete(listeners, key)
+			}
+			req.Reply(ok, nil)
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// acceptForwarded opens a "forwarded-tcpip" channel to the client for
+// every connection accepted by a remote forwarding listener.
+func (s *Server) acceptForwarded(sshConn *ssh.ServerConn, l net.Listener, addr string, port uint32) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			origin := conn.RemoteAddr().(*net.TCPAddr)
+			channel, requests, err := sshConn.OpenChannel("forwarded-tcpip", ssh.Marshal(&forwardedTCPIP{
+				Addr:       addr,
+				Port:       port,
+				OriginAddr: origin.IP.String(),
+				OriginPort: uint32(origin.Port),
+			}))
+			if err != nil {
+				conn.Close()
+				return
+			}
+			go ssh.DiscardRequests(requests)
+			pipe(channel, conn)
+		}()
+	}
+}
+
+// pipe copies data between the channel and connection in both
+// directions, closing both once they're done.
+func pipe(channel ssh.Channel, conn net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(channel, conn)
+		channel.CloseWrite()
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(conn, channel)
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			tcpConn.CloseWrite()
+		} else {
+			conn.Close()
+		}
+	}()
+	wg.Wait()
+	channel.Close()
+	conn.Close()
+}
+
+// Forward is a port forwarding spec, like the arguments of ssh's -L and
+// -R flags.
+type Forward struct {
+	// ListenAddr is the address connections are accepted on: locally for
+	// local forwarding, or by the server for remote forwarding.
+	ListenAddr string
+	// TargetAddr is the address accepted connections are forwarded to.
+	TargetAddr string
+}
+
+// ParseForward parses a "[bind_address:]port:host:hostport" forwarding
+// spec. The bind address defaults to 127.0.0.1, and IPv6 addresses must
+// be in brackets.
+func ParseForward(spec string) (Forward, error) {
+	var fields []string
+	field, inBrackets := "", false
+	for _, r := range spec {
+		switch {
+		case r == '[':
+			inBrackets = true
+		case r == ']':
+			inBrackets = false
+		case r == ':' && !inBrackets:
+			fields = append(fields, field)
+			field = ""
+		default:
+			field += string(r)
+		}
+	}
+	fields = append(fields, field)
+
+	switch len(fields) {
+	case 3:
+		fields = append([]string{"127.0.0.1"}, fields...)
+	case 4:
+	default:
+		return Forward{}, fmt.Errorf("invalid forward %q, expected [bind_address:]port:host:hostport", spec)
+	}
+	for _, port := range []string{fields[1], fields[3]} {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 0 || n > 65535 {
+			return Forward{}, fmt.Errorf("invalid port %q in forward %q", port, spec)
+		}
+	}
+	if fields[2] == "" {
+		return Forward{}, fmt.Errorf("missing host in forward %q", spec)
+	}
+
+	return Forward{
+		ListenAddr: net.JoinHostPort(fields[0], fields[1]),
+		TargetAddr: net.JoinHostPort(fields[2], fields[3]),
+	}, nil
+}
+
+// Forwarder accepts connections on a listener, forwarding each one to a
+// target address.
+type Forwarder struct {
+	listener net.Listener
+	target   string
+	dial     func(network, addr string) (net.Conn, error)
+}
+
+// LocalForward listens locally, forwarding connections through the SSH
+// server to the target, like ssh -L.
+func LocalForward(sshClient *ssh.Client, f Forward) (*Forwarder, error) {
+	l, err := net.Listen("tcp", f.ListenAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &Forwarder{listener: l, target: f.TargetAddr, dial: sshClient.Dial}, nil
+}
+
+// RemoteForward asks the SSH server to listen, forwarding connections
+// back through the client to the target, like ssh -R.
+func RemoteForward(sshClient *ssh.Client, f Forward) (*Forwarder, error) {
+	l, err := sshClient.Listen("tcp", f.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("server refused to listen on %s: %w", f.ListenAddr, err)
+	}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	return &Forwarder{listener: l, target: f.TargetAddr, dial: dialer.Dial}, nil
+}
+
+// Addr returns the address connections are accepted on.
+func (f *Forwarder) Addr() net.Addr {
+	return f.listener.Addr()
+}
+
+// Serve forwards accepted connections until the Forwarder is closed.
+func (f *Forwarder) Serve() error {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			if strings.Contains(err.Error(), "use of closed network connection") || err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			target, err := f.dial("tcp", f.target)
+			if err != nil {
+				return
+			}
+			defer target.Close()
+
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				io.Copy(target, conn)
+				closeWrite(target)
+			}()
+			go func() {
+				defer wg.Done()
+				io.Copy(conn, target)
+				closeWrite(conn)
+			}()
+			wg.Wait()
+		}()
+	}
+}
+
+// Close stops accepting connections.
+func (f *Forwarder) Close() error {
+	return f.listener.Close()
+}
+
+// closeWrite half-closes connections that support it, so the other
+// side sees EOF while replies can still be read.
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		c.CloseWrite()
+	}
+}
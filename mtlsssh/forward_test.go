@@ -0,0 +1,129 @@
+package mtlsssh
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/picatz/mtls/authz"
+	"github.com/picatz/mtls/cert"
+	"github.com/picatz/mtls/internal/testpki"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseForward(t *testing.T) {
+	for spec, want := range map[string]Forward{
+		"5432:db.internal:5432":     {ListenAddr: "127.0.0.1:5432", TargetAddr: "db.internal:5432"},
+		"0.0.0.0:8080:localhost:80": {ListenAddr: "0.0.0.0:8080", TargetAddr: "localhost:80"},
+		"[::1]:2222:[fd00::1]:22":   {ListenAddr: "[::1]:2222", TargetAddr: "[fd00::1]:22"},
+		"localhost:0:10.0.0.1:6379": {ListenAddr: "localhost:0", TargetAddr: "10.0.0.1:6379"},
+	} {
+		f, err := ParseForward(spec)
+		require.NoError(t, err, spec)
+		require.Equal(t, want, f, spec)
+	}
+
+	for _, spec := range []string{"5432", "5432:db", "a:b:c:d:e", "x:db:5432", "5432:db:99999", "5432::5432"} {
+		_, err := ParseForward(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+// startEchoServer starts a TCP server echoing everything it reads.
+func startEchoServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func requireEcho(t *testing.T, addr string) {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	conn.(*net.TCPConn).CloseWrite()
+
+	reply, err := ioutil.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(reply))
+}
+
+func TestLocalForward(t *testing.T) {
+	echoAddr := startEchoServer(t)
+	p := testpki.New(t)
+	username := currentUser(t)
+	addr := startServer(t, p, WithMinUID(0), WithAuthorizer(&authz.Policy{Rules: []authz.Rule{
+		{Identities: []string{username}, Connect: []string{echoAddr}},
+	}}))
+
+	sshClient, err := dial(t, p, addr, p.Client(cert.WithCommonName(username)), "")
+	require.NoError(t, err)
+	defer sshClient.Close()
+
+	f, err := LocalForward(sshClient, Forward{ListenAddr: "127.0.0.1:0", TargetAddr: echoAddr})
+	require.NoError(t, err)
+	defer f.Close()
+	go f.Serve()
+
+	requireEcho(t, f.Addr().String())
+
+	// destinations outside of the policy are refused by the server
+	_, err = sshClient.Dial("tcp", addr)
+	require.Error(t, err)
+}
+
+func TestRemoteForward(t *testing.T) {
+	echoAddr := startEchoServer(t)
+	p := testpki.New(t)
+	username := currentUser(t)
+	addr := startServer(t, p, WithMinUID(0), WithAuthorizer(&authz.Policy{Rules: []authz.Rule{
+		{Identities: []string{username}, Listen: []string{"127.0.0.1:0"}},
+	}}))
+
+	sshClient, err := dial(t, p, addr, p.Client(cert.WithCommonName(username)), "")
+	require.NoError(t, err)
+	defer sshClient.Close()
+
+	f, err := RemoteForward(sshClient, Forward{ListenAddr: "127.0.0.1:0", TargetAddr: echoAddr})
+	require.NoError(t, err)
+	defer f.Close()
+	go f.Serve()
+
+	requireEcho(t, f.Addr().String())
+
+	_, err = RemoteForward(sshClient, Forward{ListenAddr: "127.0.0.1:1", TargetAddr: echoAddr})
+	require.Error(t, err)
+}
+
+func TestForwardingDeniedByDefault(t *testing.T) {
+	echoAddr := startEchoServer(t)
+	p := testpki.New(t)
+	username := currentUser(t)
+	addr := startServer(t, p, WithMinUID(0))
+
+	sshClient, err := dial(t, p, addr, p.Client(cert.WithCommonName(username)), "")
+	require.NoError(t, err)
+	defer sshClient.Close()
+
+	_, err = sshClient.Dial("tcp", echoAddr)
+	require.Error(t, err)
+
+	_, err = RemoteForward(sshClient, Forward{ListenAddr: "127.0.0.1:0", TargetAddr: echoAddr})
+	require.Error(t, err)
+}
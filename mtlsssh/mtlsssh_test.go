@@ -0,0 +1,166 @@
+package mtlsssh
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os/user"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/picatz/mtls/client"
+	"github.com/picatz/mtls/identity"
+	"github.com/picatz/mtls/internal/testpki"
+	"github.com/picatz/mtls/server"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// startServer starts an mTLS SSH server, returning its address.
+func startServer(t *testing.T, p *testpki.PKI, opts ...Option) string {
+	hostCert := p.Server()
+	sshServer, err := NewServer(hostCert, append([]Option{WithLogger(log.New(ioutil.Discard, "", 0))}, opts...)...)
+	require.NoError(t, err)
+
+	s, err := server.New(
+		server.WithAddr("127.0.0.1:0"),
+		server.WithTLSConfig(&tls.Config{
+			Certificates: []tls.Certificate{hostCert},
+			ClientCAs:    p.Pool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		}),
+		server.WithHandler(sshServer.HandleConn),
+	)
+	require.NoError(t, err)
+	s.Start()
+	t.Cleanup(s.Shutdown)
+
+	return s.Listener().Addr().String()
+}
+
+func dial(t *testing.T, p *testpki.PKI, addr string, clientCert tls.Certificate, user string) (*ssh.Client, error) {
+	c, err := client.New(
+		client.WithAddr(addr),
+		client.WithTLSConfig(&tls.Config{
+			Certificates: []tls.Certificate{clientCert},
+			RootCAs:      p.Pool,
+			ServerName:   "localhost",
+		}),
+	)
+	require.NoError(t, err)
+	return Dial(c, user)
+}
+
+func currentUser(t *testing.T) string {
+	u, err := user.Current()
+	require.NoError(t, err)
+	return u.Username
+}
+
+func TestExec(t *testing.T) {
+	p := testpki.New(t)
+	addr := startServer(t, p, WithMinUID(0), WithAcceptEnv("GREETING"))
+	username := currentUser(t)
+
+	sshClient, err := dial(t, p, addr, p.Client(cert.WithCommonName(username)), "")
+	require.NoError(t, err)
+	defer sshClient.Close()
+
+	session, err := sshClient.NewSession()
+	require.NoError(t, err)
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdin = strings.NewReader("from stdin")
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	require.NoError(t, session.Setenv("GREETING", "hello"))
+	require.Error(t, session.Setenv("LD_PRELOAD", "evil.so"))
+
+	err = session.Run(`echo "$GREETING $USER"; cat; echo oops >&2; exit 3`)
+	var exitErr *ssh.ExitError
+	require.True(t, errors.As(err, &exitErr), err)
+	require.Equal(t, 3, exitErr.ExitStatus())
+	require.Equal(t, "hello "+username+"\nfrom stdin", stdout.String())
+	require.Equal(t, "oops\n", stderr.String())
+}
+
+func TestPTY(t *testing.T) {
+	p := testpki.New(t)
+	addr := startServer(t, p, WithMinUID(0))
+	username := currentUser(t)
+
+	sshClient, err := dial(t, p, addr, p.Client(cert.WithCommonName(username)), username)
+	require.NoError(t, err)
+	defer sshClient.Close()
+
+	session, err := sshClient.NewSession()
+	require.NoError(t, err)
+	defer session.Close()
+
+	require.NoError(t, session.RequestPty("xterm", 40, 100, ssh.TerminalModes{}))
+	output, err := session.Output("stty size; echo $TERM")
+	require.NoError(t, err)
+	require.Equal(t, "40 100\r\nxterm\r\n", string(output))
+}
+
+func TestIdentityMapping(t *testing.T) {
+	p := testpki.New(t)
+	username := currentUser(t)
+	addr := startServer(t, p, WithMinUID(0), WithMapper(identity.Table{"alice": username}))
+
+	sshClient, err := dial(t, p, addr, p.Client(cert.WithCommonName("alice")), "")
+	require.NoError(t, err)
+	session, err := sshClient.NewSession()
+	require.NoError(t, err)
+	output, err := session.Output("id -un")
+	require.NoError(t, err)
+	require.Equal(t, username+"\n", string(output))
+	sshClient.Close()
+
+	// asking for a different user than the mapped one is refused
+	_, err = dial(t, p, addr, p.Client(cert.WithCommonName("alice")), username+"-other")
+	require.Error(t, err)
+
+	// unmapped identities are disconnected
+	_, err = dial(t, p, addr, p.Client(cert.WithCommonName("mallory")), "")
+	require.Error(t, err)
+}
+
+func TestMinUID(t *testing.T) {
+	u, err := user.Current()
+	require.NoError(t, err)
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		t.Skip("uids are not numeric")
+	}
+
+	p := testpki.New(t)
+	addr := startServer(t, p, WithMinUID(uid+1))
+
+	// users below the minimum uid can't be logged in as, even when
+	// mapped by their common name
+	_, err = dial(t, p, addr, p.Client(cert.WithCommonName(u.Username)), "")
+	require.Error(t, err)
+}
+
+func TestHostKeyCallback(t *testing.T) {
+	p := testpki.New(t)
+	serverCert := p.Server()
+	otherCert := p.Server()
+
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{serverCert.Leaf}}
+
+	signer, err := ssh.NewSignerFromKey(serverCert.PrivateKey)
+	require.NoError(t, err)
+	require.NoError(t, HostKeyCallback(state)("server", nil, signer.PublicKey()))
+
+	other, err := ssh.NewSignerFromKey(otherCert.PrivateKey)
+	require.NoError(t, err)
+	require.Error(t, HostKeyCallback(state)("server", nil, other.PublicKey()))
+}
@@ -0,0 +1,98 @@
+package mtlsssh
+
+import (
+	"fmt"
+	"log"
+	"path"
+
+	"github.com/picatz/mtls/authz"
+	"github.com/picatz/mtls/identity"
+)
+
+// DefaultShell is the default shell used for sessions.
+const DefaultShell = "/bin/sh"
+
+// DefaultMinUID is the lowest uid identities are mapped to by default,
+// which keeps them from logging in as root or a system account.
+const DefaultMinUID = 1000
+
+// DefaultAcceptEnv are the environment variables clients may set by
+// default, like sshd's AcceptEnv.
+var DefaultAcceptEnv = []string{"LANG", "LC_*"}
+
+// Options contains each available configuration option
+// for an mTLS SSH Server.
+type Options struct {
+	Mapper     identity.Mapper
+	Authorizer authz.Authorizer
+	Shell      string
+	MinUID     int
+	AcceptEnv  []string
+	Logger     *log.Logger
+}
+
+// Option implements a hook to customize a Server
+// using the NewServer function.
+type Option func(*Options) error
+
+// WithMapper sets how client identities are mapped to local users. By
+// default, identity.CommonNameMapper is used, so only local users with a
+// uid of at least DefaultMinUID should share a name with a client.
+func WithMapper(m identity.Mapper) Option {
+	return func(o *Options) error {
+		o.Mapper = m
+		return nil
+	}
+}
+
+// WithAuthorizer sets which destinations each identity may connect to
+// with local forwarding, and listen on with remote forwarding. By
+// default, port forwarding is denied.
+func WithAuthorizer(a authz.Authorizer) Option {
+	return func(o *Options) error {
+		o.Authorizer = a
+		return nil
+	}
+}
+
+// WithShell sets the shell used for interactive sessions, and to run
+// exec requests.
+func WithShell(shell string) Option {
+	return func(o *Options) error {
+		o.Shell = shell
+		return nil
+	}
+}
+
+// WithMinUID sets the lowest uid of the local users identities may be
+// mapped to. Pass 0 to allow root.
+func WithMinUID(uid int) Option {
+	return func(o *Options) error {
+		o.MinUID = uid
+		return nil
+	}
+}
+
+// WithAcceptEnv sets the names of the environment variables clients may
+// set for their sessions. Names may use path.Match patterns, like
+// "LC_*". Other variables are refused.
+func WithAcceptEnv(patterns ...string) Option {
+	return func(o *Options) error {
+		for _, pattern := range patterns {
+			_, err := path.Match(pattern, "")
+			if err != nil {
+				return fmt.Errorf("invalid environment variable pattern %q: %w", pattern, err)
+			}
+		}
+		o.AcceptEnv = patterns
+		return nil
+	}
+}
+
+// WithLogger sets the logger for connection and session events.
+func WithLogger(l *log.Logger) Option {
+	return func(o *Options) error {
+		o.Logger = l
+		return nil
+	}
+}
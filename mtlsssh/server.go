@@ -0,0 +1,149 @@
+// Package mtlsssh runs SSH sessions over mTLS connections. Clients are
+// authenticated by their verified client certificate, which is mapped to
+// a local user, so no SSH passwords or keys are needed.
+package mtlsssh
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"path"
+
+	"github.com/picatz/mtls/authz"
+	"github.com/picatz/mtls/identity"
+	"golang.org/x/crypto/ssh"
+)
+
+// Permissions extensions set for every authenticated SSH connection.
+const (
+	ExtensionIdentity  = "mtls-identity"
+	ExtensionLocalUser = "mtls-local-user"
+)
+
+// Server handles SSH connections over mTLS connections.
+type Server struct {
+	hostKey    ssh.Signer
+	mapper     identity.Mapper
+	authorizer authz.Authorizer
+	shell      string
+	minUID     int
+	acceptEnv  []string
+	logger     *log.Logger
+}
+
+// NewServer creates a new Server, applying the given Option(s). The SSH
+// host key is the private key of the server's TLS certificate, which
+// clients check against the certificate verified during the handshake.
+func NewServer(hostCert tls.Certificate, opts ...Option) (*Server, error) {
+	serverOptions := &Options{
+		Mapper:     identity.CommonNameMapper,
+		Authorizer: authz.DenyAll,
+		Shell:      DefaultShell,
+		MinUID:     DefaultMinUID,
+		AcceptEnv:  DefaultAcceptEnv,
+		Logger:     log.New(os.Stderr, "", log.LstdFlags),
+	}
+
+	for _, opt := range opts {
+		err := opt(serverOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hostKey, err := ssh.NewSignerFromKey(hostCert.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use TLS private key as SSH host key: %w", err)
+	}
+
+	return &Server{
+		hostKey:    hostKey,
+		mapper:     serverOptions.Mapper,
+		authorizer: serverOptions.Authorizer,
+		shell:      serverOptions.Shell,
+		minUID:     serverOptions.MinUID,
+		acceptEnv:  serverOptions.AcceptEnv,
+		logger:     serverOptions.Logger,
+	}, nil
+}
+
+// HandleConn runs an SSH server connection over the mTLS connection,
+// until the client disconnects. It can be used as a server.Server
+// handler.
+func (s *Server) HandleConn(conn *tls.Conn) {
+	defer conn.Close()
+
+	id, err := identity.FromConn(conn)
+	if err != nil {
+		s.logger.Printf("mtlsssh: %s: %s", conn.RemoteAddr(), err)
+		return
+	}
+	localUser, err := s.mapper.LocalUser(id)
+	if err != nil {
+		s.logger.Printf("mtlsssh: %s: %s", conn.RemoteAddr(), err)
+		return
+	}
+	u, err := user.Lookup(localUser)
+	if err == nil {
+		err = checkUID(u, s.minUID)
+	}
+	if err != nil {
+		s.logger.Printf("mtlsssh: %s: identity %q: %s", conn.RemoteAddr(), id, err)
+		return
+	}
+
+	config := s.serverConfig(id, u)
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		s.logger.Printf("mtlsssh: %s: identity %q: %s", conn.RemoteAddr(), id, err)
+		return
+	}
+	defer sshConn.Close()
+	s.logger.Printf("mtlsssh: %s: identity %q logged in as %q", conn.RemoteAddr(), id, u.Username)
+
+	go s.handleGlobalRequests(sshConn, requests, id)
+
+	for newChannel := range channels {
+		switch newChannel.ChannelType() {
+		case "session":
+			go s.handleSession(newChannel, u)
+		case "direct-tcpip":
+			go s.handleDirectTCPIP(newChannel, id)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, fmt.Sprintf("unsupported channel type %q", newChannel.ChannelType()))
+		}
+	}
+}
+
+// acceptsEnv reports whether clients may set the environment variable.
+func (s *Server) acceptsEnv(name string) bool {
+	for _, pattern := range s.acceptEnv {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// serverConfig returns the SSH config for a connection from the given
+// identity. The identity is already authenticated by TLS, so the only
+// check is that the requested user, if any, is the mapped local user.
+func (s *Server) serverConfig(id *identity.Identity, u *user.User) *ssh.ServerConfig {
+	config := &ssh.ServerConfig{
+		KeyboardInteractiveCallback: func(conn ssh.ConnMetadata, _ ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			if conn.User() != "" && conn.User() != u.Username {
+				return nil, fmt.Errorf("identity %q is not allowed to log in as %q", id, conn.User())
+			}
+			return &ssh.Permissions{
+				Extensions: map[string]string{
+					ExtensionIdentity:  id.Name(),
+					ExtensionLocalUser: u.Username,
+				},
+			}, nil
+		},
+	}
+	config.AddHostKey(s.hostKey)
+	return config
+}
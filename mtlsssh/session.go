@@ -0,0 +1,186 @@
+package mtlsssh
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"sync"
+
+	"github.com/creack/pty"
+	"golang.org/x/crypto/ssh"
+)
+
+// ptyRequest is the payload of a "pty-req" request, RFC 4254 section 6.2.
+type ptyRequest struct {
+	Term    string
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+	Modes   string
+}
+
+// windowChange is the payload of a "window-change" request, RFC 4254
+// section 6.7.
+type windowChange struct {
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+}
+
+// session is a "session" channel running a shell or command as a local
+// user.
+type session struct {
+	server  *Server
+	channel ssh.Channel
+	user    *user.User
+	env     []string
+
+	mu  sync.Mutex
+	pty *ptyRequest
+	tty *os.File
+	cmd *exec.Cmd
+}
+
+func (s *Server) handleSession(newChannel ssh.NewChannel, u *user.User) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		s.logger.Printf("mtlsssh: failed to accept session: %s", err)
+		return
+	}
+
+	sess := &session{server: s, channel: channel, user: u}
+	for req := range requests {
+		ok := sess.handleRequest(req)
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+	}
+}
+
+func (sess *session) handleRequest(req *ssh.Request) bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	switch req.Type {
+	case "env":
+		var env struct{ Name, Value string }
+		if ssh.Unmarshal(req.Payload, &env) != nil || !sess.server.acceptsEnv(env.Name) {
+			return false
+		}
+		sess.env = append(sess.env, env.Name+"="+env.Value)
+		return true
+	case "pty-req":
+		var p ptyRequest
+		if ssh.Unmarshal(req.Payload, &p) != nil || sess.cmd != nil {
+			return false
+		}
+		sess.pty = &p
+		return true
+	case "window-change":
+		var w windowChange
+		if ssh.Unmarshal(req.Payload, &w) != nil || sess.tty == nil {
+			return false
+		}
+		return pty.Setsize(sess.tty, &pty.Winsize{Rows: uint16(w.Rows), Cols: uint16(w.Columns)}) == nil
+	case "shell", "exec":
+		if sess.cmd != nil {
+			return false
+		}
+		var args []string
+		if req.Type == "exec" {
+			var exec struct{ Command string }
+			if ssh.Unmarshal(req.Payload, &exec) != nil {
+				return false
+			}
+			args = []string{"-c", exec.Command}
+		}
+		err := sess.start(args)
+		if err != nil {
+			sess.server.logger.Printf("mtlsssh: %s for %q failed: %s", req.Type, sess.user.Username, err)
+			return false
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// start runs the shell with the given arguments as the session's user.
+func (sess *session) start(args []string) error {
+	cmd := exec.Command(sess.server.shell, args...)
+	cmd.Dir = sess.user.HomeDir
+	cmd.Env = append([]string{
+		"HOME=" + sess.user.HomeDir,
+		"USER=" + sess.user.Username,
+		"LOGNAME=" + sess.user.Username,
+		"SHELL=" + sess.server.shell,
+		"PATH=/usr/local/bin:/usr/bin:/bin",
+	}, sess.env...)
+	err := setCredential(cmd, sess.user)
+	if err != nil {
+		return err
+	}
+
+	if sess.pty != nil {
+		cmd.Env = append(cmd.Env, "TERM="+sess.pty.Term)
+		tty, err := pty.StartWithSize(cmd, &pty.Winsize{Rows: uint16(sess.pty.Rows), Cols: uint16(sess.pty.Columns)})
+		if err != nil {
+			return err
+		}
+		sess.tty = tty
+		sess.cmd = cmd
+
+		go io.Copy(tty, sess.channel)
+		go func() {
+			// reading fails once the command and every process holding
+			// the terminal has exited
+			io.Copy(sess.channel, tty)
+			sess.exit(cmd.Wait())
+			tty.Close()
+		}()
+		return nil
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = sess.channel
+	cmd.Stderr = sess.channel.Stderr()
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	sess.cmd = cmd
+
+	go func() {
+		io.Copy(stdin, sess.channel)
+		stdin.Close()
+	}()
+	go func() {
+		sess.exit(cmd.Wait())
+	}()
+	return nil
+}
+
+// exit sends the command's exit status to the client, then closes the
+// channel.
+func (sess *session) exit(err error) {
+	status := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		status = exitErr.ExitCode()
+		if status < 0 {
+			status = 255
+		}
+	} else if err != nil {
+		status = 255
+	}
+
+	sess.channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+	sess.channel.Close()
+}
@@ -0,0 +1,73 @@
+package mux
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// protocolVersion is the version of the framing protocol.
+const protocolVersion = 0
+
+// headerSize is the size of a frame header: version, type, flags, stream
+// ID and length.
+const headerSize = 12
+
+// frameType is the type of a frame.
+type frameType uint8
+
+const (
+	// typeData carries stream data, with the length of the payload.
+	typeData frameType = iota
+	// typeWindowUpdate grants the stream's peer more send window, with the
+	// length being the increase.
+	typeWindowUpdate
+	// typePing checks the connection is alive, with the length being an
+	// opaque value echoed back in the reply.
+	typePing
+	// typeGoAway tells the peer no new streams will be accepted.
+	typeGoAway
+)
+
+func (t frameType) String() string {
+	switch t {
+	case typeData:
+		return "data"
+	case typeWindowUpdate:
+		return "window update"
+	case typePing:
+		return "ping"
+	case typeGoAway:
+		return "go away"
+	default:
+		return fmt.Sprintf("frame type %d", uint8(t))
+	}
+}
+
+// Frame flags.
+const (
+	// flagSYN opens a new stream, or is a ping request.
+	flagSYN uint16 = 1 << iota
+	// flagACK acknowledges a new stream, or is a ping reply.
+	flagACK
+	// flagFIN half-closes a stream.
+	flagFIN
+	// flagRST resets a stream.
+	flagRST
+)
+
+// header is a frame header.
+type header [headerSize]byte
+
+func (h *header) version() uint8       { return h[0] }
+func (h *header) frameType() frameType { return frameType(h[1]) }
+func (h *header) flags() uint16        { return binary.BigEndian.Uint16(h[2:4]) }
+func (h *header) streamID() uint32     { return binary.BigEndian.Uint32(h[4:8]) }
+func (h *header) length() uint32       { return binary.BigEndian.Uint32(h[8:12]) }
+
+func (h *header) encode(t frameType, flags uint16, streamID, length uint32) {
+	h[0] = protocolVersion
+	h[1] = uint8(t)
+	binary.BigEndian.PutUint16(h[2:4], flags)
+	binary.BigEndian.PutUint32(h[4:8], streamID)
+	binary.BigEndian.PutUint32(h[8:12], length)
+}
@@ -0,0 +1,273 @@
+package mux
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSessions returns a client and server session connected over a
+// loopback TCP connection.
+func newTestSessions(t *testing.T, clientOpts, serverOpts []Option) (*Session, *Session) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := l.Accept()
+		accepted <- conn
+	}()
+	clientConn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	serverConn := <-accepted
+	require.NotNil(t, serverConn)
+
+	client, err := Client(clientConn, clientOpts...)
+	require.NoError(t, err)
+	server, err := Server(serverConn, serverOpts...)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+// eventually waits up to a second for the condition to be true.
+func eventually(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition was not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// echo accepts streams on the session, writing everything read back.
+func echo(s *Session) {
+	for {
+		stream, err := s.AcceptStream()
+		if err != nil {
+			return
+		}
+		go func() {
+			io.Copy(stream, stream)
+			stream.Close()
+		}()
+	}
+}
+
+func TestStreams(t *testing.T) {
+	client, server := newTestSessions(t, nil, nil)
+	go echo(server)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			data := make([]byte, 1024*1024)
+			_, err := rand.Read(data)
+			require.NoError(t, err)
+
+			stream, err := client.Open()
+			require.NoError(t, err)
+
+			go func() {
+				_, err := stream.Write(data)
+				require.NoError(t, err)
+				require.NoError(t, stream.Close())
+			}()
+
+			reply, err := ioutil.ReadAll(stream)
+			require.NoError(t, err)
+			require.True(t, bytes.Equal(data, reply))
+		}()
+	}
+	wg.Wait()
+
+	eventually(t, func() bool {
+		return client.NumStreams() == 0 && server.NumStreams() == 0
+	})
+}
+
+func TestFlowControl(t *testing.T) {
+	client, server := newTestSessions(t, nil, nil)
+
+	stream, err := client.Open()
+	require.NoError(t, err)
+
+	// the server never reads, so writes block once the window is full
+	require.NoError(t, stream.SetWriteDeadline(time.Now().Add(100*time.Millisecond)))
+	n, err := stream.Write(make([]byte, 2*initialWindowSize))
+	require.Equal(t, initialWindowSize, n)
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr) && netErr.Timeout(), err)
+
+	// reading frees up the window again
+	serverStream, err := server.AcceptStream()
+	require.NoError(t, err)
+	_, err = io.ReadFull(serverStream, make([]byte, initialWindowSize))
+	require.NoError(t, err)
+
+	require.NoError(t, stream.SetWriteDeadline(time.Now().Add(time.Second)))
+	_, err = stream.Write(make([]byte, initialWindowSize/2))
+	require.NoError(t, err)
+}
+
+func TestWindowSize(t *testing.T) {
+	opts := []Option{WithWindowSize(4 * initialWindowSize)}
+	client, server := newTestSessions(t, opts, opts)
+
+	stream, err := client.Open()
+	require.NoError(t, err)
+
+	// the server's larger window is granted when the stream is accepted
+	_, err = server.AcceptStream()
+	require.NoError(t, err)
+	require.NoError(t, stream.SetWriteDeadline(time.Now().Add(time.Second)))
+	_, err = stream.Write(make([]byte, 4*initialWindowSize))
+	require.NoError(t, err)
+
+	_, err = Client(nil, WithWindowSize(1024))
+	require.Error(t, err)
+}
+
+func TestStreamLimits(t *testing.T) {
+	client, server := newTestSessions(t, []Option{WithMaxStreams(2)}, []Option{WithMaxStreams(1)})
+
+	first, err := client.Open()
+	require.NoError(t, err)
+	second, err := client.Open()
+	require.NoError(t, err)
+	_, err = client.Open()
+	require.Equal(t, ErrStreamLimit, err)
+
+	// the server only allows one stream, so the second one is reset
+	_, err = server.AcceptStream()
+	require.NoError(t, err)
+	require.NoError(t, second.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = second.Read(make([]byte, 1))
+	require.Equal(t, ErrStreamReset, err)
+
+	require.NoError(t, first.Reset())
+	_, err = first.Write([]byte("x"))
+	require.Equal(t, ErrStreamReset, err)
+
+	eventually(t, func() bool {
+		return client.NumStreams() == 0
+	})
+}
+
+func TestKeepAlive(t *testing.T) {
+	client, _ := newTestSessions(t, nil, nil)
+	rtt, err := client.Ping()
+	require.NoError(t, err)
+	require.True(t, rtt > 0)
+
+	// a peer which never answers pings is disconnected
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+
+	s, err := Client(conn, WithKeepAlive(10*time.Millisecond, 50*time.Millisecond))
+	require.NoError(t, err)
+	select {
+	case <-s.Closed():
+		require.Equal(t, ErrKeepAliveTimeout, s.Err())
+	case <-time.After(time.Second):
+		t.Fatal("session was not closed")
+	}
+	_, err = s.Open()
+	require.Equal(t, ErrKeepAliveTimeout, err)
+}
+
+func TestGoAwayAndClose(t *testing.T) {
+	client, server := newTestSessions(t, nil, nil)
+	go echo(server)
+
+	stream, err := client.Open()
+	require.NoError(t, err)
+
+	require.NoError(t, server.GoAway())
+	eventually(t, func() bool {
+		_, err := client.Open()
+		return err == ErrGoAway
+	})
+
+	// open streams keep working
+	_, err = stream.Write([]byte("ping"))
+	require.NoError(t, err)
+	reply := make([]byte, 4)
+	_, err = io.ReadFull(stream, reply)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(reply))
+
+	require.NoError(t, stream.SetReadDeadline(time.Now().Add(10*time.Millisecond)))
+	_, err = stream.Read(reply)
+	require.Equal(t, ErrTimeout, err)
+	require.NoError(t, stream.SetReadDeadline(time.Time{}))
+
+	server.Close()
+	_, err = stream.Read(reply)
+	require.Error(t, err)
+	_, err = client.AcceptStream()
+	require.Error(t, err)
+}
+
+func TestPeerStreamIDs(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	s, err := Server(conn)
+	require.NoError(t, err)
+	defer s.Close()
+
+	writeFrame := func(typ frameType, flags uint16, streamID, length uint32) {
+		var h header
+		h.encode(typ, flags, streamID, length)
+		_, err := peer.Write(h[:])
+		require.NoError(t, err)
+	}
+
+	// a ping flood, whose replies are never read, doesn't block the
+	// session from reading frames
+	for i := uint32(0); i < 1000; i++ {
+		writeFrame(typePing, flagSYN, 0, i)
+	}
+
+	// clients open odd streams
+	writeFrame(typeWindowUpdate, flagSYN, 1, 0)
+	stream, err := s.AcceptStream()
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), stream.id)
+
+	// an even stream could collide with one opened by the server
+	writeFrame(typeWindowUpdate, flagSYN, 2, 0)
+	select {
+	case <-s.Closed():
+	case <-time.After(time.Second):
+		t.Fatal("session was not closed")
+	}
+	var protocolErr *ProtocolError
+	require.True(t, errors.As(s.Err(), &protocolErr), s.Err())
+}
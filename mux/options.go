@@ -0,0 +1,109 @@
+package mux
+
+import (
+	"fmt"
+	"time"
+)
+
+// Defaults for the Options of a Session.
+const (
+	DefaultMaxStreams        = 1024
+	DefaultAcceptBacklog     = 256
+	DefaultWindowSize        = initialWindowSize
+	DefaultKeepAliveInterval = 30 * time.Second
+	DefaultKeepAliveTimeout  = 10 * time.Second
+	DefaultWriteTimeout      = 10 * time.Second
+)
+
+// initialWindowSize is the window every stream starts with, before
+// window updates are exchanged.
+const initialWindowSize = 256 * 1024
+
+// Options contains each available configuration option
+// for a Session.
+type Options struct {
+	MaxStreams        int
+	AcceptBacklog     int
+	WindowSize        uint32
+	KeepAliveInterval time.Duration
+	KeepAliveTimeout  time.Duration
+	WriteTimeout      time.Duration
+}
+
+// Option implements a hook to customize a Session
+// using the Client or Server functions.
+type Option func(*Options) error
+
+func defaultOptions() *Options {
+	return &Options{
+		MaxStreams:        DefaultMaxStreams,
+		AcceptBacklog:     DefaultAcceptBacklog,
+		WindowSize:        DefaultWindowSize,
+		KeepAliveInterval: DefaultKeepAliveInterval,
+		KeepAliveTimeout:  DefaultKeepAliveTimeout,
+		WriteTimeout:      DefaultWriteTimeout,
+	}
+}
+
+// WithMaxStreams limits the number of streams open at once. Streams
+// opened by the peer beyond the limit are reset.
+func WithMaxStreams(n int) Option {
+	return func(o *Options) error {
+		if n <= 0 {
+			return fmt.Errorf("max streams %d must be positive", n)
+		}
+		o.MaxStreams = n
+		return nil
+	}
+}
+
+// WithAcceptBacklog sets how many streams opened by the peer can wait
+// to be accepted. Streams beyond the backlog are reset.
+func WithAcceptBacklog(n int) Option {
+	return func(o *Options) error {
+		if n <= 0 {
+			return fmt.Errorf("accept backlog %d must be positive", n)
+		}
+		o.AcceptBacklog = n
+		return nil
+	}
+}
+
+// WithWindowSize sets how much unread data each stream buffers before
+// the peer has to wait to send more. It can't be smaller than the
+// initial window of 256KB.
+func WithWindowSize(size uint32) Option {
+	return func(o *Options) error {
+		if size < initialWindowSize {
+			return fmt.Errorf("window size %d must be at least %d", size, initialWindowSize)
+		}
+		o.WindowSize = size
+		return nil
+	}
+}
+
+// WithKeepAlive pings the peer every interval, closing the session if a
+// reply doesn't arrive within the timeout. An interval of zero disables
+// keepalives.
+func WithKeepAlive(interval, timeout time.Duration) Option {
+	return func(o *Options) error {
+		if interval < 0 || timeout <= 0 {
+			return fmt.Errorf("invalid keepalive interval %v and timeout %v", interval, timeout)
+		}
+		o.KeepAliveInterval = interval
+		o.KeepAliveTimeout = timeout
+		return nil
+	}
+}
+
+// WithWriteTimeout sets how long a frame can take to be written to the
+// connection before the session is closed.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return fmt.Errorf("write timeout %v must be positive", d)
+		}
+		o.WriteTimeout = d
+		return nil
+	}
+}
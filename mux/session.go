@@ -0,0 +1,444 @@
+// Package mux multiplexes many streams over a single connection, such as
+// an mTLS connection, so each stream doesn't cost a new handshake.
+// Streams have their own flow control windows, and sessions send
+// keepalive pings and limit the number of open streams.
+package mux
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSessionClosed is returned when using a closed session, or a
+	// stream of one.
+	ErrSessionClosed = errors.New("mux: session closed")
+	// ErrStreamClosed is returned when writing to a stream after closing
+	// it.
+	ErrStreamClosed = errors.New("mux: stream closed")
+	// ErrStreamReset is returned when using a stream reset by the peer.
+	ErrStreamReset = errors.New("mux: stream reset")
+	// ErrStreamLimit is returned when opening a stream would exceed the
+	// session's maximum number of streams.
+	ErrStreamLimit = errors.New("mux: too many open streams")
+	// ErrGoAway is returned when opening a stream after the peer stopped
+	// accepting new streams.
+	ErrGoAway = errors.New("mux: peer is not accepting new streams")
+	// ErrKeepAliveTimeout is the reason a session is closed when a
+	// keepalive ping isn't answered in time.
+	ErrKeepAliveTimeout = errors.New("mux: keepalive timeout")
+)
+
+// ProtocolError is the reason a session is closed when the peer sends
+// an invalid frame.
+type ProtocolError struct {
+	Reason string
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("mux: protocol error: %s", e.Reason)
+}
+
+// timeoutError is returned when a stream deadline is exceeded.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "mux: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// ErrTimeout is returned when a stream's read or write deadline is
+// exceeded. It implements net.Error.
+var ErrTimeout net.Error = timeoutError{}
+
+// maxPendingPingAcks is how many ping replies may wait to be sent.
+// Pings beyond it are dropped, so a ping flood can't grow the backlog.
+const maxPendingPingAcks = 16
+
+// Session multiplexes streams over a connection.
+type Session struct {
+	conn net.Conn
+	opts Options
+
+	nextID uint32
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	streams  map[uint32]*Stream
+	goAway   bool
+	pings    map[uint32]chan struct{}
+	nextPing uint32
+
+	pingAcks chan uint32
+
+	accept chan *Stream
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	closeErr  error
+}
+
+// Client starts the client side of a session over the connection,
+// applying the given Option(s).
+func Client(conn net.Conn, opts ...Option) (*Session, error) {
+	return newSession(conn, true, opts)
+}
+
+// Server starts the server side of a session over the connection,
+// applying the given Option(s).
+func Server(conn net.Conn, opts ...Option) (*Session, error) {
+	return newSession(conn, false, opts)
+}
+
+func newSession(conn net.Conn, isClient bool, opts []Option) (*Session, error) {
+	sessionOptions := defaultOptions()
+	for _, opt := range opts {
+		err := opt(sessionOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Session{
+		conn:     conn,
+		opts:     *sessionOptions,
+		streams:  map[uint32]*Stream{},
+		pings:    map[uint32]chan struct{}{},
+		pingAcks: make(chan uint32, maxPendingPingAcks),
+		accept:   make(chan *Stream, sessionOptions.AcceptBacklog),
+		closed:   make(chan struct{}),
+	}
+	// clients use odd stream IDs and servers use even ones
+	if isClient {
+		s.nextID = 1
+	} else {
+		s.nextID = 2
+	}
+
+	go s.recvLoop()
+	go s.sendPingAcks()
+	if s.opts.KeepAliveInterval > 0 {
+		go s.keepAlive()
+	}
+	return s, nil
+}
+
+// Conn returns the underlying connection.
+func (s *Session) Conn() net.Conn {
+	return s.conn
+}
+
+// NumStreams returns the number of open streams.
+func (s *Session) NumStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+// Closed returns a channel which is closed once the session is closed.
+func (s *Session) Closed() <-chan struct{} {
+	return s.closed
+}
+
+// Err returns the reason the session was closed, or nil if it's open.
+func (s *Session) Err() error {
+	select {
+	case <-s.closed:
+		return s.closeErr
+	default:
+		return nil
+	}
+}
+
+// Open opens a new stream.
+func (s *Session) Open() (*Stream, error) {
+	s.mu.Lock()
+	if err := s.Err(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if s.goAway {
+		s.mu.Unlock()
+		return nil, ErrGoAway
+	}
+	if len(s.streams) >= s.opts.MaxStreams {
+		s.mu.Unlock()
+		return nil, ErrStreamLimit
+	}
+	id := s.nextID
+	s.nextID += 2
+	stream := newStream(s, id)
+	s.streams[id] = stream
+	s.mu.Unlock()
+
+	err := s.writeFrame(typeWindowUpdate, flagSYN, id, s.opts.WindowSize-initialWindowSize, nil)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// AcceptStream waits for the peer to open a stream.
+func (s *Session) AcceptStream() (*Stream, error) {
+	select {
+	case stream := <-s.accept:
+		return stream, nil
+	case <-s.closed:
+		return nil, s.closeErr
+	}
+}
+
+// Accept waits for the peer to open a stream, so a Session can be used
+// as a net.Listener.
+func (s *Session) Accept() (net.Conn, error) {
+	return s.AcceptStream()
+}
+
+// Addr returns the local address of the connection.
+func (s *Session) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// GoAway tells the peer no new streams will be accepted, while letting
+// open streams finish.
+func (s *Session) GoAway() error {
+	return s.writeFrame(typeGoAway, 0, 0, 0, nil)
+}
+
+// Close closes the session, its connection and every stream.
+func (s *Session) Close() error {
+	s.close(ErrSessionClosed)
+	return nil
+}
+
+func (s *Session) close(err error) {
+	s.closeOnce.Do(func() {
+		s.closeErr = err
+		close(s.closed)
+		s.conn.Close()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, stream := range s.streams {
+			stream.notify()
+		}
+	})
+}
+
+// Ping sends a ping to the peer, returning the round trip time.
+func (s *Session) Ping() (time.Duration, error) {
+	s.mu.Lock()
+	id := s.nextPing
+	s.nextPing++
+	reply := make(chan struct{})
+	s.pings[id] = reply
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.pings, id)
+		s.mu.Unlock()
+	}()
+
+	start := time.Now()
+	err := s.writeFrame(typePing, flagSYN, 0, id, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	timer := time.NewTimer(s.opts.KeepAliveTimeout)
+	defer timer.Stop()
+	select {
+	case <-reply:
+		return time.Since(start), nil
+	case <-timer.C:
+		return 0, ErrKeepAliveTimeout
+	case <-s.closed:
+		return 0, s.closeErr
+	}
+}
+
+// keepAlive pings the peer every keepalive interval, closing the
+// session if a ping isn't answered.
+func (s *Session) keepAlive() {
+	ticker := time.NewTicker(s.opts.KeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_, err := s.Ping()
+			if err == ErrKeepAliveTimeout {
+				s.close(err)
+				return
+			}
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// writeFrame writes a frame to the connection, closing the session if
+// it fails.
+func (s *Session) writeFrame(t frameType, flags uint16, streamID, length uint32, body []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	var h header
+	h.encode(t, flags, streamID, length)
+	s.conn.SetWriteDeadline(time.Now().Add(s.opts.WriteTimeout))
+	_, err := s.conn.Write(append(h[:], body...))
+	if err != nil {
+		s.close(err)
+		return err
+	}
+	return nil
+}
+
+// recvLoop reads frames from the connection until it fails.
+func (s *Session) recvLoop() {
+	var h header
+	for {
+		_, err := io.ReadFull(s.conn, h[:])
+		if err != nil {
+			if err == io.EOF {
+				err = ErrSessionClosed
+			}
+			s.close(err)
+			return
+		}
+		if h.version() != protocolVersion {
+			s.close(&ProtocolError{Reason: fmt.Sprintf("unsupported version %d", h.version())})
+			return
+		}
+
+		switch h.frameType() {
+		case typeData, typeWindowUpdate:
+			err = s.handleStreamFrame(&h)
+		case typePing:
+			err = s.handlePing(&h)
+		case typeGoAway:
+			s.mu.Lock()
+			s.goAway = true
+			s.mu.Unlock()
+		default:
+			err = &ProtocolError{Reason: fmt.Sprintf("unknown %s", h.frameType())}
+		}
+		if err != nil {
+			s.close(err)
+			return
+		}
+	}
+}
+
+func (s *Session) handlePing(h *header) error {
+	if h.flags()&flagSYN != 0 {
+		select {
+		case s.pingAcks <- h.length():
+		default:
+		}
+		return nil
+	}
+	s.mu.Lock()
+	reply, ok := s.pings[h.length()]
+	if ok {
+		delete(s.pings, h.length())
+	}
+	s.mu.Unlock()
+	if ok {
+		close(reply)
+	}
+	return nil
+}
+
+// sendPingAcks replies to the peer's pings, without blocking the receive
+// loop on writes.
+func (s *Session) sendPingAcks() {
+	for {
+		select {
+		case value := <-s.pingAcks:
+			s.writeFrame(typePing, flagACK, 0, value, nil)
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+func (s *Session) handleStreamFrame(h *header) error {
+	id := h.streamID()
+	flags := h.flags()
+
+	if flags&flagSYN != 0 {
+		err := s.openRemoteStream(id)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	stream := s.streams[id]
+	s.mu.Unlock()
+
+	if h.frameType() == typeWindowUpdate {
+		if stream != nil {
+			stream.updateSendWindow(h.length(), flags)
+		}
+		return nil
+	}
+
+	if stream == nil {
+		// data for a stream which was reset or closed is discarded
+		_, err := io.CopyN(ioutil.Discard, s.conn, int64(h.length()))
+		return err
+	}
+	return stream.readData(s.conn, h.length(), flags)
+}
+
+// openRemoteStream handles a stream opened by the peer, resetting it if
+// there are too many streams or the accept backlog is full.
+func (s *Session) openRemoteStream(id uint32) error {
+	s.mu.Lock()
+	// the peer's stream IDs have the other parity, so they never collide
+	// with the streams opened by Open
+	if id == 0 || id%2 == s.nextID%2 {
+		s.mu.Unlock()
+		return &ProtocolError{Reason: fmt.Sprintf("peer opened stream %d with a local stream ID", id)}
+	}
+	if _, ok := s.streams[id]; ok {
+		s.mu.Unlock()
+		return &ProtocolError{Reason: fmt.Sprintf("duplicate stream %d", id)}
+	}
+	if len(s.streams) >= s.opts.MaxStreams {
+		s.mu.Unlock()
+		go s.writeFrame(typeWindowUpdate, flagRST, id, 0, nil)
+		return nil
+	}
+	stream := newStream(s, id)
+	s.streams[id] = stream
+	s.mu.Unlock()
+
+	select {
+	case s.accept <- stream:
+	default:
+		s.removeStream(id)
+		go s.writeFrame(typeWindowUpdate, flagRST, id, 0, nil)
+		return nil
+	}
+
+	go s.writeFrame(typeWindowUpdate, flagACK, id, s.opts.WindowSize-initialWindowSize, nil)
+	return nil
+}
+
+func (s *Session) removeStream(id uint32) {
+	s.mu.Lock()
+	delete(s.streams, id)
+	s.mu.Unlock()
+}
@@ -0,0 +1,305 @@
+package mux
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxFrameSize is the largest data frame written, so streams share the
+// connection fairly.
+const maxFrameSize = 64 * 1024
+
+// Stream is a logical connection multiplexed over a Session. It
+// implements net.Conn.
+type Stream struct {
+	id      uint32
+	session *Session
+
+	mu            sync.Mutex
+	recvBuf       bytes.Buffer
+	recvWindow    uint32
+	unacked       uint32
+	sendWindow    uint32
+	localClosed   bool
+	remoteClosed  bool
+	reset         bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	// recvNotify and sendNotify wake up blocked readers and writers.
+	recvNotify chan struct{}
+	sendNotify chan struct{}
+}
+
+func newStream(s *Session, id uint32) *Stream {
+	return &Stream{
+		id:         id,
+		session:    s,
+		recvWindow: s.opts.WindowSize,
+		sendWindow: initialWindowSize,
+		recvNotify: make(chan struct{}, 1),
+		sendNotify: make(chan struct{}, 1),
+	}
+}
+
+// ID returns the stream's ID, which is unique within its session.
+func (st *Stream) ID() uint32 {
+	return st.id
+}
+
+// Session returns the session the stream belongs to.
+func (st *Stream) Session() *Session {
+	return st.session
+}
+
+// notify wakes up blocked readers and writers.
+func (st *Stream) notify() {
+	for _, ch := range []chan struct{}{st.recvNotify, st.sendNotify} {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// wait blocks until notified, the deadline passes or the session is
+// closed.
+func (st *Stream) wait(ch chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return ErrTimeout
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-timeout:
+		return ErrTimeout
+	case <-st.session.closed:
+		return nil
+	}
+}
+
+// Read reads data sent by the peer, returning io.EOF once the peer has
+// closed the stream and all of its data has been read.
+func (st *Stream) Read(b []byte) (int, error) {
+	for {
+		st.mu.Lock()
+		if st.recvBuf.Len() > 0 {
+			n, _ := st.recvBuf.Read(b)
+			st.unacked += uint32(n)
+			var update uint32
+			// the window is only updated after half of it has been read,
+			// to avoid sending an update for every read
+			if st.unacked >= st.session.opts.WindowSize/2 {
+				update = st.unacked
+				st.recvWindow += update
+				st.unacked = 0
+			}
+			st.mu.Unlock()
+			if update > 0 {
+				st.session.writeFrame(typeWindowUpdate, 0, st.id, update, nil)
+			}
+			return n, nil
+		}
+		switch {
+		case st.reset:
+			st.mu.Unlock()
+			return 0, ErrStreamReset
+		case st.remoteClosed:
+			st.mu.Unlock()
+			return 0, io.EOF
+		}
+		deadline := st.readDeadline
+		st.mu.Unlock()
+
+		if err := st.session.Err(); err != nil {
+			return 0, err
+		}
+		err := st.wait(st.recvNotify, deadline)
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write writes data to the stream, blocking while the peer's window is
+// full.
+func (st *Stream) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		st.mu.Lock()
+		switch {
+		case st.reset:
+			st.mu.Unlock()
+			return written, ErrStreamReset
+		case st.localClosed:
+			st.mu.Unlock()
+			return written, ErrStreamClosed
+		}
+		if st.sendWindow == 0 {
+			deadline := st.writeDeadline
+			st.mu.Unlock()
+
+			if err := st.session.Err(); err != nil {
+				return written, err
+			}
+			err := st.wait(st.sendNotify, deadline)
+			if err != nil {
+				return written, err
+			}
+			continue
+		}
+
+		n := len(b) - written
+		if uint32(n) > st.sendWindow {
+			n = int(st.sendWindow)
+		}
+		if n > maxFrameSize {
+			n = maxFrameSize
+		}
+		st.sendWindow -= uint32(n)
+		st.mu.Unlock()
+
+		err := st.session.writeFrame(typeData, 0, st.id, uint32(n), b[written:written+n])
+		if err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// Close half-closes the stream: the peer reads io.EOF once it has read
+// everything written, while data sent by the peer can still be read.
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	if st.localClosed || st.reset {
+		st.mu.Unlock()
+		return nil
+	}
+	st.localClosed = true
+	done := st.remoteClosed
+	st.mu.Unlock()
+
+	if done {
+		st.session.removeStream(st.id)
+	}
+	err := st.session.writeFrame(typeData, flagFIN, st.id, 0, nil)
+	if err == ErrSessionClosed {
+		return nil
+	}
+	return err
+}
+
+// Reset closes the stream in both directions, discarding unread data.
+func (st *Stream) Reset() error {
+	st.mu.Lock()
+	if st.reset {
+		st.mu.Unlock()
+		return nil
+	}
+	st.reset = true
+	st.mu.Unlock()
+
+	st.notify()
+	st.session.removeStream(st.id)
+	return st.session.writeFrame(typeWindowUpdate, flagRST, st.id, 0, nil)
+}
+
+// readData reads a data frame's payload from the connection into the
+// stream's buffer.
+func (st *Stream) readData(r io.Reader, length uint32, flags uint16) error {
+	st.mu.Lock()
+	if length > st.recvWindow {
+		st.mu.Unlock()
+		return &ProtocolError{Reason: "peer exceeded the stream's receive window"}
+	}
+	st.recvWindow -= length
+	st.mu.Unlock()
+
+	// read without holding the lock, so a slow frame doesn't block the
+	// stream's readers and writers
+	payload := make([]byte, length)
+	_, err := io.ReadFull(r, payload)
+	if err != nil {
+		return err
+	}
+	st.mu.Lock()
+	st.recvBuf.Write(payload)
+	st.mu.Unlock()
+
+	st.handleFlags(flags)
+	st.notify()
+	return nil
+}
+
+// updateSendWindow handles a window update frame from the peer.
+func (st *Stream) updateSendWindow(delta uint32, flags uint16) {
+	st.mu.Lock()
+	st.sendWindow += delta
+	st.mu.Unlock()
+
+	st.handleFlags(flags)
+	st.notify()
+}
+
+// handleFlags handles the FIN and RST flags of a frame from the peer.
+func (st *Stream) handleFlags(flags uint16) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if flags&flagRST != 0 {
+		st.reset = true
+		st.session.removeStream(st.id)
+		return
+	}
+	if flags&flagFIN != 0 {
+		st.remoteClosed = true
+		if st.localClosed {
+			st.session.removeStream(st.id)
+		}
+	}
+}
+
+// LocalAddr returns the local address of the session's connection.
+func (st *Stream) LocalAddr() net.Addr {
+	return st.session.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the session's connection.
+func (st *Stream) RemoteAddr() net.Addr {
+	return st.session.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines.
+func (st *Stream) SetDeadline(t time.Time) error {
+	st.SetReadDeadline(t)
+	return st.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets when blocked and future reads time out.
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline = t
+	st.mu.Unlock()
+	st.notify()
+	return nil
+}
+
+// SetWriteDeadline sets when blocked and future writes time out.
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.writeDeadline = t
+	st.mu.Unlock()
+	st.notify()
+	return nil
+}
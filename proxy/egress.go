@@ -0,0 +1,247 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"path/filepath"
+	"time"
+
+	"github.com/picatz/mtls/authz"
+	"github.com/picatz/mtls/tlsconf"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEgressAddr is the default address of an egress proxy, which is
+// only reachable by local apps.
+const DefaultEgressAddr = "127.0.0.1:3128"
+
+// EgressConfig configures an Egress proxy.
+type EgressConfig struct {
+	// Destinations are tried in order, and the first one matching the
+	// requested address is used.
+	Destinations []Destination `yaml:"destinations" json:"destinations"`
+}
+
+// Destination is the client cert and CA bundle used for a set of
+// destination addresses.
+type Destination struct {
+	// Hosts are "host:port" patterns, in the same format as the connect
+	// addresses of policy rules, such as "*.payments.internal:443".
+	Hosts []string `yaml:"hosts" json:"hosts"`
+	// Cert and Key are the PEM encoded client cert and key files.
+	Cert string `yaml:"cert" json:"cert"`
+	Key  string `yaml:"key" json:"key"`
+	// CA is the PEM encoded CA bundle file verifying the destination.
+	CA string `yaml:"ca" json:"ca"`
+	// ServerName overrides the name verified in the destination's cert,
+	// which is the requested host by default.
+	ServerName string `yaml:"server_name,omitempty" json:"server_name,omitempty"`
+
+	tlsConfig *tls.Config
+	proxy     *httputil.ReverseProxy
+}
+
+// ParseEgressConfig parses a YAML (or JSON) encoded EgressConfig.
+func ParseEgressConfig(data []byte) (*EgressConfig, error) {
+	var c EgressConfig
+	err := yaml.Unmarshal(data, &c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// LoadEgressConfig reads an EgressConfig from a YAML (or JSON) file.
+// Relative file paths are relative to the file's directory.
+func LoadEgressConfig(path string) (*EgressConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := ParseEgressConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", path, err)
+	}
+
+	baseDir := filepath.Dir(path)
+	for i := range c.Destinations {
+		d := &c.Destinations[i]
+		for _, file := range []*string{&d.Cert, &d.Key, &d.CA} {
+			if *file != "" && !filepath.IsAbs(*file) {
+				*file = filepath.Join(baseDir, *file)
+			}
+		}
+	}
+	return c, nil
+}
+
+// Egress is an HTTP forward proxy for local apps that can't do mTLS
+// themselves. Tunnels opened with CONNECT, and plain HTTP requests, are
+// sent to the destination over mTLS, presenting the client cert of the
+// matching destination and verifying the server with its CA bundle.
+type Egress struct {
+	destinations []*Destination
+	dialer       *net.Dialer
+}
+
+// NewEgress creates an Egress proxy using the given config, loading the
+// files of every destination.
+func NewEgress(config *EgressConfig) (*Egress, error) {
+	if len(config.Destinations) == 0 {
+		return nil, fmt.Errorf("no destinations")
+	}
+
+	e := &Egress{dialer: &net.Dialer{Timeout: 10 * time.Second}}
+	for i := range config.Destinations {
+		d := config.Destinations[i]
+		if len(d.Hosts) == 0 {
+			return nil, fmt.Errorf("destination %d has no hosts", i+1)
+		}
+		for _, pattern := range d.Hosts {
+			err := authz.ValidateAddrPattern(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("destination %d: %w", i+1, err)
+			}
+		}
+		if d.Cert == "" || d.Key == "" || d.CA == "" {
+			return nil, fmt.Errorf("destination %d needs a cert, key and ca", i+1)
+		}
+
+		opts := []tlsconf.TLSConfigOption{
+			tlsconf.WithVerifiedX509KeyPair(d.Cert, d.Key, tlsconf.ForRole(tlsconf.RoleClient)),
+			tlsconf.WithRootCAFile(d.CA),
+			tlsconf.WithMinVersion(tls.VersionTLS12),
+		}
+		if d.ServerName != "" {
+			opts = append(opts, tlsconf.WithServerName(d.ServerName))
+		}
+		tlsConfig, err := tlsconf.Build(opts...)
+		if err != nil {
+			return nil, fmt.Errorf("destination %d: %w", i+1, err)
+		}
+		d.tlsConfig = tlsConfig
+		d.proxy = &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.Out.URL.Scheme = "https"
+				pr.Out.URL.Host = egressAddr(pr.In)
+			},
+			// the transport adds ALPN protocols to its config, which
+			// tunnels must not offer
+			Transport: &http.Transport{
+				DialContext:         e.dialer.DialContext,
+				TLSClientConfig:     tlsConfig.Clone(),
+				ForceAttemptHTTP2:   true,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+		}
+		e.destinations = append(e.destinations, &d)
+	}
+	return e, nil
+}
+
+// egressAddr is the "host:port" address of a request, using port 443
+// if none is given since requests are sent over mTLS.
+func egressAddr(r *http.Request) string {
+	if r.Method == http.MethodConnect {
+		return r.Host
+	}
+	if r.URL.Port() == "" {
+		return net.JoinHostPort(r.URL.Hostname(), "443")
+	}
+	return r.URL.Host
+}
+
+func (e *Egress) destination(addr string) (*Destination, bool) {
+	for _, d := range e.destinations {
+		if authz.MatchAddr(d.Hosts, addr) {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// ServeHTTP implements http.Handler.
+func (e *Egress) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect && !r.URL.IsAbs() {
+		http.Error(w, "expected a CONNECT or absolute-form proxy request", http.StatusBadRequest)
+		return
+	}
+
+	addr := egressAddr(r)
+	d, ok := e.destination(addr)
+	if !ok {
+		http.Error(w, fmt.Sprintf("no destination configured for %q", addr), http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		e.tunnel(w, r, d, addr)
+		return
+	}
+	d.proxy.ServeHTTP(w, r)
+}
+
+// tunnel connects to the destination over mTLS, then copies data
+// between the destination and the hijacked client connection.
+func (e *Egress) tunnel(w http.ResponseWriter, r *http.Request, d *Destination, addr string) {
+	tlsConfig := d.tlsConfig
+	if tlsConfig.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	dialer := &tls.Dialer{NetDialer: e.dialer, Config: tlsConfig}
+	upstream, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		log.Printf("proxy: %s: %s", addr, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "CONNECT is not supported over this connection", http.StatusInternalServerError)
+		return
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		log.Printf("proxy: %s: %s", addr, err)
+		return
+	}
+	defer conn.Close()
+
+	_, err = io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n")
+	if err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		// data the client sent before the response is buffered
+		io.Copy(upstream, buf.Reader)
+		upstream.(*tls.Conn).CloseWrite()
+		close(done)
+	}()
+	io.Copy(conn, upstream)
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.CloseWrite()
+	}
+	<-done
+}
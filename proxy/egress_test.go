@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/picatz/mtls/identity"
+	"github.com/picatz/mtls/internal/testpki"
+	"github.com/stretchr/testify/require"
+)
+
+// whoami responds with the backend's name and the client's identity.
+func whoami(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := identity.FromContext(r.Context())
+		fmt.Fprintf(w, "%s %s %s", name, id.Name(), r.URL.Path)
+	})
+}
+
+// writeClientFiles writes a client cert and key pair, and the CA bundle
+// of the PKI, returning their paths.
+func writeClientFiles(t *testing.T, p *testpki.PKI, dir, commonName string) (string, string, string) {
+	certPEM, keyPEM := p.ClientPEM(cert.WithCommonName(commonName))
+	p.Write(dir, commonName, certPEM, keyPEM)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, commonName+".ca.pem"), p.CAPEM, 0600))
+	return commonName + ".pem", commonName + ".key.pem", commonName + ".ca.pem"
+}
+
+func startEgress(t *testing.T, config string) string {
+	dir, err := ioutil.TempDir("", "egress")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "egress.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(config), 0600))
+
+	c, err := LoadEgressConfig(path)
+	require.NoError(t, err)
+	egress, err := NewEgress(c)
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &http.Server{Handler: egress}
+	go s.Serve(listener)
+	t.Cleanup(func() { s.Close() })
+	return listener.Addr().String()
+}
+
+func TestEgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "egress")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// each destination trusts a different CA
+	payments, ledger := testpki.New(t), testpki.New(t)
+	paymentsAddr := startMTLS(t, payments, whoami("payments"))
+	ledgerAddr := startMTLS(t, ledger, whoami("ledger"))
+	paymentsPort := paymentsAddr[len("127.0.0.1:"):]
+	ledgerPort := ledgerAddr[len("127.0.0.1:"):]
+
+	paymentsCert, paymentsKey, paymentsCA := writeClientFiles(t, payments, dir, "payments-client")
+	ledgerCert, ledgerKey, ledgerCA := writeClientFiles(t, ledger, dir, "ledger-client")
+
+	proxyAddr := startEgress(t, fmt.Sprintf(`
+destinations:
+  - hosts: ["localhost:%s"]
+    cert: %s
+    key: %s
+    ca: %s
+  - hosts: ["localhost:%s"]
+    cert: %s
+    key: %s
+    ca: %s
+  - hosts: ["localhost:1-1024"]
+    cert: %s
+    key: %s
+    ca: %s
+`,
+		paymentsPort, filepath.Join(dir, paymentsCert), filepath.Join(dir, paymentsKey), filepath.Join(dir, paymentsCA),
+		ledgerPort, filepath.Join(dir, ledgerCert), filepath.Join(dir, ledgerKey), filepath.Join(dir, ledgerCA),
+		filepath.Join(dir, paymentsCert), filepath.Join(dir, paymentsKey), filepath.Join(dir, paymentsCA),
+	))
+
+	proxyURL, err := url.Parse("http://" + proxyAddr)
+	require.NoError(t, err)
+	c := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	get := func(target string) (int, string) {
+		resp, err := c.Get(target)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	// plain HTTP requests are sent over mTLS, using the cert for each
+	// destination
+	status, body := get("http://localhost:" + paymentsPort + "/charges")
+	require.Equal(t, http.StatusOK, status, body)
+	require.Equal(t, "payments payments-client /charges", body)
+
+	status, body = get("http://localhost:" + ledgerPort + "/entries")
+	require.Equal(t, http.StatusOK, status, body)
+	require.Equal(t, "ledger ledger-client /entries", body)
+
+	status, _ = get("http://example.com:" + paymentsPort + "/")
+	require.Equal(t, http.StatusForbidden, status)
+
+	connect := func(addr string) (*http.Response, net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", proxyAddr)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", addr, addr)
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, nil)
+		require.NoError(t, err)
+		return resp, conn, br
+	}
+
+	// tunnels carry plaintext from the app, sent over mTLS
+	resp, conn, br := connect("localhost:" + ledgerPort)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	fmt.Fprintf(conn, "GET /balance HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	resp, err = http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	balance, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "ledger ledger-client /balance", string(balance))
+
+	resp, _, _ = connect("localhost:9")
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+	resp, _, _ = connect("db.internal:5432")
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestEgressVerifiesDestination(t *testing.T) {
+	dir, err := ioutil.TempDir("", "egress")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	payments, other := testpki.New(t), testpki.New(t)
+	paymentsAddr := startMTLS(t, payments, whoami("payments"))
+	paymentsCert, paymentsKey, _ := writeClientFiles(t, payments, dir, "payments-client")
+	_, _, otherCA := writeClientFiles(t, other, dir, "other")
+
+	proxyAddr := startEgress(t, fmt.Sprintf(`
+destinations:
+  - hosts: ["localhost:*"]
+    cert: %s
+    key: %s
+    ca: %s
+`, filepath.Join(dir, paymentsCert), filepath.Join(dir, paymentsKey), filepath.Join(dir, otherCA)))
+
+	proxyURL, err := url.Parse("http://" + proxyAddr)
+	require.NoError(t, err)
+	c := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	resp, err := c.Get("http://localhost:" + paymentsAddr[len("127.0.0.1:"):] + "/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
+
+func TestNewEgressErrors(t *testing.T) {
+	for _, data := range []string{
+		"destinations: []",
+		"destinations:\n  - {cert: c.pem, key: k.pem, ca: ca.pem}",
+		"destinations:\n  - {hosts: [db], cert: c.pem, key: k.pem, ca: ca.pem}",
+		"destinations:\n  - {hosts: ['db:5432'], cert: c.pem, key: k.pem}",
+		"destinations:\n  - {hosts: ['db:5432'], cert: missing.pem, key: missing.key.pem, ca: ca.pem}",
+	} {
+		config, err := ParseEgressConfig([]byte(data))
+		require.NoError(t, err, data)
+		_, err = NewEgress(config)
+		require.Error(t, err, data)
+	}
+}
@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/picatz/mtls/identity"
+)
+
+// IdentityHeader names an identity header added to proxied requests.
+type IdentityHeader string
+
+const (
+	// HeaderCN is the common name of the client cert.
+	HeaderCN IdentityHeader = "cn"
+	// HeaderSANs are the SANs of the client cert, such as
+	// "DNS:web.internal, URI:spiffe://example.org/web".
+	HeaderSANs IdentityHeader = "sans"
+	// HeaderSPIFFEID is the first spiffe:// URI SAN of the client cert.
+	HeaderSPIFFEID IdentityHeader = "spiffe"
+	// HeaderFingerprint is the hex SHA-256 fingerprint of the client cert.
+	HeaderFingerprint IdentityHeader = "fingerprint"
+	// HeaderXFCC is the X-Forwarded-Client-Cert header, with the client
+	// cert's hash, URL encoded PEM, subject and SANs.
+	HeaderXFCC IdentityHeader = "xfcc"
+)
+
+// DefaultIdentityHeaders are the identity headers added when none are
+// configured.
+var DefaultIdentityHeaders = []IdentityHeader{HeaderCN, HeaderSANs, HeaderSPIFFEID, HeaderFingerprint}
+
+// headerNames are the HTTP header names of each identity header. Every
+// one of them is removed from incoming requests, whether it is added or
+// not, so backends never see a copy sent by the client.
+var headerNames = map[IdentityHeader]string{
+	HeaderCN:          "X-Client-Cert-CN",
+	HeaderSANs:        "X-Client-Cert-SANs",
+	HeaderSPIFFEID:    "X-Client-SPIFFE-ID",
+	HeaderFingerprint: "X-Client-Cert-Fingerprint",
+	HeaderXFCC:        "X-Forwarded-Client-Cert",
+}
+
+// HeaderName returns the HTTP header name of the identity header.
+func (h IdentityHeader) HeaderName() string {
+	return headerNames[h]
+}
+
+func (h IdentityHeader) validate() error {
+	if _, ok := headerNames[h]; !ok {
+		return fmt.Errorf("unknown identity header %q", h)
+	}
+	return nil
+}
+
+// value returns the identity header's value for an identity, or "" if
+// the identity has none.
+func (h IdentityHeader) value(id *identity.Identity) string {
+	switch h {
+	case HeaderCN:
+		return id.CommonName
+	case HeaderSANs:
+		return strings.Join(sans(id), ", ")
+	case HeaderSPIFFEID:
+		return spiffeID(id)
+	case HeaderFingerprint:
+		return fingerprint(id)
+	case HeaderXFCC:
+		return xfcc(id)
+	default:
+		return ""
+	}
+}
+
+func sans(id *identity.Identity) []string {
+	var names []string
+	for _, name := range id.DNSNames {
+		names = append(names, "DNS:"+name)
+	}
+	for _, uri := range id.URIs {
+		names = append(names, "URI:"+uri)
+	}
+	for _, email := range id.EmailAddresses {
+		names = append(names, "email:"+email)
+	}
+	if id.Certificate != nil {
+		for _, ip := range id.Certificate.IPAddresses {
+			names = append(names, "IP:"+ip.String())
+		}
+	}
+	return names
+}
+
+func spiffeID(id *identity.Identity) string {
+	for _, uri := range id.URIs {
+		if strings.HasPrefix(uri, "spiffe://") {
+			return uri
+		}
+	}
+	return ""
+}
+
+func fingerprint(id *identity.Identity) string {
+	if id.Certificate == nil {
+		return ""
+	}
+	sum := sha256.Sum256(id.Certificate.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// xfcc formats an X-Forwarded-Client-Cert element, as used by Envoy.
+func xfcc(id *identity.Identity) string {
+	if id.Certificate == nil {
+		return ""
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: id.Certificate.Raw})
+
+	fields := []string{
+		"Hash=" + fingerprint(id),
+		"Cert=" + quote(strings.ReplaceAll(url.QueryEscape(string(certPEM)), "+", "%20")),
+		"Subject=" + quote(id.Certificate.Subject.String()),
+	}
+	for _, uri := range id.URIs {
+		fields = append(fields, "URI="+quoteIfNeeded(uri))
+	}
+	for _, name := range id.DNSNames {
+		fields = append(fields, "DNS="+quoteIfNeeded(name))
+	}
+	return strings.Join(fields, ";")
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// quoteIfNeeded quotes values containing the separators of the header,
+// like Envoy, so they can't add fields such as a fake Hash.
+func quoteIfNeeded(s string) string {
+	if strings.ContainsAny(s, `,;="\`) {
+		return quote(s)
+	}
+	return s
+}
+
+// setIdentityHeaders removes every identity header from the request,
+// then adds the given ones for the identity.
+func setIdentityHeaders(header http.Header, id *identity.Identity, headers []IdentityHeader) {
+	for _, name := range headerNames {
+		header.Del(name)
+	}
+	for _, h := range headers {
+		if value := h.value(id); value != "" {
+			header.Set(h.HeaderName(), value)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/picatz/mtls/client"
+	"github.com/picatz/mtls/identity"
+	"github.com/picatz/mtls/internal/testpki"
+	"github.com/picatz/mtls/mtlshttp"
+	"github.com/picatz/mtls/server"
+	"github.com/stretchr/testify/require"
+)
+
+// startMTLS serves the handler over mTLS, returning its address.
+func startMTLS(t *testing.T, p *testpki.PKI, h http.Handler) string {
+	s, err := mtlshttp.NewServer(h,
+		server.WithAddr("127.0.0.1:0"),
+		server.WithTLSConfig(p.ServerTLSConfig(cert.WithCommonName("proxy"))),
+	)
+	require.NoError(t, err)
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+	return s.Addr().String()
+}
+
+// mtlsClient returns an HTTP client presenting a client cert.
+func mtlsClient(t *testing.T, p *testpki.PKI, opts ...cert.CertOption) *http.Client {
+	rt, err := mtlshttp.NewTransport(client.WithTLSConfig(p.ClientTLSConfig(opts...)))
+	require.NoError(t, err)
+	t.Cleanup(func() { rt.Close() })
+	return &http.Client{Transport: rt}
+}
+
+// echoBackend returns a plaintext backend responding with its name, the
+// request path and the request headers.
+func echoBackend(t *testing.T, name string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", name)
+		w.Header().Set("X-Path", r.URL.Path)
+		for name, values := range r.Header {
+			w.Header()["Echo-"+name] = values
+		}
+	})}
+	go s.Serve(listener)
+	t.Cleanup(func() { s.Close() })
+	return "http://" + listener.Addr().String()
+}
+
+func mustURI(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	require.NoError(t, err)
+	return u
+}
+
+func TestReverse(t *testing.T) {
+	p := testpki.New(t)
+
+	config, err := ParseReverseConfig([]byte(fmt.Sprintf(`
+headers: [cn, sans, spiffe, fingerprint, xfcc]
+routes:
+  - path: /admin
+    identities: [alice]
+    backend: %s
+  - path: /
+    identities: ["spiffe://example.org/*", alice]
+    backend: %s/app
+`, echoBackend(t, "admin"), echoBackend(t, "app"))))
+	require.NoError(t, err)
+	reverse, err := NewReverse(config)
+	require.NoError(t, err)
+	addr := startMTLS(t, p, reverse)
+	base := "https://localhost:" + addr[len("127.0.0.1:"):]
+
+	alice := mtlsClient(t, p, cert.WithCommonName("alice"), cert.WithDNSNames("alice.internal"))
+	web := mtlsClient(t, p, cert.WithCommonName("web"), cert.WithURIs(mustURI(t, "spiffe://example.org/web")))
+	mallory := mtlsClient(t, p, cert.WithCommonName("mallory"))
+
+	get := func(c *http.Client, path string, header http.Header) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, base+path, nil)
+		require.NoError(t, err)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		resp, err := c.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	// spoofed identity headers are replaced
+	resp := get(alice, "/admin/users", http.Header{
+		"X-Client-Cert-Cn":        {"root"},
+		"X-Client-Spiffe-Id":      {"spiffe://example.org/admin"},
+		"X-Forwarded-Client-Cert": {"Hash=0"},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "admin", resp.Header.Get("X-Backend"))
+	require.Equal(t, "/admin/users", resp.Header.Get("X-Path"))
+	require.Equal(t, []string{"alice"}, resp.Header["Echo-X-Client-Cert-Cn"])
+	require.Equal(t, "DNS:alice.internal", resp.Header.Get("Echo-X-Client-Cert-Sans"))
+	require.Empty(t, resp.Header["Echo-X-Client-Spiffe-Id"])
+	require.Len(t, resp.Header.Get("Echo-X-Client-Cert-Fingerprint"), 64)
+	xfcc := resp.Header["Echo-X-Forwarded-Client-Cert"]
+	require.Len(t, xfcc, 1)
+	require.Contains(t, xfcc[0], "Hash="+resp.Header.Get("Echo-X-Client-Cert-Fingerprint")+";Cert=\"-----BEGIN%20CERTIFICATE-----%0A")
+	require.Contains(t, xfcc[0], `;Subject="CN=alice";DNS=alice.internal`)
+	require.Equal(t, "https", resp.Header.Get("Echo-X-Forwarded-Proto"))
+
+	resp = get(alice, "/adminx", nil)
+	require.Equal(t, "app", resp.Header.Get("X-Backend"))
+	require.Equal(t, "/app/adminx", resp.Header.Get("X-Path"))
+
+	// the same path is routed per identity
+	resp = get(web, "/admin/users", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "app", resp.Header.Get("X-Backend"))
+	require.Equal(t, "spiffe://example.org/web", resp.Header.Get("Echo-X-Client-Spiffe-Id"))
+
+	resp = get(mallory, "/", http.Header{"X-Client-Cert-Cn": {"alice"}})
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestReversePathTraversal(t *testing.T) {
+	p := testpki.New(t)
+
+	config, err := ParseReverseConfig([]byte(fmt.Sprintf(`
+routes:
+  - path: /admin/
+    identities: [alice]
+    backend: %s
+  - path: /public/
+    identities: ["*"]
+    backend: %s
+`, echoBackend(t, "admin"), echoBackend(t, "public"))))
+	require.NoError(t, err)
+	reverse, err := NewReverse(config)
+	require.NoError(t, err)
+	addr := startMTLS(t, p, reverse)
+	base := "https://localhost:" + addr[len("127.0.0.1:"):]
+
+	alice := mtlsClient(t, p, cert.WithCommonName("alice"))
+	mallory := mtlsClient(t, p, cert.WithCommonName("mallory"))
+
+	get := func(c *http.Client, path string) *http.Response {
+		resp, err := c.Get(base + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	for _, path := range []string{
+		"/public/../admin/users",
+		"/public/%2e%2e/admin/users",
+		"/public/%2E%2E%2Fadmin/users",
+		"/public/./x",
+	} {
+		resp := get(mallory, path)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+		require.Empty(t, resp.Header.Get("X-Backend"), path)
+	}
+
+	resp := get(mallory, "//admin/users")
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// duplicate slashes are removed before matching and proxying
+	resp = get(alice, "//admin//users/")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "admin", resp.Header.Get("X-Backend"))
+	require.Equal(t, "/admin/users/", resp.Header.Get("X-Path"))
+
+	resp = get(mallory, "/public/x")
+	require.Equal(t, "public", resp.Header.Get("X-Backend"))
+}
+
+func TestNewReverseErrors(t *testing.T) {
+	for _, data := range []string{
+		"routes: []",
+		"routes:\n  - {path: api, identities: ['*'], backend: 'http://127.0.0.1:80'}",
+		"routes:\n  - {path: /, backend: 'http://127.0.0.1:80'}",
+		"routes:\n  - {path: /, identities: ['*'], backend: '127.0.0.1:80'}",
+		"headers: [cookie]\nroutes:\n  - {path: /, identities: ['*'], backend: 'http://127.0.0.1:80'}",
+	} {
+		config, err := ParseReverseConfig([]byte(data))
+		require.NoError(t, err, data)
+		_, err = NewReverse(config)
+		require.Error(t, err, data)
+	}
+}
+
+func TestXFCCQuotesURIs(t *testing.T) {
+	p := testpki.New(t)
+	keyPair := p.Client(
+		cert.WithCommonName("web"),
+		cert.WithURIs(mustURI(t, "spiffe://example.org/web;Hash=0,By=spiffe://example.org/admin")),
+		cert.WithDNSNames("web.internal"),
+	)
+
+	value := xfcc(identity.FromCertificate(keyPair.Leaf))
+	require.Contains(t, value, `;URI="spiffe://example.org/web;Hash=0,By=spiffe://example.org/admin";DNS=web.internal`)
+	require.Equal(t, 1, strings.Count(value, "Hash="+fingerprint(identity.FromCertificate(keyPair.Leaf))))
+}
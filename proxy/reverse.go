@@ -0,0 +1,195 @@
+// Package proxy implements HTTP proxies terminating and originating mTLS
+// connections.
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/picatz/mtls/authz"
+	"github.com/picatz/mtls/identity"
+	"gopkg.in/yaml.v3"
+)
+
+// ReverseConfig configures a Reverse proxy.
+type ReverseConfig struct {
+	// Headers are the identity headers added to proxied requests, or
+	// DefaultIdentityHeaders if empty.
+	Headers []IdentityHeader `yaml:"headers" json:"headers"`
+	// Routes are tried in order, and the first route matching both the
+	// path and identity of a request is used.
+	Routes []Route `yaml:"routes" json:"routes"`
+}
+
+// Route sends requests for a path from matching identities to a backend.
+type Route struct {
+	// Path is a path prefix, such as "/api/", which matches "/api/users".
+	// Without a trailing slash, "/api" matches "/api" and "/api/users"
+	// but not "/apis". Request paths are matched after removing
+	// duplicate slashes, and requests with "." or ".." segments are
+	// refused.
+	Path string `yaml:"path" json:"path"`
+	// Identities are glob patterns matched against an identity's name or
+	// common name, like policy rules. "*" matches any identity.
+	Identities []string `yaml:"identities" json:"identities"`
+	// Backend is the plaintext "http://host:port" URL requests are sent
+	// to, with the request path appended to the URL's path.
+	Backend string `yaml:"backend" json:"backend"`
+
+	backend *url.URL
+}
+
+func (r *Route) matchesPath(p string) bool {
+	if !strings.HasPrefix(p, r.Path) {
+		return false
+	}
+	return len(p) == len(r.Path) || strings.HasSuffix(r.Path, "/") || p[len(r.Path)] == '/'
+}
+
+// cleanPath cleans the request path the way routes are matched, keeping
+// its trailing slash.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// hasDotSegment reports whether the path has a "." or ".." segment,
+// including percent-encoded ones.
+func hasDotSegment(p string) bool {
+	for _, segment := range strings.Split(p, "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			unescaped = segment
+		}
+		if unescaped == "." || unescaped == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseReverseConfig parses a YAML (or JSON) encoded ReverseConfig.
+func ParseReverseConfig(data []byte) (*ReverseConfig, error) {
+	var c ReverseConfig
+	err := yaml.Unmarshal(data, &c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// LoadReverseConfig reads a ReverseConfig from a YAML (or JSON) file.
+func LoadReverseConfig(path string) (*ReverseConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := ParseReverseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", path, err)
+	}
+	return c, nil
+}
+
+// Reverse is an http.Handler proxying requests from mTLS clients to
+// plaintext backends, chosen by path and client identity. It must be
+// served using mtlshttp, which adds the identity of the verified client
+// cert to the request context.
+type Reverse struct {
+	headers []IdentityHeader
+	routes  []Route
+	proxy   *httputil.ReverseProxy
+}
+
+// NewReverse creates a Reverse proxy using the given config.
+func NewReverse(config *ReverseConfig) (*Reverse, error) {
+	r := &Reverse{headers: config.Headers}
+	if len(r.headers) == 0 {
+		r.headers = DefaultIdentityHeaders
+	}
+	for _, h := range r.headers {
+		err := h.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(config.Routes) == 0 {
+		return nil, fmt.Errorf("no routes")
+	}
+	for i, route := range config.Routes {
+		if !strings.HasPrefix(route.Path, "/") {
+			return nil, fmt.Errorf("route %d: path %q must start with /", i+1, route.Path)
+		}
+		if len(route.Identities) == 0 {
+			return nil, fmt.Errorf("route %d has no identities", i+1)
+		}
+		backend, err := url.Parse(route.Backend)
+		if err != nil {
+			return nil, fmt.Errorf("route %d: %w", i+1, err)
+		}
+		if (backend.Scheme != "http" && backend.Scheme != "https") || backend.Host == "" {
+			return nil, fmt.Errorf("route %d: backend %q must be an http:// URL", i+1, route.Backend)
+		}
+		route.backend = backend
+		r.routes = append(r.routes, route)
+	}
+
+	r.proxy = &httputil.ReverseProxy{Rewrite: r.rewrite}
+	return r, nil
+}
+
+type routeKey struct{}
+
+func (r *Reverse) rewrite(pr *httputil.ProxyRequest) {
+	route := pr.In.Context().Value(routeKey{}).(*Route)
+	id, _ := identity.FromContext(pr.In.Context())
+
+	pr.SetURL(route.backend)
+	pr.SetXForwarded()
+	setIdentityHeaders(pr.Out.Header, id, r.headers)
+}
+
+// ServeHTTP implements http.Handler.
+func (r *Reverse) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	id, ok := identity.FromContext(req.Context())
+	if !ok {
+		http.Error(w, "client certificate required", http.StatusUnauthorized)
+		return
+	}
+
+	// backends may resolve dot segments the routes didn't see, such as
+	// "/public/../admin"
+	if hasDotSegment(req.URL.Path) || hasDotSegment(req.URL.RawPath) {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	u := *req.URL
+	u.Path = cleanPath(u.Path)
+	if u.RawPath != "" {
+		u.RawPath = cleanPath(u.RawPath)
+	}
+
+	for i := range r.routes {
+		route := &r.routes[i]
+		if route.matchesPath(u.Path) && authz.MatchIdentity(route.Identities, id) {
+			out := req.WithContext(context.WithValue(req.Context(), routeKey{}, route))
+			out.URL = &u
+			r.proxy.ServeHTTP(w, out)
+			return
+		}
+	}
+	http.Error(w, "forbidden", http.StatusForbidden)
+}
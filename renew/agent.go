@@ -0,0 +1,313 @@
+// Package renew implements an agent that keeps a short-lived
+// certificate and key pair on disk renewed.
+package renew
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Event is sent to subscribers after every renewal attempt.
+type Event struct {
+	// Certificate is the newly issued certificate, or nil if the
+	// renewal failed.
+	Certificate *x509.Certificate
+	// Err is the reason the renewal failed, if it did.
+	Err error
+}
+
+// Agent watches a certificate and key pair on disk, re-issuing it from
+// an Issuer before a configured fraction of its lifetime has passed.
+type Agent struct {
+	certFile      string
+	keyFile       string
+	issuer        Issuer
+	renewAfter    float64
+	checkInterval time.Duration
+
+	mu          sync.RWMutex
+	current     *tls.Certificate
+	subscribers []chan Event
+}
+
+// New creates a new Agent for the given certificate and key files,
+// applying the given Option(s).
+func New(certFile, keyFile string, issuer Issuer, opts ...Option) (*Agent, error) {
+	agentOptions := &Options{
+		RenewAfter:    DefaultRenewAfter,
+		CheckInterval: DefaultCheckInterval,
+	}
+
+	for _, opt := range opts {
+		err := opt(agentOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Agent{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		issuer:        issuer,
+		renewAfter:    agentOptions.RenewAfter,
+		checkInterval: agentOptions.CheckInterval,
+	}, nil
+}
+
+// Subscribe returns a channel that receives an Event after every renewal
+// attempt. Events are dropped if the channel's buffer is full.
+func (a *Agent) Subscribe() <-chan Event {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ch := make(chan Event, 1)
+	a.subscribers = append(a.subscribers, ch)
+	return ch
+}
+
+// Unsubscribe stops sending events to a channel returned by Subscribe,
+// and closes it.
+func (a *Agent) Unsubscribe(events <-chan Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i, ch := range a.subscribers {
+		if ch == events {
+			a.subscribers = append(a.subscribers[:i], a.subscribers[i+1:]...)
+			close(ch)
+			return
+		}
+	}
+}
+
+func (a *Agent) notify(event Event) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, ch := range a.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// LoadKeyPair is like tls.LoadX509KeyPair, but reads the pair from the
+// key file alone when it also holds the certificate, as written by an
+// Agent. The key file is replaced in a single rename, so its cert and
+// key always match, unlike reading the two files separately. Readers of
+// the files an Agent renews should use it.
+func LoadKeyPair(certFile, keyFile string) (tls.Certificate, error) {
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	certPEM := keyPEM
+	if !hasCertificate(keyPEM) {
+		certPEM, err = ioutil.ReadFile(certFile)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+
+	keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if keyPair.Leaf == nil {
+		keyPair.Leaf, err = x509.ParseCertificate(keyPair.Certificate[0])
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	return keyPair, nil
+}
+
+// hasCertificate reports whether the PEM data contains a certificate.
+func hasCertificate(data []byte) bool {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return false
+		}
+		if block.Type == "CERTIFICATE" {
+			return true
+		}
+	}
+}
+
+// load reads the watched certificate and key pair from disk.
+func (a *Agent) load() (*tls.Certificate, error) {
+	keyPair, err := LoadKeyPair(a.certFile, a.keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	a.current = &keyPair
+	a.mu.Unlock()
+
+	return &keyPair, nil
+}
+
+// RenewAt returns when the given certificate should be renewed.
+func (a *Agent) RenewAt(c *x509.Certificate) time.Time {
+	lifetime := c.NotAfter.Sub(c.NotBefore)
+	return c.NotBefore.Add(time.Duration(float64(lifetime) * a.renewAfter))
+}
+
+// RenewIfNeeded reloads the watched files, renewing them if enough of
+// the certificate's lifetime has passed. It reports whether the
+// certificate was renewed.
+func (a *Agent) RenewIfNeeded(ctx context.Context) (bool, error) {
+	keyPair, err := a.load()
+	if err != nil {
+		return false, err
+	}
+
+	if time.Now().Before(a.RenewAt(keyPair.Leaf)) {
+		return false, nil
+	}
+
+	return true, a.renew(ctx, keyPair.Leaf)
+}
+
+// Renew unconditionally re-issues the watched certificate and key pair.
+func (a *Agent) Renew(ctx context.Context) error {
+	keyPair, err := a.load()
+	if err != nil {
+		return err
+	}
+	return a.renew(ctx, keyPair.Leaf)
+}
+
+func (a *Agent) renew(ctx context.Context, current *x509.Certificate) error {
+	err := a.issue(ctx, current)
+	if err != nil {
+		err = fmt.Errorf("failed to renew %q: %w", a.certFile, err)
+		a.notify(Event{Err: err})
+		return err
+	}
+
+	a.mu.RLock()
+	leaf := a.current.Leaf
+	a.mu.RUnlock()
+
+	a.notify(Event{Certificate: leaf})
+	return nil
+}
+
+func (a *Agent) issue(ctx context.Context, current *x509.Certificate) error {
+	certPEM, keyPEM, err := a.issuer.Issue(ctx, current)
+	if err != nil {
+		return err
+	}
+
+	keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("issued invalid cert and key pair: %w", err)
+	}
+	if keyPair.Leaf == nil {
+		keyPair.Leaf, err = x509.ParseCertificate(keyPair.Certificate[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	// the key file also holds the cert, so LoadKeyPair reads a matching
+	// pair from it even between the two renames
+	err = writeFileAtomic(a.keyFile, append(append([]byte(nil), keyPEM...), certPEM...), 0600)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(a.certFile, certPEM, 0644)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.current = &keyPair
+	a.mu.Unlock()
+
+	return nil
+}
+
+// Run checks the watched certificate every check interval, renewing it
+// when needed, until the context is done. Failed renewals are reported
+// to subscribers and retried on the next check.
+func (a *Agent) Run(ctx context.Context) error {
+	ticker := time.NewTicker(a.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		_, err := a.RenewIfNeeded(ctx)
+		if err != nil && a.Certificate() == nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Certificate returns the most recently loaded or issued certificate
+// and key pair, or nil if none has been loaded yet.
+func (a *Agent) Certificate() *tls.Certificate {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.current
+}
+
+// GetCertificate can be used as a tls.Config GetCertificate hook, so
+// servers always present the current certificate.
+func (a *Agent) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if c := a.Certificate(); c != nil {
+		return c, nil
+	}
+	return a.load()
+}
+
+// GetClientCertificate can be used as a tls.Config GetClientCertificate
+// hook, so clients always present the current certificate.
+func (a *Agent) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return a.GetCertificate(nil)
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory
+// as path, then renames it over path.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,166 @@
+package renew
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/picatz/mtls/internal/testpki"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestPKI writes a CA and a client cert/key pair signed by it into dir,
+// returning the CA issuer and the client cert and key file paths.
+func writeTestPKI(t *testing.T, dir string, lifetime time.Duration) (*LocalCA, string, string) {
+	pki := testpki.New(t)
+	caFile, caKeyFile := pki.WriteCA(dir)
+
+	clientPEM, clientPrivKeyPEM := pki.ClientPEM(
+		cert.WithCommonName("client"),
+		cert.WithDNSNames("client.example.com"),
+		cert.IsValidFor(lifetime),
+	)
+	certFile, keyFile := pki.Write(dir, "client", clientPEM, clientPrivKeyPEM)
+
+	return &LocalCA{CACertFile: caFile, CAKeyFile: caKeyFile}, certFile, keyFile
+}
+
+func TestAgentRenewIfNeeded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "renew")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	issuer, certFile, keyFile := writeTestPKI(t, dir, time.Hour)
+
+	agent, err := New(certFile, keyFile, issuer)
+	require.NoError(t, err)
+
+	renewed, err := agent.RenewIfNeeded(context.Background())
+	require.NoError(t, err)
+	require.False(t, renewed)
+
+	original := agent.Certificate().Leaf
+
+	agent, err = New(certFile, keyFile, issuer, WithRenewAfter(0.000001))
+	require.NoError(t, err)
+
+	events := agent.Subscribe()
+
+	renewed, err = agent.RenewIfNeeded(context.Background())
+	require.NoError(t, err)
+	require.True(t, renewed)
+
+	event := <-events
+	require.NoError(t, event.Err)
+	require.NotEqual(t, original.SerialNumber, event.Certificate.SerialNumber)
+	require.Equal(t, "client", event.Certificate.Subject.CommonName)
+	require.Equal(t, []string{"client.example.com"}, event.Certificate.DNSNames)
+	require.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, event.Certificate.ExtKeyUsage)
+
+	keyPair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	require.Equal(t, event.Certificate.Raw, keyPair.Certificate[0])
+
+	info, err := os.Stat(keyFile)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	current, err := agent.GetClientCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, event.Certificate.Raw, current.Certificate[0])
+}
+
+func TestAgentUnsubscribe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "renew")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	issuer, certFile, keyFile := writeTestPKI(t, dir, time.Hour)
+
+	agent, err := New(certFile, keyFile, issuer)
+	require.NoError(t, err)
+
+	events := agent.Subscribe()
+	agent.Unsubscribe(events)
+	_, ok := <-events
+	require.False(t, ok)
+
+	// renewals no longer send to it, and unsubscribing again does nothing
+	require.NoError(t, agent.Renew(context.Background()))
+	agent.Unsubscribe(events)
+}
+
+func TestAgentRunReportsFailures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "renew")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, certFile, keyFile := writeTestPKI(t, dir, time.Hour)
+
+	issueErr := errors.New("issuer unavailable")
+	issuer := IssuerFunc(func(ctx context.Context, current *x509.Certificate) ([]byte, []byte, error) {
+		return nil, nil, issueErr
+	})
+
+	agent, err := New(certFile, keyFile, issuer,
+		WithRenewAfter(0.000001),
+		WithCheckInterval(10*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	events := agent.Subscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- agent.Run(ctx)
+	}()
+
+	event := <-events
+	require.True(t, errors.Is(event.Err, issueErr))
+	require.NotNil(t, agent.Certificate())
+
+	cancel()
+	require.Equal(t, context.Canceled, <-done)
+}
+
+func TestLoadKeyPairBetweenRenames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "renew")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	issuer, certFile, keyFile := writeTestPKI(t, dir, time.Hour)
+
+	agent, err := New(certFile, keyFile, issuer)
+	require.NoError(t, err)
+
+	oldCertPEM, err := ioutil.ReadFile(certFile)
+	require.NoError(t, err)
+	current, err := LoadKeyPair(certFile, keyFile)
+	require.NoError(t, err)
+
+	require.NoError(t, agent.Renew(context.Background()))
+
+	// the key file has been replaced, but not the cert file yet
+	require.NoError(t, writeFileAtomic(certFile, oldCertPEM, 0644))
+
+	keyPair, err := LoadKeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	require.NotEqual(t, current.Leaf.SerialNumber, keyPair.Leaf.SerialNumber)
+
+	// a key file without a cert is paired with the cert file
+	_, err = LoadKeyPair(certFile, filepath.Join(dir, "ca.key.pem"))
+	require.Error(t, err)
+}
+
+func TestWithRenewAfterInvalid(t *testing.T) {
+	_, err := New("cert.pem", "key.pem", &LocalCA{}, WithRenewAfter(1.5))
+	require.Error(t, err)
+}
@@ -0,0 +1,77 @@
+package renew
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"io/ioutil"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+)
+
+// Issuer issues a new PEM encoded certificate and private key to
+// replace the current certificate.
+type Issuer interface {
+	Issue(ctx context.Context, current *x509.Certificate) (certPEM, keyPEM []byte, err error)
+}
+
+// IssuerFunc implements an Issuer using a function.
+type IssuerFunc func(ctx context.Context, current *x509.Certificate) ([]byte, []byte, error)
+
+// Issue calls the function.
+func (f IssuerFunc) Issue(ctx context.Context, current *x509.Certificate) ([]byte, []byte, error) {
+	return f(ctx, current)
+}
+
+// LocalCA issues certificates using CA files on disk, which are read
+// again for every issued certificate.
+type LocalCA struct {
+	CACertFile string
+	CAKeyFile  string
+	// Lifetime of issued certificates, or the lifetime of the current
+	// certificate if zero.
+	Lifetime time.Duration
+	// Options are applied to every issued certificate, after the
+	// subject and SANs copied from the current certificate.
+	Options []cert.CertOption
+}
+
+// Issue re-issues the current certificate with a new key, keeping its
+// subject and SANs. Certificates with the server auth
+// extended key usage are issued using cert.NewServerFromCA, otherwise
+// cert.NewClientFromCA is used.
+func (ca *LocalCA) Issue(ctx context.Context, current *x509.Certificate) ([]byte, []byte, error) {
+	caCertPEM, err := ioutil.ReadFile(ca.CACertFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	caKeyPEM, err := ioutil.ReadFile(ca.CAKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lifetime := ca.Lifetime
+	if lifetime == 0 {
+		lifetime = current.NotAfter.Sub(current.NotBefore)
+	}
+
+	opts := []cert.CertOption{
+		cert.WithSubject(current.Subject),
+		cert.WithDNSNames(current.DNSNames...),
+		cert.WithIPAddresses(current.IPAddresses...),
+		cert.WithURIs(current.URIs...),
+		cert.WithEmailAddresses(current.EmailAddresses...),
+		cert.IsValidFor(lifetime),
+	}
+	opts = append(opts, ca.Options...)
+
+	newFromCA := cert.NewClientFromCA
+	for _, usage := range current.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageServerAuth {
+			newFromCA = cert.NewServerFromCA
+		}
+	}
+
+	return newFromCA(bytes.NewReader(caKeyPEM), bytes.NewReader(caCertPEM), opts...)
+}
@@ -0,0 +1,48 @@
+package renew
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultRenewAfter is the default fraction of a certificate's lifetime
+// after which it is renewed.
+const DefaultRenewAfter = 2.0 / 3.0
+
+// DefaultCheckInterval is the default interval between checks of the
+// watched certificate.
+const DefaultCheckInterval = time.Minute
+
+// Options contains each available configuration option
+// for an Agent.
+type Options struct {
+	RenewAfter    float64
+	CheckInterval time.Duration
+}
+
+// Option implements a hook to customize an Agent
+// using the New function.
+type Option func(*Options) error
+
+// WithRenewAfter sets the fraction of a certificate's lifetime, between
+// 0 and 1, after which it is renewed.
+func WithRenewAfter(fraction float64) Option {
+	return func(o *Options) error {
+		if fraction <= 0 || fraction >= 1 {
+			return fmt.Errorf("renew after fraction %v must be between 0 and 1", fraction)
+		}
+		o.RenewAfter = fraction
+		return nil
+	}
+}
+
+// WithCheckInterval sets how often the watched certificate is checked.
+func WithCheckInterval(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return fmt.Errorf("check interval %v must be positive", d)
+		}
+		o.CheckInterval = d
+		return nil
+	}
+}
@@ -1,6 +1,10 @@
 package server
 
-import "crypto/tls"
+import (
+	"crypto/tls"
+
+	"github.com/picatz/mtls/mux"
+)
 
 // Options contains each available configuration option
 // for an mTLS SSH Server.
@@ -8,6 +12,9 @@ type Options struct {
 	Addr      string
 	TLSConfig *tls.Config
 	Handler   func(*tls.Conn)
+
+	StreamHandler StreamHandler
+	MuxOptions    []mux.Option
 }
 
 // Option implements a hook to custom a Server
@@ -37,3 +44,14 @@ func WithHandler(h func(*tls.Conn)) Option {
 		return nil
 	}
 }
+
+// WithStreamHandler multiplexes streams over each connection, handing
+// every stream opened by the client to the handler instead of using the
+// connection handler.
+func WithStreamHandler(h StreamHandler, opts ...mux.Option) Option {
+	return func(o *Options) error {
+		o.StreamHandler = h
+		o.MuxOptions = opts
+		return nil
+	}
+}
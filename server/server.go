@@ -4,14 +4,24 @@ import (
 	"crypto/tls"
 	"log"
 	"net"
+
+	"github.com/picatz/mtls/identity"
+	"github.com/picatz/mtls/mux"
 )
 
+// StreamHandler handles a stream multiplexed over a client connection,
+// along with the identity of the connection's verified client cert.
+type StreamHandler func(stream *mux.Stream, peer *identity.Identity)
+
 // Server implements an mTLS server.
 type Server struct {
 	addr      string
 	tlsConfig *tls.Config
 	listener  net.Listener
 	handler   func(*tls.Conn)
+
+	streamHandler StreamHandler
+	muxOptions    []mux.Option
 }
 
 // New implements a wrappeer to create a new Server,
@@ -33,6 +43,8 @@ func New(opts ...Option) (*Server, error) {
 	server.addr = serverOptions.Addr
 	server.tlsConfig = serverOptions.TLSConfig
 	server.handler = serverOptions.Handler
+	server.streamHandler = serverOptions.StreamHandler
+	server.muxOptions = serverOptions.MuxOptions
 
 	listener, err := tls.Listen("tcp", server.addr, server.tlsConfig)
 	if err != nil {
@@ -50,11 +62,42 @@ func (s *Server) Listener() net.Listener {
 
 // HandleConn will handle a connection from the server's accept loop.
 func (s *Server) HandleConn(conn *tls.Conn) {
+	if s.streamHandler != nil {
+		s.serveStreams(conn)
+		return
+	}
 	if s.handler != nil {
 		s.handler(conn)
 	}
 }
 
+// serveStreams hands every stream opened over the connection to the
+// stream handler, until the connection is closed.
+func (s *Server) serveStreams(conn *tls.Conn) {
+	defer conn.Close()
+
+	peer, err := identity.FromConn(conn)
+	if err != nil {
+		log.Printf("server: %s: %s", conn.RemoteAddr(), err)
+		return
+	}
+
+	session, err := mux.Server(conn, s.muxOptions...)
+	if err != nil {
+		log.Printf("server: %s: %s", conn.RemoteAddr(), err)
+		return
+	}
+	defer session.Close()
+
+	for {
+		stream, err := session.AcceptStream()
+		if err != nil {
+			return
+		}
+		go s.streamHandler(stream, peer)
+	}
+}
+
 // Start will start the server's accept loop.
 func (s *Server) Start() {
 	go func() {
@@ -5,12 +5,17 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"sync"
 	"testing"
 
 	"github.com/picatz/mtls/cert"
 	"github.com/picatz/mtls/client"
+	"github.com/picatz/mtls/identity"
+	"github.com/picatz/mtls/internal/testpki"
+	"github.com/picatz/mtls/mux"
 	"github.com/picatz/mtls/tlsconf"
 	"github.com/stretchr/testify/require"
 )
@@ -204,3 +209,78 @@ func TestServerClient(t *testing.T) {
 	err = conn.Close()
 	require.NoError(t, err)
 }
+
+func TestServerClientStreams(t *testing.T) {
+	pki := testpki.New(t)
+
+	var (
+		mu       sync.Mutex
+		sessions = map[*mux.Session]bool{}
+	)
+	s, err := New(
+		WithAddr("127.0.0.1:0"),
+		WithTLSConfig(pki.ServerTLSConfig()),
+		WithStreamHandler(func(stream *mux.Stream, peer *identity.Identity) {
+			defer stream.Close()
+
+			mu.Lock()
+			sessions[stream.Session()] = true
+			mu.Unlock()
+
+			fmt.Fprintf(stream, "hello %s\n", peer.CommonName)
+			io.Copy(stream, stream)
+		}, mux.WithMaxStreams(16)),
+	)
+	require.NoError(t, err)
+	defer s.Shutdown()
+	s.Start()
+
+	c, err := client.New(
+		client.WithAddr(s.Listener().Addr().String()),
+		client.WithTLSConfig(pki.ClientTLSConfig(cert.WithCommonName("client.name"))),
+	)
+	require.NoError(t, err)
+	defer c.Close()
+
+	// the streams report to the test goroutine, since require can't be
+	// used from other goroutines
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			errs <- echoStream(c, fmt.Sprintf("stream %d", i))
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		require.NoError(t, <-errs)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, sessions, 1)
+}
+
+// echoStream opens a stream, sends the message and checks it's echoed
+// back after the greeting.
+func echoStream(c *client.Client, msg string) error {
+	stream, err := c.OpenStream()
+	if err != nil {
+		return err
+	}
+	_, err = stream.Write([]byte(msg))
+	if err != nil {
+		return err
+	}
+	err = stream.Close()
+	if err != nil {
+		return err
+	}
+
+	reply, err := ioutil.ReadAll(stream)
+	if err != nil {
+		return err
+	}
+	if want := "hello client.name\n" + msg; string(reply) != want {
+		return fmt.Errorf("got reply %q, want %q", reply, want)
+	}
+	return nil
+}
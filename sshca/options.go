@@ -0,0 +1,141 @@
+package sshca
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultLifetime is the default lifetime of signed certificates.
+const DefaultLifetime = 8 * time.Hour
+
+// DefaultUserExtensions are the extensions of user certificates unless
+// they're replaced using WithExtensions, matching ssh-keygen's defaults.
+var DefaultUserExtensions = map[string]string{
+	"permit-X11-forwarding":   "",
+	"permit-agent-forwarding": "",
+	"permit-port-forwarding":  "",
+	"permit-pty":              "",
+	"permit-user-rc":          "",
+}
+
+// Options contains each available configuration option
+// for a signed certificate.
+type Options struct {
+	KeyID           string
+	Serial          uint64
+	Principals      []string
+	ValidAfter      time.Time
+	ValidBefore     time.Time
+	CriticalOptions map[string]string
+	Extensions      map[string]string
+}
+
+// Option implements a hook to customize a certificate signed
+// by a CA.
+type Option func(*Options) error
+
+// WithKeyID sets the key ID, which is logged by sshd when the
+// certificate is used.
+func WithKeyID(id string) Option {
+	return func(o *Options) error {
+		o.KeyID = id
+		return nil
+	}
+}
+
+// WithSerial sets the serial number, which is random by default.
+func WithSerial(serial uint64) Option {
+	return func(o *Options) error {
+		o.Serial = serial
+		return nil
+	}
+}
+
+// WithPrincipals adds the user names or host names the certificate is
+// valid for.
+func WithPrincipals(principals ...string) Option {
+	return func(o *Options) error {
+		o.Principals = append(o.Principals, principals...)
+		return nil
+	}
+}
+
+// IsValidFor sets the certificate to be valid from now for the given
+// duration.
+func IsValidFor(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return fmt.Errorf("lifetime %v must be positive", d)
+		}
+		now := time.Now()
+		o.ValidAfter = now
+		o.ValidBefore = now.Add(d)
+		return nil
+	}
+}
+
+// IsValidBetween sets the certificate's validity window.
+func IsValidBetween(after, before time.Time) Option {
+	return func(o *Options) error {
+		if !before.After(after) {
+			return fmt.Errorf("valid before %s must be after %s", before.Format(time.RFC3339), after.Format(time.RFC3339))
+		}
+		o.ValidAfter = after
+		o.ValidBefore = before
+		return nil
+	}
+}
+
+// WithCriticalOption sets a critical option of a user certificate, which
+// sshd refuses the certificate for if it doesn't understand it.
+func WithCriticalOption(name, value string) Option {
+	return func(o *Options) error {
+		if o.CriticalOptions == nil {
+			o.CriticalOptions = map[string]string{}
+		}
+		o.CriticalOptions[name] = value
+		return nil
+	}
+}
+
+// WithForceCommand sets the force-command critical option, so the
+// command is run instead of any the user asks for.
+func WithForceCommand(command string) Option {
+	return WithCriticalOption("force-command", command)
+}
+
+// WithSourceAddress sets the source-address critical option, limiting
+// the addresses the certificate can be used from to the given CIDRs.
+func WithSourceAddress(cidrs ...string) Option {
+	return func(o *Options) error {
+		if len(cidrs) == 0 {
+			return fmt.Errorf("no source addresses given")
+		}
+		return WithCriticalOption("source-address", strings.Join(cidrs, ","))(o)
+	}
+}
+
+// WithExtension adds an extension to a user certificate, such as
+// "permit-pty".
+func WithExtension(name, value string) Option {
+	return func(o *Options) error {
+		if o.Extensions == nil {
+			o.Extensions = map[string]string{}
+		}
+		o.Extensions[name] = value
+		return nil
+	}
+}
+
+// WithExtensions replaces every extension of a user certificate,
+// including the DefaultUserExtensions.
+func WithExtensions(extensions map[string]string) Option {
+	return func(o *Options) error {
+		o.Extensions = map[string]string{}
+		for name, value := range extensions {
+			o.Extensions[name] = value
+		}
+		return nil
+	}
+}
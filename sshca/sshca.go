@@ -0,0 +1,139 @@
+// Package sshca signs OpenSSH user and host certificates using the same
+// CA key as the X.509 CA.
+package sshca
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+	"golang.org/x/crypto/ssh"
+)
+
+// CA signs OpenSSH certificates with an X.509 CA's private key.
+type CA struct {
+	signer ssh.Signer
+}
+
+// New creates a new CA from the PEM encoded X.509 CA private key and
+// cert, which are checked to belong together.
+func New(caPrivKeyPEM, caCertPEM io.Reader) (*CA, error) {
+	_, caPrivKey, err := cert.ReadCertAndKey(caCertPEM, caPrivKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(caPrivKey)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{signer: signer}, nil
+}
+
+// PublicKey returns the CA's public key, which SSH clients and servers
+// are configured to trust.
+func (ca *CA) PublicKey() ssh.PublicKey {
+	return ca.signer.PublicKey()
+}
+
+// SignUserCert signs a user certificate for the public key, which is
+// valid for the principals given with WithPrincipals. User certificates
+// have the DefaultUserExtensions unless they're replaced.
+func (ca *CA) SignUserCert(pub ssh.PublicKey, opts ...Option) (*ssh.Certificate, error) {
+	o := &Options{Extensions: map[string]string{}}
+	for name, value := range DefaultUserExtensions {
+		o.Extensions[name] = value
+	}
+	return ca.sign(ssh.UserCert, pub, o, opts)
+}
+
+// SignHostCert signs a host certificate for the public key, which is
+// valid for the host names given with WithPrincipals. Host certificates
+// can't have critical options or extensions.
+func (ca *CA) SignHostCert(pub ssh.PublicKey, opts ...Option) (*ssh.Certificate, error) {
+	return ca.sign(ssh.HostCert, pub, &Options{}, opts)
+}
+
+func (ca *CA) sign(certType uint32, pub ssh.PublicKey, o *Options, opts []Option) (*ssh.Certificate, error) {
+	for _, opt := range opts {
+		err := opt(o)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(o.Principals) == 0 {
+		return nil, fmt.Errorf("at least one principal is required")
+	}
+	if certType == ssh.HostCert && (len(o.CriticalOptions) > 0 || len(o.Extensions) > 0) {
+		return nil, fmt.Errorf("host certificates can't have critical options or extensions")
+	}
+	if o.ValidBefore.IsZero() {
+		now := time.Now()
+		o.ValidAfter = now
+		o.ValidBefore = now.Add(DefaultLifetime)
+	}
+	if o.Serial == 0 {
+		var b [8]byte
+		_, err := io.ReadFull(rand.Reader, b[:])
+		if err != nil {
+			return nil, err
+		}
+		o.Serial = binary.BigEndian.Uint64(b[:])
+	}
+
+	c := &ssh.Certificate{
+		Key:             pub,
+		Serial:          o.Serial,
+		CertType:        certType,
+		KeyId:           o.KeyID,
+		ValidPrincipals: o.Principals,
+		ValidAfter:      uint64(o.ValidAfter.Unix()),
+		ValidBefore:     uint64(o.ValidBefore.Unix()),
+		Permissions: ssh.Permissions{
+			CriticalOptions: o.CriticalOptions,
+			Extensions:      o.Extensions,
+		},
+	}
+	err := c.SignCert(rand.Reader, ca.signer)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// PublicKeyFromCert returns the SSH public key of a PEM encoded X.509
+// CA cert, so trust lines can be written without the CA private key.
+func PublicKeyFromCert(caCertPEM []byte) (ssh.PublicKey, error) {
+	certs, err := cert.ParseCertificates(caCertPEM)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewPublicKey(certs[0].PublicKey)
+}
+
+// MarshalCertificate encodes a certificate in the format of an OpenSSH
+// -cert.pub file.
+func MarshalCertificate(c *ssh.Certificate) []byte {
+	return ssh.MarshalAuthorizedKey(c)
+}
+
+// KnownHostsLine returns a known_hosts line trusting host certificates
+// signed by the CA for hosts matching the given patterns, or any host
+// if none are given.
+func KnownHostsLine(caPub ssh.PublicKey, hostPatterns ...string) string {
+	hosts := "*"
+	if len(hostPatterns) > 0 {
+		hosts = strings.Join(hostPatterns, ",")
+	}
+	return fmt.Sprintf("@cert-authority %s %s", hosts, TrustedUserCAKeysLine(caPub))
+}
+
+// TrustedUserCAKeysLine returns a line for sshd's TrustedUserCAKeys
+// file, trusting user certificates signed by the CA.
+func TrustedUserCAKeysLine(caPub ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(caPub)))
+}
@@ -0,0 +1,135 @@
+package sshca
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestCA(t *testing.T, opts ...cert.CertOption) (*CA, []byte) {
+	caPEM, caPrivKeyPEM, err := cert.NewCA(append([]cert.CertOption{cert.WithCommonName("ca")}, opts...)...)
+	require.NoError(t, err)
+	ca, err := New(bytes.NewReader(caPrivKeyPEM), bytes.NewReader(caPEM))
+	require.NoError(t, err)
+	return ca, caPEM
+}
+
+func newTestKey(t *testing.T) ssh.PublicKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	pub, err := ssh.NewPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	return pub
+}
+
+func TestSignUserCert(t *testing.T) {
+	for name, opt := range map[string]cert.CertOption{
+		"ecdsa": cert.WithNewECDSAKey(),
+		"rsa":   cert.WithNewRSAKey(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ca, caPEM := newTestCA(t, opt)
+
+			c, err := ca.SignUserCert(newTestKey(t),
+				WithKeyID("alice@example"),
+				WithPrincipals("alice"),
+				IsValidFor(time.Hour),
+				WithForceCommand("uptime"),
+				WithSourceAddress("10.0.0.0/8", "127.0.0.1/32"),
+				WithExtension("login@example.com", "alice"),
+			)
+			require.NoError(t, err)
+			require.Equal(t, uint32(ssh.UserCert), c.CertType)
+			require.NotZero(t, c.Serial)
+			require.Equal(t, "uptime", c.CriticalOptions["force-command"])
+			require.Equal(t, "10.0.0.0/8,127.0.0.1/32", c.CriticalOptions["source-address"])
+			require.Contains(t, c.Extensions, "permit-pty")
+			require.Equal(t, "alice", c.Extensions["login@example.com"])
+
+			caPub, err := PublicKeyFromCert(caPEM)
+			require.NoError(t, err)
+			require.Equal(t, ca.PublicKey().Marshal(), caPub.Marshal())
+
+			checker := &ssh.CertChecker{
+				IsUserAuthority: func(auth ssh.PublicKey) bool {
+					return bytes.Equal(auth.Marshal(), caPub.Marshal())
+				},
+				SupportedCriticalOptions: []string{"force-command", "source-address"},
+			}
+			require.NoError(t, checker.CheckCert("alice", c))
+			require.Error(t, checker.CheckCert("bob", c))
+
+			parsed, _, _, _, err := ssh.ParseAuthorizedKey(MarshalCertificate(c))
+			require.NoError(t, err)
+			require.Equal(t, c.Marshal(), parsed.Marshal())
+
+			trusted, _, _, _, err := ssh.ParseAuthorizedKey([]byte(TrustedUserCAKeysLine(caPub)))
+			require.NoError(t, err)
+			require.Equal(t, caPub.Marshal(), trusted.Marshal())
+		})
+	}
+}
+
+func TestSignHostCert(t *testing.T) {
+	ca, _ := newTestCA(t)
+
+	hostKey := newTestKey(t)
+	c, err := ca.SignHostCert(hostKey, WithPrincipals("web.internal"))
+	require.NoError(t, err)
+	require.Equal(t, uint32(ssh.HostCert), c.CertType)
+	require.Empty(t, c.Extensions)
+	require.WithinDuration(t, time.Now().Add(DefaultLifetime), time.Unix(int64(c.ValidBefore), 0), time.Minute)
+
+	checker := &ssh.CertChecker{
+		IsHostAuthority: func(auth ssh.PublicKey, address string) bool {
+			return bytes.Equal(auth.Marshal(), ca.PublicKey().Marshal())
+		},
+	}
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}
+	require.NoError(t, checker.CheckHostKey("web.internal:22", addr, c))
+	require.Error(t, checker.CheckHostKey("db.internal:22", addr, c))
+
+	marker, hosts, pub, _, _, err := ssh.ParseKnownHosts([]byte(KnownHostsLine(ca.PublicKey(), "*.internal")))
+	require.NoError(t, err)
+	require.Equal(t, "cert-authority", marker)
+	require.Equal(t, []string{"*.internal"}, hosts)
+	require.Equal(t, ca.PublicKey().Marshal(), pub.Marshal())
+
+	_, err = ca.SignHostCert(hostKey, WithPrincipals("web.internal"), WithExtension("permit-pty", ""))
+	require.Error(t, err)
+	_, err = ca.SignHostCert(hostKey, WithPrincipals("web.internal"), WithForceCommand("true"))
+	require.Error(t, err)
+}
+
+func TestSignErrors(t *testing.T) {
+	ca, caPEM := newTestCA(t)
+
+	_, err := ca.SignUserCert(newTestKey(t))
+	require.Error(t, err)
+
+	_, err = ca.SignUserCert(newTestKey(t), WithPrincipals("alice"), IsValidFor(-time.Hour))
+	require.Error(t, err)
+
+	now := time.Now()
+	_, err = ca.SignUserCert(newTestKey(t), WithPrincipals("alice"), IsValidBetween(now, now.Add(-time.Hour)))
+	require.Error(t, err)
+
+	c, err := ca.SignUserCert(newTestKey(t), WithPrincipals("alice"), WithExtensions(map[string]string{"permit-pty": ""}))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"permit-pty": ""}, c.Extensions)
+
+	_, otherPrivKeyPEM, err := cert.NewCA(cert.WithCommonName("other"))
+	require.NoError(t, err)
+	_, err = New(bytes.NewReader(otherPrivKeyPEM), bytes.NewReader(caPEM))
+	var mismatchErr *cert.KeyMismatchError
+	require.True(t, errors.As(err, &mismatchErr), err)
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStore is a Store kept in a JSON-lines file. Every change appends
+// the updated record to the file, and the last line for a serial number
+// wins when the file is opened.
+type FileStore struct {
+	mu      sync.Mutex
+	file    *os.File
+	records map[string]*Record
+	order   []string
+}
+
+// Open opens the FileStore at the given path, creating it if needed.
+func Open(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{
+		file:    file,
+		records: map[string]*Record{},
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var r Record
+		err := json.Unmarshal(scanner.Bytes(), &r)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if _, ok := s.records[r.Serial]; !ok {
+			s.order = append(s.order, r.Serial)
+		}
+		s.records[r.Serial] = &r
+	}
+	err = scanner.Err()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close closes the underlying file.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// write appends the record to the file. It must be called with s.mu held.
+func (s *FileStore) write(r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.file.Write(append(b, '\n'))
+	if err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func copyRecord(r *Record) *Record {
+	c := *r
+	return &c
+}
+
+// Put implements the Store interface.
+func (s *FileStore) Put(r *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.records[r.Serial]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateSerial, r.Serial)
+	}
+
+	err := s.write(r)
+	if err != nil {
+		return err
+	}
+	s.records[r.Serial] = copyRecord(r)
+	s.order = append(s.order, r.Serial)
+	return nil
+}
+
+// Get implements the Store interface.
+func (s *FileStore) Get(serial string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[strings.ToLower(serial)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, serial)
+	}
+	return copyRecord(r), nil
+}
+
+// List implements the Store interface.
+func (s *FileStore) List(q Query) ([]*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []*Record
+	for _, serial := range s.order {
+		r := s.records[serial]
+		if q.Match(r) {
+			records = append(records, copyRecord(r))
+		}
+	}
+	return records, nil
+}
+
+// Revoke implements the Store interface.
+func (s *FileStore) Revoke(serial, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[strings.ToLower(serial)]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, serial)
+	}
+	if r.Status == StatusRevoked {
+		return fmt.Errorf("%w: %s", ErrAlreadyRevoked, serial)
+	}
+
+	revoked := copyRecord(r)
+	now := time.Now().UTC()
+	revoked.Status = StatusRevoked
+	revoked.RevokedAt = &now
+	revoked.RevocationReason = reason
+
+	err := s.write(revoked)
+	if err != nil {
+		return err
+	}
+	s.records[revoked.Serial] = revoked
+	return nil
+}
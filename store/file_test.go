@@ -0,0 +1,96 @@
+package store
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "issued.jsonl")
+
+	db, err := Open(path)
+	require.NoError(t, err)
+
+	caPEM, caPrivKeyPEM, err := cert.NewCA(cert.WithCommonName("ca"))
+	require.NoError(t, err)
+
+	issue := func(name, requester string) *x509.Certificate {
+		certPEM, _, err := cert.NewServerFromCA(
+			bytes.NewReader(caPrivKeyPEM),
+			bytes.NewReader(caPEM),
+			cert.WithCommonName(name),
+			cert.WithDNSNames(name+".internal"),
+			cert.WithRecorder(Recorder(db)),
+			cert.WithRequester(requester),
+		)
+		require.NoError(t, err)
+		block, _ := pem.Decode(certPEM)
+		c, err := x509.ParseCertificate(block.Bytes)
+		require.NoError(t, err)
+		return c
+	}
+
+	web := issue("web", "alice")
+	db1 := issue("db", "bob")
+	issue("web", "bob")
+
+	records, err := db.List(Query{Name: "WEB.internal"})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, FormatSerial(web), records[0].Serial)
+	require.Equal(t, "alice", records[0].Requester)
+	require.Equal(t, "CN=ca", records[0].Issuer)
+
+	records, err = db.List(Query{Requester: "bob", IssuedAfter: time.Now().Add(-time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	records, err = db.List(Query{IssuedBefore: time.Now().Add(-time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, records, 0)
+
+	require.NoError(t, db.Revoke(FormatSerial(db1), "key compromise"))
+	require.True(t, errors.Is(db.Revoke(FormatSerial(db1), ""), ErrAlreadyRevoked))
+	require.True(t, errors.Is(db.Revoke("00", ""), ErrNotFound))
+
+	err = db.Put(NewRecord(web, "mallory"))
+	require.True(t, errors.Is(err, ErrDuplicateSerial))
+
+	require.NoError(t, db.Close())
+
+	// reopening the file restores every record and its latest status
+	db, err = Open(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	records, err = db.List(Query{})
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+
+	r, err := db.Get(FormatSerial(db1))
+	require.NoError(t, err)
+	require.Equal(t, StatusRevoked, r.Status)
+	require.Equal(t, "key compromise", r.RevocationReason)
+	require.NotNil(t, r.RevokedAt)
+
+	records, err = db.List(Query{Status: StatusValid})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+}
+
+func TestRecordStatusAt(t *testing.T) {
+	r := &Record{Status: StatusValid, NotAfter: time.Now()}
+	require.Equal(t, StatusValid, r.StatusAt(time.Now().Add(-time.Minute)))
+	require.Equal(t, StatusExpired, r.StatusAt(time.Now().Add(time.Minute)))
+
+	r.Status = StatusRevoked
+	require.Equal(t, StatusRevoked, r.StatusAt(time.Now().Add(time.Minute)))
+}
@@ -0,0 +1,180 @@
+// Package store records certificates issued by the cert package, so they
+// can be listed, searched and revoked later.
+package store
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+)
+
+// Status is the status of an issued cert.
+type Status string
+
+const (
+	StatusValid   Status = "valid"
+	StatusRevoked Status = "revoked"
+	StatusExpired Status = "expired"
+)
+
+var (
+	// ErrNotFound is returned when no record exists for a serial number.
+	ErrNotFound = errors.New("certificate not found")
+	// ErrDuplicateSerial is returned when a serial number was already
+	// issued.
+	ErrDuplicateSerial = errors.New("serial number already issued")
+	// ErrAlreadyRevoked is returned when revoking a revoked cert.
+	ErrAlreadyRevoked = errors.New("certificate already revoked")
+)
+
+// Record describes an issued cert.
+type Record struct {
+	Serial           string     `json:"serial"`
+	Subject          string     `json:"subject"`
+	CommonName       string     `json:"common_name,omitempty"`
+	DNSNames         []string   `json:"dns_names,omitempty"`
+	IPAddresses      []string   `json:"ip_addresses,omitempty"`
+	URIs             []string   `json:"uris,omitempty"`
+	EmailAddresses   []string   `json:"email_addresses,omitempty"`
+	NotBefore        time.Time  `json:"not_before"`
+	NotAfter         time.Time  `json:"not_after"`
+	Issuer           string     `json:"issuer"`
+	Requester        string     `json:"requester,omitempty"`
+	Status           Status     `json:"status"`
+	IssuedAt         time.Time  `json:"issued_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	RevocationReason string     `json:"revocation_reason,omitempty"`
+	Certificate      string     `json:"certificate"`
+}
+
+// FormatSerial formats a serial number the way records store it.
+func FormatSerial(c *x509.Certificate) string {
+	return fmt.Sprintf("%x", c.SerialNumber)
+}
+
+// NewRecord creates a valid Record for the given cert.
+func NewRecord(c *x509.Certificate, requester string) *Record {
+	r := &Record{
+		Serial:         FormatSerial(c),
+		Subject:        c.Subject.String(),
+		CommonName:     c.Subject.CommonName,
+		DNSNames:       c.DNSNames,
+		EmailAddresses: c.EmailAddresses,
+		NotBefore:      c.NotBefore,
+		NotAfter:       c.NotAfter,
+		Issuer:         c.Issuer.String(),
+		Requester:      requester,
+		Status:         StatusValid,
+		IssuedAt:       time.Now().UTC(),
+		Certificate:    string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})),
+	}
+	for _, ip := range c.IPAddresses {
+		r.IPAddresses = append(r.IPAddresses, ip.String())
+	}
+	for _, uri := range c.URIs {
+		r.URIs = append(r.URIs, uri.String())
+	}
+	return r
+}
+
+// StatusAt returns the status of the cert at the given time, which is
+// StatusExpired for valid certs past their NotAfter time.
+func (r *Record) StatusAt(t time.Time) Status {
+	if r.Status == StatusValid && t.After(r.NotAfter) {
+		return StatusExpired
+	}
+	return r.Status
+}
+
+// Names returns the subject common name and all SANs of the cert.
+func (r *Record) Names() []string {
+	var names []string
+	if r.CommonName != "" {
+		names = append(names, r.CommonName)
+	}
+	names = append(names, r.DNSNames...)
+	names = append(names, r.IPAddresses...)
+	names = append(names, r.URIs...)
+	names = append(names, r.EmailAddresses...)
+	return names
+}
+
+// Query selects records. Zero fields match every record.
+type Query struct {
+	// Name matches the subject common name or any SAN, ignoring case.
+	Name string
+	// Requester matches who requested the cert.
+	Requester string
+	// Issuer matches the issuer distinguished name.
+	Issuer string
+	// Status matches the status of the cert at the time of the query.
+	Status Status
+	// IssuedAfter and IssuedBefore select when the cert was issued.
+	IssuedAfter  time.Time
+	IssuedBefore time.Time
+}
+
+// Match reports whether the record is selected by the query.
+func (q *Query) Match(r *Record) bool {
+	if q.Name != "" {
+		found := false
+		for _, name := range r.Names() {
+			if strings.EqualFold(name, q.Name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Requester != "" && q.Requester != r.Requester {
+		return false
+	}
+	if q.Issuer != "" && q.Issuer != r.Issuer {
+		return false
+	}
+	if q.Status != "" && q.Status != r.StatusAt(time.Now()) {
+		return false
+	}
+	if !q.IssuedAfter.IsZero() && r.IssuedAt.Before(q.IssuedAfter) {
+		return false
+	}
+	if !q.IssuedBefore.IsZero() && !r.IssuedAt.Before(q.IssuedBefore) {
+		return false
+	}
+	return true
+}
+
+// Store records issued certs.
+type Store interface {
+	// Put adds a record, failing with ErrDuplicateSerial if its serial
+	// number was already issued.
+	Put(r *Record) error
+	// Get returns the record for a serial number, or ErrNotFound.
+	Get(serial string) (*Record, error)
+	// List returns the records selected by the query, in the order they
+	// were issued.
+	List(q Query) ([]*Record, error)
+	// Revoke marks the cert with the given serial number as revoked.
+	Revoke(serial, reason string) error
+}
+
+type recorder struct {
+	store Store
+}
+
+func (r recorder) RecordCertificate(c *x509.Certificate, requester string) error {
+	return r.store.Put(NewRecord(c, requester))
+}
+
+// Recorder returns a cert.Recorder that puts every issued cert into the
+// given Store.
+func Recorder(s Store) cert.Recorder {
+	return recorder{store: s}
+}
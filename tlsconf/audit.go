@@ -0,0 +1,202 @@
+package tlsconf
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// Severity ranks how risky a Finding is.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityHigh
+	SeverityCritical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityHigh:
+		return "high"
+	case SeverityCritical:
+		return "critical"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// Finding is a risky setting reported by Audit.
+type Finding struct {
+	Severity Severity
+	Setting  string
+	Message  string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("[%s] %s: %s", f.Severity, f.Setting, f.Message)
+}
+
+// DefaultExpiryWindow is how close to expiry a certificate can be
+// before Audit reports it.
+const DefaultExpiryWindow = 30 * 24 * time.Hour
+
+type auditOptions struct {
+	role         string
+	expiryWindow time.Duration
+	now          func() time.Time
+}
+
+// AuditOption customizes the checks done by Audit.
+type AuditOption func(*auditOptions)
+
+// AsServer audits the config as a server config, regardless of
+// whether it looks like one.
+func AsServer() AuditOption {
+	return func(o *auditOptions) {
+		o.role = "server"
+	}
+}
+
+// AsClient audits the config as a client config, regardless of
+// whether it looks like one.
+func AsClient() AuditOption {
+	return func(o *auditOptions) {
+		o.role = "client"
+	}
+}
+
+// WithExpiryWindow sets how close to expiry a certificate can be
+// before it is reported.
+func WithExpiryWindow(d time.Duration) AuditOption {
+	return func(o *auditOptions) {
+		o.expiryWindow = d
+	}
+}
+
+// Audit reports risky settings in the given tls.Config, ordered as
+// they were checked. Unless AsServer or AsClient is given, a config
+// is treated as a server config when it has ClientCAs, a ClientAuth
+// mode or a GetConfigForClient hook set.
+func Audit(config *tls.Config, opts ...AuditOption) []Finding {
+	o := &auditOptions{
+		expiryWindow: DefaultExpiryWindow,
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.role == "" {
+		o.role = "client"
+		if config.ClientCAs != nil || config.ClientAuth != tls.NoClientCert || config.GetConfigForClient != nil {
+			o.role = "server"
+		}
+	}
+
+	var findings []Finding
+	add := func(severity Severity, setting, format string, args ...interface{}) {
+		findings = append(findings, Finding{
+			Severity: severity,
+			Setting:  setting,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	switch {
+	case config.MinVersion == 0:
+		add(SeverityWarning, "MinVersion", "not set, the crypto/tls default applies")
+	case config.MinVersion < tls.VersionTLS12:
+		add(SeverityHigh, "MinVersion", "allows %s, which is older than TLS 1.2", versionName(config.MinVersion))
+	}
+
+	insecure := map[uint16]bool{}
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.ID] = true
+	}
+	for _, id := range config.CipherSuites {
+		switch {
+		case insecure[id]:
+			add(SeverityCritical, "CipherSuites", "includes insecure cipher suite %s", tls.CipherSuiteName(id))
+		case isWeakCipherSuite(id):
+			add(SeverityWarning, "CipherSuites", "includes legacy cipher suite %s", tls.CipherSuiteName(id))
+		}
+	}
+
+	if config.InsecureSkipVerify && config.VerifyPeerCertificate == nil && config.VerifyConnection == nil {
+		add(SeverityCritical, "InsecureSkipVerify", "certificate verification is disabled without a VerifyPeerCertificate replacement")
+	}
+
+	if o.role == "server" {
+		if config.ClientAuth < tls.RequireAndVerifyClientCert {
+			add(SeverityHigh, "ClientAuth", "%s is weaker than RequireAndVerifyClientCert", config.ClientAuth)
+		}
+		if config.ClientAuth >= tls.VerifyClientCertIfGiven && config.ClientCAs == nil {
+			add(SeverityHigh, "ClientCAs", "not set, client certificates are verified against the system roots")
+		}
+	}
+
+	now := o.now()
+	for i, c := range config.Certificates {
+		leaf := c.Leaf
+		if leaf == nil {
+			if len(c.Certificate) == 0 {
+				continue
+			}
+			parsed, err := x509.ParseCertificate(c.Certificate[0])
+			if err != nil {
+				add(SeverityHigh, "Certificates", "certificate %d could not be parsed: %v", i, err)
+				continue
+			}
+			leaf = parsed
+		}
+		findings = append(findings, auditCertificate(leaf, fmt.Sprintf("Certificates[%d]", i), now, o.expiryWindow)...)
+	}
+
+	return findings
+}
+
+func auditCertificate(c *x509.Certificate, setting string, now time.Time, expiryWindow time.Duration) []Finding {
+	var findings []Finding
+	add := func(severity Severity, format string, args ...interface{}) {
+		findings = append(findings, Finding{
+			Severity: severity,
+			Setting:  setting,
+			Message:  fmt.Sprintf("%q: ", c.Subject.CommonName) + fmt.Sprintf(format, args...),
+		})
+	}
+
+	switch {
+	case now.After(c.NotAfter):
+		add(SeverityCritical, "expired at %s", c.NotAfter.Format(time.RFC3339))
+	case now.Before(c.NotBefore):
+		add(SeverityHigh, "not valid until %s", c.NotBefore.Format(time.RFC3339))
+	case c.NotAfter.Sub(now) < expiryWindow:
+		add(SeverityWarning, "expires soon at %s", c.NotAfter.Format(time.RFC3339))
+	}
+
+	switch k := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			add(SeverityHigh, "weak %d bit RSA key", k.N.BitLen())
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve.Params().BitSize < 256 {
+			add(SeverityHigh, "weak %d bit ECDSA key", k.Curve.Params().BitSize)
+		}
+	}
+
+	switch c.SignatureAlgorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		add(SeverityHigh, "weak signature algorithm %s", c.SignatureAlgorithm)
+	}
+
+	return findings
+}
@@ -0,0 +1,86 @@
+package tlsconf
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/stretchr/testify/require"
+)
+
+func hasFinding(findings []Finding, severity Severity, setting string) bool {
+	for _, f := range findings {
+		if f.Severity == severity && f.Setting == setting {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAuditInsecureClient(t *testing.T) {
+	config, err := Build(
+		WithInsecureVerfication(),
+		WithCipherSuites([]uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+		}),
+	)
+	require.NoError(t, err)
+
+	findings := Audit(config)
+	require.Len(t, findings, 4)
+	require.True(t, hasFinding(findings, SeverityWarning, "MinVersion"))
+	require.True(t, hasFinding(findings, SeverityCritical, "CipherSuites"))
+	require.True(t, hasFinding(findings, SeverityWarning, "CipherSuites"))
+	require.True(t, hasFinding(findings, SeverityCritical, "InsecureSkipVerify"))
+
+	config.VerifyPeerCertificate = VerifyPeerCertificateInsecureAny
+	require.False(t, hasFinding(Audit(config), SeverityCritical, "InsecureSkipVerify"))
+}
+
+func TestAuditServerClientAuth(t *testing.T) {
+	config, err := Build(WithProfile(IntermediateProfile))
+	require.NoError(t, err)
+
+	require.Empty(t, Audit(config))
+
+	findings := Audit(config, AsServer())
+	require.True(t, hasFinding(findings, SeverityHigh, "ClientAuth"))
+
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	findings = Audit(config)
+	require.Len(t, findings, 1)
+	require.True(t, hasFinding(findings, SeverityHigh, "ClientCAs"))
+}
+
+func TestAuditCertificates(t *testing.T) {
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	certPEM, keyPEM, err := cert.NewCA(
+		cert.WithCommonName("expiring"),
+		cert.WithKey(weakKey),
+		cert.IsValidFor(24*time.Hour),
+	)
+	require.NoError(t, err)
+
+	keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+
+	config, err := Build(
+		WithProfile(ModernProfile),
+		WithCertificates([]tls.Certificate{keyPair}),
+	)
+	require.NoError(t, err)
+
+	findings := Audit(config)
+	require.Len(t, findings, 2)
+	require.Contains(t, findings[0].Message, "expires soon")
+	require.Contains(t, findings[1].Message, "weak 1024 bit RSA key")
+
+	require.Len(t, Audit(config, WithExpiryWindow(time.Hour)), 1)
+}
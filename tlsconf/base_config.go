@@ -0,0 +1,132 @@
+package tlsconf
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"reflect"
+)
+
+// WithBaseConfig replaces the config being built with a clone of the
+// given base config. Options applied before it are discarded, and
+// options applied after it are layered over the base. The base config
+// is never modified by later options.
+func WithBaseConfig(baseConfig *tls.Config) TLSConfigOption {
+	return func(config *tls.Config) error {
+		if baseConfig == nil {
+			return fmt.Errorf("base config is nil")
+		}
+		copyConfig(config, baseConfig.Clone())
+		config.Certificates = append([]tls.Certificate(nil), baseConfig.Certificates...)
+		if baseConfig.RootCAs != nil {
+			config.RootCAs = baseConfig.RootCAs.Clone()
+		}
+		if baseConfig.ClientCAs != nil {
+			config.ClientCAs = baseConfig.ClientCAs.Clone()
+		}
+		return nil
+	}
+}
+
+// WithMergedBaseConfig is like WithBaseConfig, except the certificate
+// lists and CA pools configured by earlier options are combined with
+// the base config's instead of being replaced. The base config's
+// certificates come first, followed by the earlier ones.
+//
+// An x509.CertPool can't be enumerated, so Build applies the earlier
+// options again over clones of the base config's CA pools to merge
+// them. The earlier options must not replace those pools with ones
+// built elsewhere, and WithMergedBaseConfig only works within Build.
+func WithMergedBaseConfig(baseConfig *tls.Config) TLSConfigOption {
+	return func(config *tls.Config) error {
+		if baseConfig == nil {
+			return fmt.Errorf("base config is nil")
+		}
+		return &mergeBaseConfig{base: baseConfig}
+	}
+}
+
+// mergeBaseConfig is returned by WithMergedBaseConfig for Build to
+// merge the base config with the options applied before it.
+type mergeBaseConfig struct {
+	base *tls.Config
+}
+
+func (m *mergeBaseConfig) Error() string {
+	return "WithMergedBaseConfig must be applied by Build"
+}
+
+// merge merges the base config into the config built by the earlier
+// options.
+func (m *mergeBaseConfig) merge(config *tls.Config, earlier []TLSConfigOption) error {
+	var baseRootCAs, baseClientCAs *x509.CertPool
+	if m.base.RootCAs != nil {
+		baseRootCAs = m.base.RootCAs.Clone()
+	}
+	if m.base.ClientCAs != nil {
+		baseClientCAs = m.base.ClientCAs.Clone()
+	}
+
+	cas := &tls.Config{RootCAs: baseRootCAs, ClientCAs: baseClientCAs}
+	err := apply(cas, earlier)
+	if err != nil {
+		return err
+	}
+	rootCAs, err := mergedPool(baseRootCAs, cas.RootCAs)
+	if err != nil {
+		return fmt.Errorf("failed to merge root CAs: %w", err)
+	}
+	clientCAs, err := mergedPool(baseClientCAs, cas.ClientCAs)
+	if err != nil {
+		return fmt.Errorf("failed to merge client CAs: %w", err)
+	}
+
+	var certs []tls.Certificate
+	certs = append(certs, m.base.Certificates...)
+	certs = append(certs, config.Certificates...)
+
+	copyConfig(config, m.base.Clone())
+	config.Certificates = certs
+	config.RootCAs = rootCAs
+	config.ClientCAs = clientCAs
+	return nil
+}
+
+// mergedPool returns the pool left by applying the earlier options over
+// a clone of the base pool, which is nil if there are no base CAs.
+func mergedPool(base, pool *x509.CertPool) (*x509.CertPool, error) {
+	switch {
+	case base == nil || pool == base:
+		return pool, nil
+	case pool == nil:
+		return base, nil
+	default:
+		return nil, fmt.Errorf("CA pool was replaced by an earlier option")
+	}
+}
+
+// copyConfig copies every exported field of src into dst. A tls.Config
+// can't be copied by value, since it contains a mutex.
+func copyConfig(dst, src *tls.Config) {
+	dv := reflect.ValueOf(dst).Elem()
+	sv := reflect.ValueOf(src).Elem()
+	for i := 0; i < dv.NumField(); i++ {
+		if dv.Type().Field(i).PkgPath != "" {
+			continue
+		}
+		dv.Field(i).Set(sv.Field(i))
+	}
+}
+
+// appendCAsFromPEM is like x509.CertPool.AppendCertsFromPEM for the
+// config's client or root CA pool, creating the pool if needed.
+func appendCAsFromPEM(config *tls.Config, clientCAs bool, pemCerts []byte) bool {
+	pool := &config.RootCAs
+	if clientCAs {
+		pool = &config.ClientCAs
+	}
+	if *pool == nil {
+		*pool = x509.NewCertPool()
+	}
+	return (*pool).AppendCertsFromPEM(pemCerts)
+}
@@ -0,0 +1,176 @@
+package tlsconf
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKeyPair(t *testing.T, commonName string) (tls.Certificate, []byte) {
+	certPEM, keyPEM, err := cert.NewCA(cert.WithCommonName(commonName))
+	require.NoError(t, err)
+
+	keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+
+	keyPair.Leaf, err = x509.ParseCertificate(keyPair.Certificate[0])
+	require.NoError(t, err)
+
+	return keyPair, certPEM
+}
+
+func commonNames(certs []tls.Certificate) []string {
+	var names []string
+	for _, c := range certs {
+		names = append(names, c.Leaf.Subject.CommonName)
+	}
+	return names
+}
+
+// verifies checks if the given pool can verify the given certificate.
+func verifies(pool *x509.CertPool, c tls.Certificate) bool {
+	_, err := c.Leaf.Verify(x509.VerifyOptions{Roots: pool})
+	return err == nil
+}
+
+func TestWithBaseConfig(t *testing.T) {
+	base, err := Build(
+		WithProfile(FIPSProfile),
+		WithServerName("base"),
+	)
+	require.NoError(t, err)
+
+	config, err := Build(
+		WithServerName("before"),
+		WithBaseConfig(base),
+		WithMinVersion(tls.VersionTLS13),
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, "base", config.ServerName)
+	require.Equal(t, uint16(tls.VersionTLS13), config.MinVersion)
+	require.Equal(t, FIPSProfile.CipherSuites, config.CipherSuites)
+	require.Equal(t, uint16(tls.VersionTLS12), base.MinVersion)
+}
+
+func TestWithBaseConfigDoesNotModifyBase(t *testing.T) {
+	baseKeyPair, baseCAPEM := newTestKeyPair(t, "base")
+	otherKeyPair, otherCAPEM := newTestKeyPair(t, "other")
+
+	base, err := Build(
+		WithCertificates([]tls.Certificate{baseKeyPair}),
+		WithCACertificates(bytes.NewReader(baseCAPEM)),
+	)
+	require.NoError(t, err)
+
+	config, err := Build(
+		WithBaseConfig(base),
+		WithCertificates([]tls.Certificate{otherKeyPair}),
+		WithCACertificates(bytes.NewReader(otherCAPEM)),
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"base", "other"}, commonNames(config.Certificates))
+	require.True(t, verifies(config.ClientCAs, otherKeyPair))
+
+	require.Equal(t, []string{"base"}, commonNames(base.Certificates))
+	require.False(t, verifies(base.ClientCAs, otherKeyPair))
+}
+
+func TestWithBaseConfigReplacesEarlierOptions(t *testing.T) {
+	baseKeyPair, baseCAPEM := newTestKeyPair(t, "base")
+	earlyKeyPair, earlyCAPEM := newTestKeyPair(t, "early")
+
+	base, err := Build(
+		WithCertificates([]tls.Certificate{baseKeyPair}),
+		WithCACertificates(bytes.NewReader(baseCAPEM)),
+	)
+	require.NoError(t, err)
+
+	config, err := Build(
+		WithCertificates([]tls.Certificate{earlyKeyPair}),
+		WithCACertificates(bytes.NewReader(earlyCAPEM)),
+		WithBaseConfig(base),
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"base"}, commonNames(config.Certificates))
+	require.True(t, verifies(config.ClientCAs, baseKeyPair))
+	require.False(t, verifies(config.ClientCAs, earlyKeyPair))
+}
+
+func TestWithMergedBaseConfig(t *testing.T) {
+	baseKeyPair, baseCAPEM := newTestKeyPair(t, "base")
+	earlyKeyPair, earlyCAPEM := newTestKeyPair(t, "early")
+	lateKeyPair, lateCAPEM := newTestKeyPair(t, "late")
+
+	base, err := Build(
+		WithCertificates([]tls.Certificate{baseKeyPair}),
+		WithCACertificates(bytes.NewReader(baseCAPEM)),
+		WithServerName("base"),
+	)
+	require.NoError(t, err)
+
+	config, err := Build(
+		WithServerName("early"),
+		WithCertificates([]tls.Certificate{earlyKeyPair}),
+		WithCACertificates(bytes.NewReader(earlyCAPEM)),
+		WithMergedBaseConfig(base),
+		WithCertificates([]tls.Certificate{lateKeyPair}),
+		WithCACertificates(bytes.NewReader(lateCAPEM)),
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, "base", config.ServerName)
+	require.Equal(t, []string{"base", "early", "late"}, commonNames(config.Certificates))
+	for _, keyPair := range []tls.Certificate{baseKeyPair, earlyKeyPair, lateKeyPair} {
+		require.True(t, verifies(config.ClientCAs, keyPair))
+	}
+
+	require.Equal(t, []string{"base"}, commonNames(base.Certificates))
+	require.False(t, verifies(base.ClientCAs, earlyKeyPair))
+	require.False(t, verifies(base.ClientCAs, lateKeyPair))
+}
+
+func TestWithMergedBaseConfigForeignPools(t *testing.T) {
+	aKeyPair, aPEM := newTestKeyPair(t, "a")
+	bKeyPair, bPEM := newTestKeyPair(t, "b")
+
+	a := x509.NewCertPool()
+	a.AppendCertsFromPEM(aPEM)
+	b := x509.NewCertPool()
+	b.AppendCertsFromPEM(bPEM)
+
+	// a base pool built elsewhere can be merged
+	config, err := Build(
+		WithCACertificates(bytes.NewReader(bPEM)),
+		WithMergedBaseConfig(&tls.Config{ClientCAs: a}),
+	)
+	require.NoError(t, err)
+	require.True(t, verifies(config.ClientCAs, aKeyPair))
+	require.True(t, verifies(config.ClientCAs, bKeyPair))
+
+	// an earlier pool built elsewhere can't be merged
+	_, err = Build(
+		WithBaseConfig(&tls.Config{RootCAs: a}),
+		WithMergedBaseConfig(&tls.Config{RootCAs: b}),
+	)
+	require.Error(t, err)
+}
+
+func TestWithBaseConfigNil(t *testing.T) {
+	_, err := Build(WithBaseConfig(nil))
+	require.Error(t, err)
+
+	_, err = Build(WithMergedBaseConfig(nil))
+	require.Error(t, err)
+}
+
+func TestWithMergedBaseConfigOutsideBuild(t *testing.T) {
+	err := WithMergedBaseConfig(&tls.Config{})(&tls.Config{})
+	require.Error(t, err)
+}
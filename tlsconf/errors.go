@@ -0,0 +1,99 @@
+package tlsconf
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// MissingFileError is returned when a certificate, key or CA file
+// can't be read.
+type MissingFileError struct {
+	Path string
+	Err  error
+}
+
+func (e *MissingFileError) Error() string {
+	return fmt.Sprintf("missing file %q: %v", e.Path, e.Err)
+}
+
+func (e *MissingFileError) Unwrap() error {
+	return e.Err
+}
+
+// BadPEMError is returned when a file doesn't contain the expected
+// PEM encoded certificates or private key.
+type BadPEMError struct {
+	Path   string
+	Reason string
+}
+
+func (e *BadPEMError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("bad PEM: %s", e.Reason)
+	}
+	return fmt.Sprintf("bad PEM in %q: %s", e.Path, e.Reason)
+}
+
+// KeyMismatchError is returned when a private key doesn't match the
+// public key of its certificate. It wraps a *cert.KeyMismatchError.
+type KeyMismatchError struct {
+	CertFile string
+	KeyFile  string
+	Err      error
+}
+
+func (e *KeyMismatchError) Error() string {
+	return fmt.Sprintf("private key %q does not match certificate %q", e.KeyFile, e.CertFile)
+}
+
+func (e *KeyMismatchError) Unwrap() error {
+	return e.Err
+}
+
+// ExpiredCertError is returned when a certificate is outside of its
+// validity window at Time.
+type ExpiredCertError struct {
+	Path      string
+	Subject   string
+	NotBefore time.Time
+	NotAfter  time.Time
+	Time      time.Time
+}
+
+func (e *ExpiredCertError) Error() string {
+	if e.Time.Before(e.NotBefore) {
+		return fmt.Sprintf("certificate %q in %q is not valid until %s", e.Subject, e.Path, e.NotBefore.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("certificate %q in %q expired at %s", e.Subject, e.Path, e.NotAfter.Format(time.RFC3339))
+}
+
+// WrongUsageError is returned when a certificate's extended key usage
+// doesn't allow it to be used for its role.
+type WrongUsageError struct {
+	Path        string
+	Subject     string
+	Role        Role
+	ExtKeyUsage []x509.ExtKeyUsage
+}
+
+func (e *WrongUsageError) Error() string {
+	return fmt.Sprintf("certificate %q in %q can't be used as a %s certificate", e.Subject, e.Path, e.Role)
+}
+
+// UntrustedCertError is returned when a certificate doesn't chain to
+// the configured CA.
+type UntrustedCertError struct {
+	Path    string
+	Subject string
+	CAFile  string
+	Err     error
+}
+
+func (e *UntrustedCertError) Error() string {
+	return fmt.Sprintf("certificate %q in %q is not signed by a CA in %q: %v", e.Subject, e.Path, e.CAFile, e.Err)
+}
+
+func (e *UntrustedCertError) Unwrap() error {
+	return e.Err
+}
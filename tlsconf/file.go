@@ -0,0 +1,443 @@
+package tlsconf
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the declarative file format used by FromFile and FromBytes
+// to build a tls.Config. Since JSON is a subset of YAML, files can be
+// written in either format.
+//
+// Relative paths are resolved against the directory of the config file.
+type Config struct {
+	// Profile is the name of a built-in Profile, such as "intermediate".
+	Profile string `yaml:"profile" json:"profile"`
+	// MinVersion overrides the profile's minimum TLS version, such as "1.3".
+	MinVersion string `yaml:"min_version" json:"min_version"`
+	// Certificates are the cert/key pairs presented to peers.
+	Certificates []KeyPairConfig `yaml:"certificates" json:"certificates"`
+	// RootCAFiles are CA bundles used by clients to verify servers.
+	RootCAFiles []string `yaml:"root_ca_files" json:"root_ca_files"`
+	// ClientCAFiles are CA bundles used by servers to verify clients.
+	ClientCAFiles []string `yaml:"client_ca_files" json:"client_ca_files"`
+	// ClientAuth is one of "none", "request", "require-any",
+	// "verify-if-given" or "require-and-verify".
+	ClientAuth string `yaml:"client_auth" json:"client_auth"`
+	// ALPN is the list of supported application protocols.
+	ALPN []string `yaml:"alpn" json:"alpn"`
+	// ServerName is used by clients to verify the server's hostname.
+	ServerName string `yaml:"server_name" json:"server_name"`
+	// Verify contains additional peer verification rules.
+	Verify VerifyConfig `yaml:"verify" json:"verify"`
+	// Pinning contains the SPKI pins the peer must match.
+	Pinning PinningConfig `yaml:"pinning" json:"pinning"`
+}
+
+// KeyPairConfig is a PEM encoded certificate and private key file pair.
+type KeyPairConfig struct {
+	CertFile string `yaml:"cert_file" json:"cert_file"`
+	KeyFile  string `yaml:"key_file" json:"key_file"`
+}
+
+// VerifyConfig contains peer verification rules. When any allowed names
+// are given, the peer's leaf certificate must match at least one of them.
+type VerifyConfig struct {
+	// InsecureSkipVerify disables the hostname check of crypto/tls,
+	// which is only allowed when the peer is checked by other rules.
+	// With allowed names, the chain is still verified against the root
+	// CA files, or the client CA files of servers, before the names are
+	// checked.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify" json:"insecure_skip_verify"`
+	// CommonNames are the allowed peer subject common names.
+	CommonNames []string `yaml:"common_names" json:"common_names"`
+	// DNSNames are the allowed peer DNS subject alternative names.
+	DNSNames []string `yaml:"dns_names" json:"dns_names"`
+}
+
+// PinningConfig contains SPKI pins, as used by WithPinSet. Pinning
+// failures in report only mode are logged.
+type PinningConfig struct {
+	Pins       []string `yaml:"pins" json:"pins"`
+	BackupPins []string `yaml:"backup_pins" json:"backup_pins"`
+	ReportOnly bool     `yaml:"report_only" json:"report_only"`
+}
+
+// FieldError is a validation error for a single field of a Config.
+type FieldError struct {
+	Line    int
+	Column  int
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Field, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// FieldErrors contains every FieldError found validating a Config.
+type FieldErrors []*FieldError
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                   tls.NoClientCert,
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require-any":        tls.RequireAnyClientCert,
+	"verify-if-given":    tls.VerifyClientCertIfGiven,
+	"require-and-verify": tls.RequireAndVerifyClientCert,
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// FromFile builds a tls.Config from the YAML or JSON config file at the
+// given path. Any given options are applied after the file's settings.
+func FromFile(path string, opts ...TLSConfigOption) (*tls.Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseConfig(data, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	config, err := cfg.Build(filepath.Dir(path), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// FromBytes builds a tls.Config from YAML or JSON config file contents.
+// Relative paths are resolved against the current working directory.
+func FromBytes(data []byte, opts ...TLSConfigOption) (*tls.Config, error) {
+	cfg, err := parseConfig(data, ".")
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Build(".", opts...)
+}
+
+// ParseConfig decodes and validates YAML or JSON config file contents.
+// Validation failures are returned as FieldErrors. Referenced files are
+// not checked for existence.
+func ParseConfig(data []byte) (*Config, error) {
+	return parseConfig(data, "")
+}
+
+// parseConfig decodes and validates config file contents, checking that
+// referenced files exist relative to baseDir unless it is empty.
+func parseConfig(data []byte, baseDir string) (*Config, error) {
+	var root yaml.Node
+	err := yaml.Unmarshal(data, &root)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(cfg)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	lines := map[string]*yaml.Node{}
+	collectFieldNodes(&root, "", lines)
+
+	errs := cfg.validate(baseDir)
+	for _, fieldErr := range errs {
+		// fall back to the closest parent for fields missing from the file
+		for field := fieldErr.Field; field != ""; field = parentField(field) {
+			if node, ok := lines[field]; ok {
+				fieldErr.Line = node.Line
+				fieldErr.Column = node.Column
+				break
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return cfg, nil
+}
+
+// collectFieldNodes records the value node of every field, keyed by
+// its path, such as "certificates[0].cert_file".
+func collectFieldNodes(node *yaml.Node, path string, nodes map[string]*yaml.Node) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			collectFieldNodes(child, path, nodes)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if path != "" {
+				key = path + "." + key
+			}
+			nodes[key] = node.Content[i+1]
+			collectFieldNodes(node.Content[i+1], key, nodes)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			key := path + "[" + strconv.Itoa(i) + "]"
+			nodes[key] = child
+			collectFieldNodes(child, key, nodes)
+		}
+	}
+}
+
+// parentField returns the parent path of a field path, such as
+// "certificates[0]" for "certificates[0].cert_file".
+func parentField(field string) string {
+	i := strings.LastIndexAny(field, ".[")
+	if i < 0 {
+		return ""
+	}
+	return field[:i]
+}
+
+func (c *Config) validate(baseDir string) FieldErrors {
+	var errs FieldErrors
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, &FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	checkFile := func(field, path string) {
+		if path == "" {
+			add(field, "is required")
+			return
+		}
+		if baseDir == "" {
+			return
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			add(field, "%v", err)
+		}
+	}
+
+	if c.Profile != "" {
+		if _, err := ProfileByName(c.Profile); err != nil {
+			add("profile", "unknown profile %q", c.Profile)
+		}
+	}
+	if c.MinVersion != "" {
+		if _, ok := tlsVersions[c.MinVersion]; !ok {
+			add("min_version", "unknown TLS version %q", c.MinVersion)
+		}
+	}
+	for i, kp := range c.Certificates {
+		checkFile(fmt.Sprintf("certificates[%d].cert_file", i), kp.CertFile)
+		checkFile(fmt.Sprintf("certificates[%d].key_file", i), kp.KeyFile)
+	}
+	for i, file := range c.RootCAFiles {
+		checkFile(fmt.Sprintf("root_ca_files[%d]", i), file)
+	}
+	for i, file := range c.ClientCAFiles {
+		checkFile(fmt.Sprintf("client_ca_files[%d]", i), file)
+	}
+	if _, ok := clientAuthTypes[c.ClientAuth]; !ok {
+		add("client_auth", "unknown client auth mode %q", c.ClientAuth)
+	}
+	if clientAuthTypes[c.ClientAuth] >= tls.VerifyClientCertIfGiven && len(c.ClientCAFiles) == 0 {
+		add("client_auth", "%q requires client_ca_files", c.ClientAuth)
+	}
+	for i, pin := range c.Pinning.Pins {
+		if _, err := parsePin(pin); err != nil {
+			add(fmt.Sprintf("pinning.pins[%d]", i), "%v", err)
+		}
+	}
+	for i, pin := range c.Pinning.BackupPins {
+		if _, err := parsePin(pin); err != nil {
+			add(fmt.Sprintf("pinning.backup_pins[%d]", i), "%v", err)
+		}
+	}
+	if len(c.Pinning.Pins) == 0 && len(c.Pinning.BackupPins) > 0 {
+		add("pinning.pins", "is required when backup_pins are given")
+	}
+	pinned := len(c.Pinning.Pins) > 0 && !c.Pinning.ReportOnly
+	allowedNames := len(c.Verify.CommonNames) > 0 || len(c.Verify.DNSNames) > 0
+	if c.Verify.InsecureSkipVerify && !allowedNames && !pinned {
+		add("verify.insecure_skip_verify", "requires common_names, dns_names or pinning to verify the peer")
+	}
+	server := clientAuthTypes[c.ClientAuth] != tls.NoClientCert
+	if server && allowedNames && len(c.ClientCAFiles) == 0 && clientAuthTypes[c.ClientAuth] < tls.VerifyClientCertIfGiven {
+		add("client_auth", "requires client_ca_files to verify the chain of common_names or dns_names")
+	}
+	if !server && c.Verify.InsecureSkipVerify && allowedNames && len(c.RootCAFiles) == 0 {
+		add("verify.insecure_skip_verify", "requires root_ca_files to verify the chain of common_names or dns_names")
+	}
+	return errs
+}
+
+// Options converts the Config into the equivalent TLSConfigOptions,
+// resolving relative paths against baseDir.
+func (c *Config) Options(baseDir string) ([]TLSConfigOption, error) {
+	resolve := func(path string) string {
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(baseDir, path)
+	}
+
+	var opts []TLSConfigOption
+
+	if c.Profile != "" {
+		p, err := ProfileByName(c.Profile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithProfile(p))
+	}
+	if c.MinVersion != "" {
+		opts = append(opts, WithMinVersion(tlsVersions[c.MinVersion]))
+	}
+	for _, kp := range c.Certificates {
+		opts = append(opts, WithX509KeyPair(resolve(kp.CertFile), resolve(kp.KeyFile)))
+	}
+	for _, file := range c.RootCAFiles {
+		opts = append(opts, WithRootCAFile(resolve(file)))
+	}
+	for _, file := range c.ClientCAFiles {
+		opts = append(opts, WithCAFile(resolve(file)))
+	}
+	if c.ClientAuth != "" {
+		clientAuth := clientAuthTypes[c.ClientAuth]
+		opts = append(opts, func(config *tls.Config) error {
+			config.ClientAuth = clientAuth
+			return nil
+		})
+	}
+	if len(c.ALPN) > 0 {
+		opts = append(opts, WithNextProtos(c.ALPN...))
+	}
+	if c.ServerName != "" {
+		opts = append(opts, WithServerName(c.ServerName))
+	}
+	if c.Verify.InsecureSkipVerify {
+		opts = append(opts, WithInsecureVerfication())
+	}
+	if len(c.Verify.CommonNames) > 0 || len(c.Verify.DNSNames) > 0 {
+		opts = append(opts, withAllowedNames(c.Verify.CommonNames, c.Verify.DNSNames))
+	}
+	if len(c.Pinning.Pins) > 0 {
+		opts = append(opts, WithPinSet(PinSet{
+			Pins:       c.Pinning.Pins,
+			BackupPins: c.Pinning.BackupPins,
+			ReportOnly: c.Pinning.ReportOnly,
+			Report: func(err *PinError) {
+				log.Printf("tlsconf: %s", err)
+			},
+		}))
+	}
+
+	return opts, nil
+}
+
+// Build builds a tls.Config from the Config, resolving relative paths
+// against baseDir. Any given options are applied after the Config's.
+func (c *Config) Build(baseDir string, opts ...TLSConfigOption) (*tls.Config, error) {
+	configOpts, err := c.Options(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	return Build(append(configOpts, opts...)...)
+}
+
+// withAllowedNames only accepts peers whose cert has one of the allowed
+// common names or DNS names. When crypto/tls didn't verify the chain,
+// because of InsecureSkipVerify or a client auth mode that doesn't
+// verify, it is verified first, without checking the hostname: servers,
+// which set ClientAuth, verify clients against their client CAs, and
+// clients verify servers against their root CAs.
+func withAllowedNames(commonNames, dnsNames []string) TLSConfigOption {
+	return func(config *tls.Config) error {
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("no peer certificate")
+			}
+			certs := make([]*x509.Certificate, len(rawCerts))
+			for i, raw := range rawCerts {
+				c, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				certs[i] = c
+			}
+			leaf := certs[0]
+
+			if len(verifiedChains) == 0 {
+				intermediates := x509.NewCertPool()
+				for _, c := range certs[1:] {
+					intermediates.AddCert(c)
+				}
+				roots, usage := config.RootCAs, x509.ExtKeyUsageServerAuth
+				if config.ClientAuth != tls.NoClientCert {
+					// a nil pool would verify clients against the system roots
+					if config.ClientCAs == nil {
+						return fmt.Errorf("no client CAs to verify the peer certificate chain")
+					}
+					roots, usage = config.ClientCAs, x509.ExtKeyUsageClientAuth
+				}
+				_, err := leaf.Verify(x509.VerifyOptions{
+					Roots:         roots,
+					Intermediates: intermediates,
+					KeyUsages:     []x509.ExtKeyUsage{usage},
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			return verifyAllowedNames(commonNames, dnsNames)(leaf)
+		}
+		return nil
+	}
+}
+
+func verifyAllowedNames(commonNames, dnsNames []string) func(cert *x509.Certificate) error {
+	return func(cert *x509.Certificate) error {
+		for _, name := range commonNames {
+			if cert.Subject.CommonName == name {
+				return nil
+			}
+		}
+		for _, name := range dnsNames {
+			for _, certName := range cert.DNSNames {
+				if strings.EqualFold(certName, name) {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("peer certificate %q does not match any allowed name", cert.Subject.CommonName)
+	}
+}
@@ -0,0 +1,216 @@
+package tlsconf
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/picatz/mtls/internal/testpki"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestPKI writes a CA and a server cert/key pair signed by it into dir.
+func writeTestPKI(t *testing.T, dir string) {
+	pki := testpki.New(t)
+	pki.WriteCA(dir)
+
+	serverPEM, serverPrivKeyPEM := pki.ServerPEM()
+	pki.Write(dir, "server", serverPEM, serverPrivKeyPEM)
+}
+
+func TestFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTestPKI(t, dir)
+
+	configFile := filepath.Join(dir, "server.yaml")
+	err = ioutil.WriteFile(configFile, []byte(`
+profile: intermediate
+certificates:
+  - cert_file: server.pem
+    key_file: server.key.pem
+client_ca_files:
+  - ca.pem
+client_auth: require-and-verify
+alpn: [h2, http/1.1]
+`), 0600)
+	require.NoError(t, err)
+
+	config, err := FromFile(configFile)
+	require.NoError(t, err)
+	require.Len(t, config.Certificates, 1)
+	require.NotNil(t, config.ClientCAs)
+	require.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+	require.Equal(t, []string{"h2", "http/1.1"}, config.NextProtos)
+	require.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+	require.Empty(t, Audit(config))
+}
+
+func TestFromFileJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTestPKI(t, dir)
+
+	configFile := filepath.Join(dir, "client.json")
+	err = ioutil.WriteFile(configFile, []byte(`{
+  "profile": "modern",
+  "root_ca_files": ["ca.pem"],
+  "verify": {"insecure_skip_verify": true, "common_names": ["server"]}
+}`), 0600)
+	require.NoError(t, err)
+
+	config, err := FromFile(configFile)
+	require.NoError(t, err)
+	require.NotNil(t, config.RootCAs)
+	require.True(t, config.InsecureSkipVerify)
+	require.NotNil(t, config.VerifyPeerCertificate)
+
+	serverPEM, err := ioutil.ReadFile(filepath.Join(dir, "server.pem"))
+	require.NoError(t, err)
+	require.NoError(t, config.VerifyPeerCertificate(rawCerts(t, serverPEM), nil))
+}
+
+func rawCerts(t *testing.T, certsPEM []byte) [][]byte {
+	certs, err := cert.ParseCertificates(certsPEM)
+	require.NoError(t, err)
+	var raw [][]byte
+	for _, c := range certs {
+		raw = append(raw, c.Raw)
+	}
+	return raw
+}
+
+func TestFromFileAllowedNamesVerifiesChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTestPKI(t, dir)
+
+	config, err := FromBytes([]byte(`
+root_ca_files: [` + filepath.Join(dir, "ca.pem") + `]
+verify: {insecure_skip_verify: true, common_names: [server]}
+`))
+	require.NoError(t, err)
+
+	// a cert named "server" from another CA
+	otherCAPEM, otherCAPrivKeyPEM, err := cert.NewCA(cert.WithCommonName("ca"))
+	require.NoError(t, err)
+	otherPEM, _, err := cert.NewServerFromCA(bytes.NewReader(otherCAPrivKeyPEM), bytes.NewReader(otherCAPEM), cert.WithCommonName("server"))
+	require.NoError(t, err)
+	require.Error(t, config.VerifyPeerCertificate(rawCerts(t, otherPEM), nil))
+
+	// a self-signed cert named "server"
+	selfSignedPEM, _, err := cert.NewCA(cert.WithCommonName("server"))
+	require.NoError(t, err)
+	require.Error(t, config.VerifyPeerCertificate(rawCerts(t, selfSignedPEM), nil))
+
+	_, err = ParseConfig([]byte("verify: {insecure_skip_verify: true, common_names: [server]}"))
+	require.Error(t, err)
+}
+
+func TestFromFileAllowedNamesVerifiesClientChain(t *testing.T) {
+	dir := t.TempDir()
+	pki := testpki.New(t)
+	caFile, _ := pki.WriteCA(dir)
+	clientPEM, _ := pki.ClientPEM(cert.WithCommonName("alice"))
+
+	// a server that doesn't have crypto/tls verify clients
+	config, err := FromBytes([]byte(`
+client_ca_files: [` + caFile + `]
+client_auth: require-any
+verify: {common_names: [alice]}
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.VerifyPeerCertificate(rawCerts(t, clientPEM), nil))
+
+	// a client cert named "alice" from another CA
+	otherPKI := testpki.New(t)
+	otherPEM, _ := otherPKI.ClientPEM(cert.WithCommonName("alice"))
+	require.Error(t, config.VerifyPeerCertificate(rawCerts(t, otherPEM), nil))
+
+	// root CAs don't verify clients
+	_, err = FromBytes([]byte(`
+root_ca_files: [` + caFile + `]
+client_auth: require-any
+verify: {common_names: [alice]}
+`))
+	var errs FieldErrors
+	require.True(t, errors.As(err, &errs), err)
+	require.Equal(t, "client_auth", errs[0].Field)
+
+	config, err = Build(
+		WithRootCAFile(caFile),
+		func(config *tls.Config) error {
+			config.ClientAuth = tls.RequireAnyClientCert
+			return nil
+		},
+		withAllowedNames([]string{"alice"}, nil),
+	)
+	require.NoError(t, err)
+	require.Error(t, config.VerifyPeerCertificate(rawCerts(t, clientPEM), nil))
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	_, err := ParseConfig([]byte(`
+profile: legacy
+certificates:
+  - cert_file: server.pem
+client_auth: require-and-verify
+`))
+	require.Error(t, err)
+
+	errs, ok := err.(FieldErrors)
+	require.True(t, ok)
+	require.Len(t, errs, 3)
+
+	require.Equal(t, "profile", errs[0].Field)
+	require.Equal(t, 2, errs[0].Line)
+
+	require.Equal(t, "certificates[0].key_file", errs[1].Field)
+	require.Equal(t, 4, errs[1].Line)
+
+	require.Equal(t, "client_auth", errs[2].Field)
+	require.Equal(t, 5, errs[2].Line)
+	require.Contains(t, errs[2].Error(), "line 5: client_auth")
+}
+
+func TestParseConfigUnknownField(t *testing.T) {
+	_, err := ParseConfig([]byte("profile: modern\nciphers: [rc4]\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "line 2")
+}
+
+func TestFromBytesMissingFile(t *testing.T) {
+	_, err := FromBytes([]byte("root_ca_files: [does-not-exist.pem]\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "line 1: root_ca_files[0]")
+}
+
+func TestParseConfigPinning(t *testing.T) {
+	_, err := ParseConfig([]byte(`
+verify:
+  insecure_skip_verify: true
+pinning:
+  pins:
+    - 47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=
+  backup_pins:
+    - not-a-pin
+`))
+	require.Error(t, err)
+
+	errs, ok := err.(FieldErrors)
+	require.True(t, ok)
+	require.Len(t, errs, 1)
+	require.Equal(t, "pinning.backup_pins[0]", errs[0].Field)
+	require.Equal(t, 8, errs[0].Line)
+}
@@ -0,0 +1,139 @@
+package tlsconf
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+)
+
+// Role is what a cert and key pair is used for, which decides the
+// extended key usage it needs.
+type Role string
+
+const (
+	// RoleServer is a key pair presented by a TLS server.
+	RoleServer Role = "server"
+	// RoleClient is a key pair presented by a TLS client.
+	RoleClient Role = "client"
+)
+
+// extKeyUsage returns the extended key usage required for the role.
+func (r Role) extKeyUsage() x509.ExtKeyUsage {
+	if r == RoleClient {
+		return x509.ExtKeyUsageClientAuth
+	}
+	return x509.ExtKeyUsageServerAuth
+}
+
+// KeyPairCheck is an extra check of a cert and key pair loaded from
+// certFile. The private key is always checked.
+type KeyPairCheck func(certFile string, keyPair *tls.Certificate) error
+
+// WithinValidity checks the cert is within its validity window.
+func WithinValidity() KeyPairCheck {
+	return func(certFile string, keyPair *tls.Certificate) error {
+		leaf := keyPair.Leaf
+		now := time.Now()
+		if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+			return &ExpiredCertError{
+				Path:      certFile,
+				Subject:   leaf.Subject.CommonName,
+				NotBefore: leaf.NotBefore,
+				NotAfter:  leaf.NotAfter,
+				Time:      now,
+			}
+		}
+		return nil
+	}
+}
+
+// ForRole checks the cert's extended key usage allows it to be used
+// for the role. Certs without extended key usages are allowed any use.
+func ForRole(role Role) KeyPairCheck {
+	return func(certFile string, keyPair *tls.Certificate) error {
+		leaf := keyPair.Leaf
+		if len(leaf.ExtKeyUsage) == 0 {
+			return nil
+		}
+		for _, usage := range leaf.ExtKeyUsage {
+			if usage == x509.ExtKeyUsageAny || usage == role.extKeyUsage() {
+				return nil
+			}
+		}
+		return &WrongUsageError{
+			Path:        certFile,
+			Subject:     leaf.Subject.CommonName,
+			Role:        role,
+			ExtKeyUsage: leaf.ExtKeyUsage,
+		}
+	}
+}
+
+// SignedBy checks the cert chains to one of the CA certs in the given
+// PEM file, using any other certs in the cert file as intermediates.
+func SignedBy(caPEMFile string) KeyPairCheck {
+	return func(certFile string, keyPair *tls.Certificate) error {
+		caPEM, err := readFile(caPEMFile)
+		if err != nil {
+			return err
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caPEM) {
+			return &BadPEMError{Path: caPEMFile, Reason: "no certificates found"}
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, der := range keyPair.Certificate[1:] {
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return &BadPEMError{Path: certFile, Reason: err.Error()}
+			}
+			intermediates.AddCert(cert)
+		}
+
+		_, err = keyPair.Leaf.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return &UntrustedCertError{
+				Path:    certFile,
+				Subject: keyPair.Leaf.Subject.CommonName,
+				CAFile:  caPEMFile,
+				Err:     err,
+			}
+		}
+		return nil
+	}
+}
+
+// LoadX509KeyPair loads a cert and key pair, checking the private key
+// matches the cert before applying the given checks. Failures are
+// returned as typed errors.
+func LoadX509KeyPair(certFile, keyFile string, checks ...KeyPairCheck) (tls.Certificate, error) {
+	keyPair, err := loadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	for _, check := range checks {
+		err := check(certFile, &keyPair)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	return keyPair, nil
+}
+
+// WithVerifiedX509KeyPair is like WithX509KeyPair, but also applies
+// the given checks to the loaded cert and key pair.
+func WithVerifiedX509KeyPair(certFile, keyFile string, checks ...KeyPairCheck) TLSConfigOption {
+	return func(config *tls.Config) error {
+		cert, err := LoadX509KeyPair(certFile, keyFile, checks...)
+		if err != nil {
+			return err
+		}
+		config.Certificates = append(config.Certificates, cert)
+		return nil
+	}
+}
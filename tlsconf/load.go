@@ -0,0 +1,110 @@
+package tlsconf
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/picatz/mtls/cert"
+)
+
+// readFile reads the file at path, returning a MissingFileError if it
+// can't be read.
+func readFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, &MissingFileError{Path: path, Err: err}
+	}
+	return data, nil
+}
+
+// loadX509KeyPair is like tls.LoadX509KeyPair, but returns typed errors
+// and sets the key pair's leaf.
+func loadX509KeyPair(certFile, keyFile string) (tls.Certificate, error) {
+	certPEM, err := readFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyPEM, err := readFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	var keyPair tls.Certificate
+	rest := certPEM
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			keyPair.Certificate = append(keyPair.Certificate, block.Bytes)
+		}
+	}
+	if len(keyPair.Certificate) == 0 {
+		return tls.Certificate{}, &BadPEMError{Path: certFile, Reason: "no CERTIFICATE block found"}
+	}
+
+	leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return tls.Certificate{}, &BadPEMError{Path: certFile, Reason: err.Error()}
+	}
+	keyPair.Leaf = leaf
+
+	// like tls.X509KeyPair, skip other blocks such as the EC PARAMETERS
+	// block openssl writes before EC keys
+	var keyBlock *pem.Block
+	rest = keyPEM
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "PRIVATE KEY" || strings.HasSuffix(block.Type, " PRIVATE KEY") {
+			keyBlock = block
+			break
+		}
+	}
+	if keyBlock == nil {
+		return tls.Certificate{}, &BadPEMError{Path: keyFile, Reason: "no private key block found"}
+	}
+	key, err := parsePrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return tls.Certificate{}, &BadPEMError{Path: keyFile, Reason: err.Error()}
+	}
+	keyPair.PrivateKey = key
+
+	if !cert.KeyMatches(leaf.PublicKey, key) {
+		return tls.Certificate{}, &KeyMismatchError{
+			CertFile: certFile,
+			KeyFile:  keyFile,
+			Err:      &cert.KeyMismatchError{Subject: leaf.Subject.CommonName},
+		}
+	}
+
+	return keyPair, nil
+}
+
+// parsePrivateKey parses a PKCS #8, PKCS #1 or SEC 1 DER encoded key.
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%T private key type not supported", key)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("failed to parse private key")
+}
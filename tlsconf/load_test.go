@@ -0,0 +1,190 @@
+package tlsconf
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/picatz/mtls/internal/testpki"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, data, 0600))
+	return path
+}
+
+func TestDefaultServerTLSConfigErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	caPEM, caPrivKeyPEM, err := cert.NewCA(cert.WithCommonName("ca"))
+	require.NoError(t, err)
+	caFile := writeTestFile(t, dir, "ca.pem", caPEM)
+
+	serverPEM, serverPrivKeyPEM, err := cert.NewServerFromCA(
+		bytes.NewReader(caPrivKeyPEM),
+		bytes.NewReader(caPEM),
+		cert.WithCommonName("server"),
+	)
+	require.NoError(t, err)
+	serverFile := writeTestFile(t, dir, "server.pem", serverPEM)
+	serverKeyFile := writeTestFile(t, dir, "server.key.pem", serverPrivKeyPEM)
+
+	expiredPEM, expiredPrivKeyPEM, err := cert.NewServerFromCA(
+		bytes.NewReader(caPrivKeyPEM),
+		bytes.NewReader(caPEM),
+		cert.WithCommonName("expired"),
+		cert.IsValidFor(-time.Hour),
+	)
+	require.NoError(t, err)
+	expiredFile := writeTestFile(t, dir, "expired.pem", expiredPEM)
+	expiredKeyFile := writeTestFile(t, dir, "expired.key.pem", expiredPrivKeyPEM)
+
+	badPEMFile := writeTestFile(t, dir, "bad.pem", []byte("not a PEM file"))
+
+	config, err := DefaultServerTLSConfig(caFile, serverFile, serverKeyFile)
+	require.NoError(t, err)
+	require.NotNil(t, config.Certificates[0].Leaf)
+
+	_, err = DefaultServerTLSConfig(filepath.Join(dir, "missing.pem"), serverFile, serverKeyFile)
+	var missingErr *MissingFileError
+	require.True(t, errors.As(err, &missingErr), err)
+	require.True(t, os.IsNotExist(errors.Unwrap(missingErr)))
+
+	_, err = DefaultServerTLSConfig(badPEMFile, serverFile, serverKeyFile)
+	var badPEMErr *BadPEMError
+	require.True(t, errors.As(err, &badPEMErr), err)
+	require.Equal(t, badPEMFile, badPEMErr.Path)
+
+	_, err = DefaultServerTLSConfig(caFile, serverFile, badPEMFile)
+	require.True(t, errors.As(err, &badPEMErr), err)
+
+	_, err = DefaultServerTLSConfig(caFile, serverFile, expiredKeyFile)
+	var mismatchErr *KeyMismatchError
+	require.True(t, errors.As(err, &mismatchErr), err)
+	var certMismatchErr *cert.KeyMismatchError
+	require.True(t, errors.As(err, &certMismatchErr), err)
+	require.Equal(t, "server", certMismatchErr.Subject)
+
+	_, err = DefaultServerTLSConfig(caFile, expiredFile, expiredKeyFile)
+	var expiredErr *ExpiredCertError
+	require.True(t, errors.As(err, &expiredErr), err)
+	require.Equal(t, "expired", expiredErr.Subject)
+	require.Contains(t, expiredErr.Error(), "expired at")
+
+	// the validity window is only checked when asked for
+	_, err = Build(WithX509KeyPair(expiredFile, expiredKeyFile))
+	require.NoError(t, err)
+
+	_, err = DefaultClientTLSConfig(filepath.Join(dir, "missing.pem"), serverFile, serverKeyFile)
+	require.True(t, errors.As(err, &missingErr), err)
+}
+
+func TestLoadX509KeyPairChecks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconf")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	caPEM, caPrivKeyPEM, err := cert.NewCA(cert.WithCommonName("ca"))
+	require.NoError(t, err)
+	caFile := writeTestFile(t, dir, "ca.pem", caPEM)
+
+	otherCAPEM, _, err := cert.NewCA(cert.WithCommonName("other"))
+	require.NoError(t, err)
+	otherCAFile := writeTestFile(t, dir, "other.pem", otherCAPEM)
+
+	clientPEM, clientPrivKeyPEM, err := cert.NewClientFromCA(
+		bytes.NewReader(caPrivKeyPEM),
+		bytes.NewReader(caPEM),
+		cert.WithCommonName("client"),
+	)
+	require.NoError(t, err)
+	clientFile := writeTestFile(t, dir, "client.pem", clientPEM)
+	clientKeyFile := writeTestFile(t, dir, "client.key.pem", clientPrivKeyPEM)
+
+	intermediatePEM, intermediatePrivKeyPEM, err := cert.NewIntermediateFromCA(
+		bytes.NewReader(caPrivKeyPEM),
+		bytes.NewReader(caPEM),
+		cert.WithCommonName("intermediate"),
+	)
+	require.NoError(t, err)
+
+	serverPEM, serverPrivKeyPEM, err := cert.NewServerFromCA(
+		bytes.NewReader(intermediatePrivKeyPEM),
+		bytes.NewReader(intermediatePEM),
+		cert.WithCommonName("server"),
+	)
+	require.NoError(t, err)
+	serverFile := writeTestFile(t, dir, "server.pem", append(serverPEM, intermediatePEM...))
+	serverKeyFile := writeTestFile(t, dir, "server.key.pem", serverPrivKeyPEM)
+
+	keyPair, err := LoadX509KeyPair(serverFile, serverKeyFile, ForRole(RoleServer), SignedBy(caFile))
+	require.NoError(t, err)
+	require.Equal(t, "server", keyPair.Leaf.Subject.CommonName)
+
+	_, err = LoadX509KeyPair(clientFile, clientKeyFile, ForRole(RoleClient), SignedBy(caFile))
+	require.NoError(t, err)
+
+	_, err = LoadX509KeyPair(clientFile, clientKeyFile, ForRole(RoleServer))
+	var usageErr *WrongUsageError
+	require.True(t, errors.As(err, &usageErr), err)
+	require.Equal(t, RoleServer, usageErr.Role)
+	require.Equal(t, clientFile, usageErr.Path)
+
+	_, err = DefaultServerTLSConfig(caFile, clientFile, clientKeyFile)
+	require.True(t, errors.As(err, &usageErr), err)
+
+	_, err = LoadX509KeyPair(clientFile, clientKeyFile, SignedBy(otherCAFile))
+	var untrustedErr *UntrustedCertError
+	require.True(t, errors.As(err, &untrustedErr), err)
+	require.Equal(t, otherCAFile, untrustedErr.CAFile)
+
+	// the CA file verifies the server, not the client's own cert
+	_, err = DefaultClientTLSConfig(otherCAFile, clientFile, clientKeyFile)
+	require.NoError(t, err)
+
+	_, err = LoadX509KeyPair(clientFile, clientKeyFile, SignedBy(filepath.Join(dir, "missing.pem")))
+	var missingErr *MissingFileError
+	require.True(t, errors.As(err, &missingErr), err)
+}
+
+func TestLoadX509KeyPairOpenSSLECKey(t *testing.T) {
+	dir := t.TempDir()
+	pki := testpki.New(t)
+	certPEM, keyPEM := pki.ClientPEM(cert.WithCommonName("client"))
+
+	// openssl ecparam -genkey writes an EC PARAMETERS block before the
+	// SEC 1 encoded key
+	key := pki.KeyPair(certPEM, keyPEM).PrivateKey.(*ecdsa.PrivateKey)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	params, err := asn1.Marshal(asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7})
+	require.NoError(t, err)
+	opensslKeyPEM := append(
+		pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: params}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})...,
+	)
+	certFile, keyFile := pki.Write(dir, "client", certPEM, opensslKeyPEM)
+
+	_, err = tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	keyPair, err := LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	require.True(t, key.Equal(keyPair.PrivateKey))
+
+	_, err = Build(WithX509KeyPair(certFile, keyFile))
+	require.NoError(t, err)
+}
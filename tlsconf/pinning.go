@@ -0,0 +1,122 @@
+package tlsconf
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/picatz/mtls/cert"
+)
+
+// PinSet is a set of SPKI pins, as returned by cert.SPKIPin, that a
+// peer's certificate chain must match.
+type PinSet struct {
+	// Pins are the pins of the keys currently in use.
+	Pins []string
+	// BackupPins are the pins of keys that are not in use yet, so the
+	// peer's key can be rotated without breaking pinned clients.
+	BackupPins []string
+	// ReportOnly allows connections that fail to match any pin, after
+	// reporting them.
+	ReportOnly bool
+	// Report is called with every pinning failure, if set.
+	Report func(*PinError)
+}
+
+// PinError is returned when none of the peer's certificates match a pin.
+type PinError struct {
+	// PeerPins are the pins of the peer's certificates that were checked.
+	PeerPins []string
+}
+
+func (e *PinError) Error() string {
+	return fmt.Sprintf("peer certificate pins %v do not match any pinned public key", e.PeerPins)
+}
+
+// parsePin validates a base64 encoded SHA-256 pin, optionally prefixed
+// with "sha256/", and returns it without the prefix.
+func parsePin(pin string) (string, error) {
+	pin = strings.TrimPrefix(pin, "sha256/")
+	raw, err := base64.StdEncoding.DecodeString(pin)
+	if err != nil {
+		return "", fmt.Errorf("invalid pin %q: %w", pin, err)
+	}
+	if len(raw) != sha256.Size {
+		return "", fmt.Errorf("invalid pin %q: not a SHA-256 hash", pin)
+	}
+	return pin, nil
+}
+
+// WithPinnedPublicKeys requires one of the peer's certificates to match
+// one of the given SPKI pins.
+func WithPinnedPublicKeys(pins ...string) TLSConfigOption {
+	return WithPinSet(PinSet{Pins: pins})
+}
+
+// WithPinSet requires one of the peer's certificates to match one of the
+// pins in the given PinSet. Any VerifyPeerCertificate function already
+// configured is still run first. WithCustomPeerCertificateVerification
+// replaces the function, so it must be applied before WithPinSet.
+//
+// When chain verification is enabled, every certificate in the verified
+// chains is checked. Otherwise only the peer's leaf certificate, which
+// proved possession of its private key during the handshake, is checked.
+func WithPinSet(set PinSet) TLSConfigOption {
+	return func(config *tls.Config) error {
+		pins := map[string]bool{}
+		for _, pin := range append(append([]string{}, set.Pins...), set.BackupPins...) {
+			parsed, err := parsePin(pin)
+			if err != nil {
+				return err
+			}
+			pins[parsed] = true
+		}
+		if len(pins) == 0 {
+			return fmt.Errorf("no pins given")
+		}
+
+		next := config.VerifyPeerCertificate
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			if next != nil {
+				err := next(rawCerts, verifiedChains)
+				if err != nil {
+					return err
+				}
+			}
+
+			var peerCerts []*x509.Certificate
+			if len(verifiedChains) > 0 {
+				for _, chain := range verifiedChains {
+					peerCerts = append(peerCerts, chain...)
+				}
+			} else if len(rawCerts) > 0 {
+				leaf, err := x509.ParseCertificate(rawCerts[0])
+				if err != nil {
+					return err
+				}
+				peerCerts = append(peerCerts, leaf)
+			}
+
+			pinErr := &PinError{}
+			for _, c := range peerCerts {
+				pin := cert.SPKIPin(c)
+				if pins[pin] {
+					return nil
+				}
+				pinErr.PeerPins = append(pinErr.PeerPins, pin)
+			}
+
+			if set.Report != nil {
+				set.Report(pinErr)
+			}
+			if set.ReportOnly {
+				return nil
+			}
+			return pinErr
+		}
+		return nil
+	}
+}
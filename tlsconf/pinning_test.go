@@ -0,0 +1,161 @@
+package tlsconf
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/stretchr/testify/require"
+)
+
+// handshake runs a TLS handshake between the given configs over a
+// loopback connection, returning the client's error.
+func handshake(serverConfig, clientConfig *tls.Config) error {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func TestWithPinnedPublicKeys(t *testing.T) {
+	caPEM, caPrivKeyPEM, err := cert.NewCA(cert.WithCommonName("ca"))
+	require.NoError(t, err)
+
+	serverPEM, serverPrivKeyPEM, err := cert.NewServerFromCA(
+		bytes.NewReader(caPrivKeyPEM),
+		bytes.NewReader(caPEM),
+		cert.WithCommonName("server"),
+	)
+	require.NoError(t, err)
+
+	serverKeyPair, err := tls.X509KeyPair(serverPEM, serverPrivKeyPEM)
+	require.NoError(t, err)
+
+	serverConfig, err := Build(WithCertificates([]tls.Certificate{serverKeyPair}))
+	require.NoError(t, err)
+
+	serverPin, err := cert.SPKIPinFromPEM(serverPEM)
+	require.NoError(t, err)
+
+	caPin, err := cert.SPKIPinFromPEM(caPEM)
+	require.NoError(t, err)
+
+	otherPEM, _, err := cert.NewCA(cert.WithCommonName("other"))
+	require.NoError(t, err)
+
+	otherPin, err := cert.SPKIPinFromPEM(otherPEM)
+	require.NoError(t, err)
+
+	t.Run("leaf pin without chain verification", func(t *testing.T) {
+		clientConfig, err := Build(
+			WithInsecureVerfication(),
+			WithPinnedPublicKeys("sha256/"+serverPin),
+		)
+		require.NoError(t, err)
+		require.NoError(t, handshake(serverConfig, clientConfig))
+	})
+
+	t.Run("CA pin in verified chain", func(t *testing.T) {
+		clientConfig, err := Build(WithPinnedPublicKeys(caPin))
+		require.NoError(t, err)
+
+		leaf, err := x509.ParseCertificate(serverKeyPair.Certificate[0])
+		require.NoError(t, err)
+
+		ca, err := x509.ParseCertificate(mustDecodePEM(t, caPEM))
+		require.NoError(t, err)
+
+		verifiedChains := [][]*x509.Certificate{{leaf, ca}}
+		require.NoError(t, clientConfig.VerifyPeerCertificate(serverKeyPair.Certificate, verifiedChains))
+
+		verifiedChains = [][]*x509.Certificate{{leaf}}
+		require.Error(t, clientConfig.VerifyPeerCertificate(serverKeyPair.Certificate, verifiedChains))
+	})
+
+	t.Run("backup pin", func(t *testing.T) {
+		clientConfig, err := Build(
+			WithInsecureVerfication(),
+			WithPinSet(PinSet{
+				Pins:       []string{otherPin},
+				BackupPins: []string{serverPin},
+			}),
+		)
+		require.NoError(t, err)
+		require.NoError(t, handshake(serverConfig, clientConfig))
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		var reported *PinError
+		clientConfig, err := Build(
+			WithInsecureVerfication(),
+			WithPinSet(PinSet{
+				Pins:   []string{otherPin},
+				Report: func(err *PinError) { reported = err },
+			}),
+		)
+		require.NoError(t, err)
+		require.Error(t, handshake(serverConfig, clientConfig))
+		require.NotNil(t, reported)
+		require.Equal(t, []string{serverPin}, reported.PeerPins)
+	})
+
+	t.Run("report only", func(t *testing.T) {
+		var reported *PinError
+		clientConfig, err := Build(
+			WithInsecureVerfication(),
+			WithPinSet(PinSet{
+				Pins:       []string{otherPin},
+				ReportOnly: true,
+				Report:     func(err *PinError) { reported = err },
+			}),
+		)
+		require.NoError(t, err)
+		require.NoError(t, handshake(serverConfig, clientConfig))
+		require.NotNil(t, reported)
+	})
+
+	t.Run("after custom verification", func(t *testing.T) {
+		var called bool
+		clientConfig, err := Build(
+			WithInsecureVerfication(),
+			WithCustomPeerCertificateVerification(func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+				called = true
+				return nil
+			}),
+			WithPinnedPublicKeys(otherPin),
+		)
+		require.NoError(t, err)
+		require.Error(t, handshake(serverConfig, clientConfig))
+		require.True(t, called)
+	})
+
+	t.Run("invalid pin", func(t *testing.T) {
+		_, err := Build(WithPinnedPublicKeys("not-a-pin"))
+		require.Error(t, err)
+	})
+}
+
+func mustDecodePEM(t *testing.T, data []byte) []byte {
+	block, _ := pem.Decode(data)
+	require.NotNil(t, block)
+	return block.Bytes
+}
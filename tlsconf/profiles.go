@@ -0,0 +1,98 @@
+package tlsconf
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// Profile is a named set of TLS versions, cipher suites and curves
+// that are applied together to a tls.Config.
+type Profile struct {
+	Name             string
+	MinVersion       uint16
+	MaxVersion       uint16
+	CipherSuites     []uint16
+	CurvePreferences []tls.CurveID
+}
+
+// ModernProfile only allows TLS 1.3. Cipher suites are not configurable
+// for TLS 1.3 in crypto/tls, and all of its suites are AEAD.
+var ModernProfile = Profile{
+	Name:       "modern",
+	MinVersion: tls.VersionTLS13,
+	CurvePreferences: []tls.CurveID{
+		tls.X25519,
+		tls.CurveP256,
+		tls.CurveP384,
+	},
+}
+
+// IntermediateProfile allows TLS 1.2 and above, limited to ECDHE key
+// exchange with AEAD cipher suites.
+var IntermediateProfile = Profile{
+	Name:       "intermediate",
+	MinVersion: tls.VersionTLS12,
+	CipherSuites: []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	},
+	CurvePreferences: []tls.CurveID{
+		tls.X25519,
+		tls.CurveP256,
+		tls.CurveP384,
+	},
+}
+
+// FIPSProfile only allows approved algorithms: TLS 1.2, ECDHE over the
+// NIST curves, and AES-GCM. TLS 1.3 is not allowed, since crypto/tls
+// doesn't let its cipher suites be configured, and would negotiate
+// TLS_CHACHA20_POLY1305_SHA256. The profile limits algorithms, but FIPS
+// compliance also needs a validated module, such as a Go toolchain
+// running in FIPS 140-3 mode.
+var FIPSProfile = Profile{
+	Name:       "fips",
+	MinVersion: tls.VersionTLS12,
+	MaxVersion: tls.VersionTLS12,
+	CipherSuites: []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	},
+	CurvePreferences: []tls.CurveID{
+		tls.CurveP256,
+		tls.CurveP384,
+	},
+}
+
+// Profiles contains each built-in Profile by name.
+var Profiles = map[string]Profile{
+	ModernProfile.Name:       ModernProfile,
+	IntermediateProfile.Name: IntermediateProfile,
+	FIPSProfile.Name:         FIPSProfile,
+}
+
+// ProfileByName returns the built-in Profile with the given name.
+func ProfileByName(name string) (Profile, error) {
+	p, ok := Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown tls profile %q", name)
+	}
+	return p, nil
+}
+
+// WithProfile sets the versions, cipher suites and curves of the given
+// Profile, replacing any previously configured values.
+func WithProfile(p Profile) TLSConfigOption {
+	return func(config *tls.Config) error {
+		config.MinVersion = p.MinVersion
+		config.MaxVersion = p.MaxVersion
+		config.CipherSuites = append([]uint16(nil), p.CipherSuites...)
+		config.CurvePreferences = append([]tls.CurveID(nil), p.CurvePreferences...)
+		return nil
+	}
+}
@@ -0,0 +1,49 @@
+package tlsconf
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfilesHaveNoWarnings(t *testing.T) {
+	for name, profile := range Profiles {
+		config, err := Build(WithProfile(profile))
+		require.NoError(t, err)
+		require.Empty(t, Validate(config), name)
+	}
+}
+
+func TestProfileByName(t *testing.T) {
+	p, err := ProfileByName("modern")
+	require.NoError(t, err)
+	require.Equal(t, uint16(tls.VersionTLS13), p.MinVersion)
+
+	p, err = ProfileByName("fips")
+	require.NoError(t, err)
+	require.Equal(t, uint16(tls.VersionTLS12), p.MaxVersion)
+
+	_, err = ProfileByName("legacy")
+	require.Error(t, err)
+}
+
+func TestValidateWeakSettings(t *testing.T) {
+	config, err := Build(
+		WithProfile(IntermediateProfile),
+		WithMinVersion(tls.VersionTLS10),
+		WithCipherSuites([]uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA,
+			tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+		}),
+	)
+	require.NoError(t, err)
+
+	warnings := Validate(config)
+	require.Len(t, warnings, 3)
+	require.Equal(t, "MinVersion", warnings[0].Setting)
+	require.Equal(t, "CipherSuites", warnings[1].Setting)
+	require.Contains(t, warnings[1].Message, "TLS_ECDHE_ECDSA_WITH_RC4_128_SHA")
+	require.Equal(t, "CipherSuites", warnings[2].Setting)
+}
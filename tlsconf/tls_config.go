@@ -3,21 +3,18 @@ package tlsconf
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
-	"os"
+	"sync"
 )
 
 func Build(opts ...TLSConfigOption) (*tls.Config, error) {
 	config := &tls.Config{}
-
-	for _, opt := range opts {
-		err := opt(config)
-		if err != nil {
-			return nil, err
-		}
+	err := apply(config, opts)
+	if err != nil {
+		return nil, err
 	}
 
 	//config.BuildNameToCertificate()
@@ -26,16 +23,24 @@ func Build(opts ...TLSConfigOption) (*tls.Config, error) {
 
 type TLSConfigOption func(*tls.Config) error
 
-func WithBaseConfig(baseConfig *tls.Config) TLSConfigOption {
-	return func(config *tls.Config) error {
-		config = baseConfig
-		return nil
+// apply applies the options to the config in order.
+func apply(config *tls.Config, opts []TLSConfigOption) error {
+	for i, opt := range opts {
+		err := opt(config)
+		var merge *mergeBaseConfig
+		if errors.As(err, &merge) {
+			err = merge.merge(config, opts[:i])
+		}
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 func WithX509KeyPair(certFile string, keyFile string) TLSConfigOption {
 	return func(config *tls.Config) error {
-		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		cert, err := loadX509KeyPair(certFile, keyFile)
 		if err != nil {
 			return err
 		}
@@ -46,33 +51,30 @@ func WithX509KeyPair(certFile string, keyFile string) TLSConfigOption {
 
 func WithCAFile(caPEMFile string) TLSConfigOption {
 	return func(config *tls.Config) error {
-		file, err := os.Open(caPEMFile)
+		caCert, err := readFile(caPEMFile)
 		if err != nil {
 			return err
 		}
-		defer file.Close()
-		return WithCACertificates(file)(config)
+
+		ok := appendCAsFromPEM(config, true, caCert)
+		if !ok {
+			return &BadPEMError{Path: caPEMFile, Reason: "no certificates found"}
+		}
+		return nil
 	}
 }
 
 func WithRootCAFile(caPEMFile string) TLSConfigOption {
 	return func(config *tls.Config) error {
-		caCert, err := ioutil.ReadFile(caPEMFile)
+		caCert, err := readFile(caPEMFile)
 		if err != nil {
-			log.Fatalf("failed to load cert: %s", err)
+			return err
 		}
 
-		if config.RootCAs == nil {
-			caCertPool := x509.NewCertPool()
-			ok := caCertPool.AppendCertsFromPEM(caCert)
-			if !ok {
-				return fmt.Errorf("failed to append certs from PEM: %q", string(caCert))
-			}
-			config.RootCAs = caCertPool
-		} else {
-			config.RootCAs.AppendCertsFromPEM(caCert)
+		ok := appendCAsFromPEM(config, false, caCert)
+		if !ok {
+			return &BadPEMError{Path: caPEMFile, Reason: "no certificates found"}
 		}
-
 		return nil
 	}
 }
@@ -86,20 +88,33 @@ func WithCertificates(certs []tls.Certificate) TLSConfigOption {
 	}
 }
 
+// WithCACertificates adds the PEM certificates read from the readers to
+// the client CA pool. The readers are read once, the first time the
+// option is applied, so it can be applied again.
 func WithCACertificates(certs ...io.Reader) TLSConfigOption {
+	var (
+		once    sync.Once
+		certPEM [][]byte
+		readErr error
+	)
 	return func(config *tls.Config) error {
-		if config.ClientCAs == nil {
-			config.ClientCAs = x509.NewCertPool()
-		}
-
-		for _, cert := range certs {
-			bytes, err := ioutil.ReadAll(cert)
-			if err != nil {
-				return err
+		once.Do(func() {
+			for _, cert := range certs {
+				bytes, err := ioutil.ReadAll(cert)
+				if err != nil {
+					readErr = err
+					return
+				}
+				certPEM = append(certPEM, bytes)
 			}
-			ok := config.ClientCAs.AppendCertsFromPEM(bytes)
+		})
+		if readErr != nil {
+			return readErr
+		}
+		for _, bytes := range certPEM {
+			ok := appendCAsFromPEM(config, true, bytes)
 			if !ok {
-				return fmt.Errorf("unable to append cert from cert: \n%s", bytes)
+				return &BadPEMError{Reason: "no certificates found"}
 			}
 		}
 		return nil
@@ -134,6 +149,20 @@ func WithCipherSuites(cipherSuites []uint16) TLSConfigOption {
 	}
 }
 
+func WithNextProtos(protos ...string) TLSConfigOption {
+	return func(config *tls.Config) error {
+		config.NextProtos = append(config.NextProtos, protos...)
+		return nil
+	}
+}
+
+func WithServerName(name string) TLSConfigOption {
+	return func(config *tls.Config) error {
+		config.ServerName = name
+		return nil
+	}
+}
+
 func WithMutualAuthentication() TLSConfigOption {
 	return func(config *tls.Config) error {
 		config.ClientAuth = tls.RequireAndVerifyClientCert
@@ -150,6 +179,9 @@ func WithInsecureVerfication() TLSConfigOption {
 
 type VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
 
+// WithCustomPeerCertificateVerification sets the config's
+// VerifyPeerCertificate function, replacing any set by earlier options
+// such as WithPinSet. Apply those options after it to run both.
 func WithCustomPeerCertificateVerification(verifyFunc VerifyPeerCertificate) TLSConfigOption {
 	return func(config *tls.Config) error {
 		config.VerifyPeerCertificate = verifyFunc
@@ -195,55 +227,72 @@ func VerifyFirstPeerCertCustom(certVertify func(cert *x509.Certificate) error) V
 	}
 }
 
-func BuildDefaultServerTLSConfig(caPemFile, serverCertPemFile, serverKeyPemFile string) *tls.Config {
-	config, _ := Build(
+// DefaultServerTLSConfig builds an mTLS server config which requires
+// clients to present a certificate signed by the given CA. The server
+// certificate must be a valid server certificate, but may be signed by
+// a different CA than its clients.
+func DefaultServerTLSConfig(caPemFile, serverCertPemFile, serverKeyPemFile string) (*tls.Config, error) {
+	return Build(
 		// used to verify the client cert is signed by the CA and is therefore valid
 		WithCAFile(caPemFile),
 		// server certificate which is validated by the client
-		WithX509KeyPair(serverCertPemFile, serverKeyPemFile),
+		WithVerifiedX509KeyPair(serverCertPemFile, serverKeyPemFile, WithinValidity(), ForRole(RoleServer)),
 		// this requires a valid client certificate to be supplied during handshake
 		WithMutualAuthentication(),
-		WithMinVersion(tls.VersionTLS12),
+		// TLS 1.2+ with ECDHE and AEAD cipher suites only
+		WithProfile(IntermediateProfile),
 		WithPreferenceForServerCipherSuites(),
-		WithCurvePreferences([]tls.CurveID{
-			tls.CurveP521,
-			tls.CurveP384,
-			tls.CurveP256,
-		}),
-		WithCipherSuites([]uint16{
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
-			tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA,
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
-			tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_RSA_WITH_AES_256_CBC_SHA,
-		}),
 	)
-
-	return config
 }
 
-func BuildDefaultClientTLSConfig(caPemFile, clientCertPemFile, clientKeyPemFile string) *tls.Config {
-	config, _ := Build(
+// DefaultClientTLSConfig builds an mTLS client config which verifies
+// the server is signed by the given CA. The client certificate must be
+// a valid client certificate, but may be signed by a different CA than
+// the server.
+func DefaultClientTLSConfig(caPemFile, clientCertPemFile, clientKeyPemFile string) (*tls.Config, error) {
+	return Build(
 		WithRootCAFile(caPemFile),
-		WithX509KeyPair(clientCertPemFile, clientKeyPemFile),
+		WithVerifiedX509KeyPair(clientCertPemFile, clientKeyPemFile, WithinValidity(), ForRole(RoleClient)),
 	)
-
-	return config
 }
 
-func BuildClientTLSConfigWithCustomVerification(caPemFile, clientCertPemFile, clientKeyPemFile string, verifyFunc VerifyPeerCertificate) *tls.Config {
-	config, _ := Build(
+// ClientTLSConfigWithCustomVerification builds an mTLS client config
+// which verifies the server using the given function instead of the
+// default hostname verification.
+func ClientTLSConfigWithCustomVerification(caPemFile, clientCertPemFile, clientKeyPemFile string, verifyFunc VerifyPeerCertificate) (*tls.Config, error) {
+	return Build(
 		WithRootCAFile(caPemFile),
 		WithX509KeyPair(clientCertPemFile, clientKeyPemFile),
 		WithInsecureVerfication(), // required to implement custom TLS certificate verification that doesn't require IP addresses
 		WithCustomPeerCertificateVerification(verifyFunc),
 	)
+}
 
+// BuildDefaultServerTLSConfig is like DefaultServerTLSConfig, but
+// returns nil instead of an error.
+//
+// Deprecated: Use DefaultServerTLSConfig, which returns the error.
+func BuildDefaultServerTLSConfig(caPemFile, serverCertPemFile, serverKeyPemFile string) *tls.Config {
+	config, _ := DefaultServerTLSConfig(caPemFile, serverCertPemFile, serverKeyPemFile)
+	return config
+}
+
+// BuildDefaultClientTLSConfig is like DefaultClientTLSConfig, but
+// returns nil instead of an error.
+//
+// Deprecated: Use DefaultClientTLSConfig, which returns the error.
+func BuildDefaultClientTLSConfig(caPemFile, clientCertPemFile, clientKeyPemFile string) *tls.Config {
+	config, _ := DefaultClientTLSConfig(caPemFile, clientCertPemFile, clientKeyPemFile)
+	return config
+}
+
+// BuildClientTLSConfigWithCustomVerification is like
+// ClientTLSConfigWithCustomVerification, but returns nil instead of an
+// error.
+//
+// Deprecated: Use ClientTLSConfigWithCustomVerification, which returns
+// the error.
+func BuildClientTLSConfigWithCustomVerification(caPemFile, clientCertPemFile, clientKeyPemFile string, verifyFunc VerifyPeerCertificate) *tls.Config {
+	config, _ := ClientTLSConfigWithCustomVerification(caPemFile, clientCertPemFile, clientKeyPemFile, verifyFunc)
 	return config
 }
@@ -0,0 +1,105 @@
+package tlsconf
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// Warning describes a weak setting found in a tls.Config.
+type Warning struct {
+	Setting string
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Setting, w.Message)
+}
+
+// strongCipherSuites are the TLS 1.2 cipher suites that use ECDHE key
+// exchange with an AEAD cipher.
+var strongCipherSuites = map[uint16]bool{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256: true,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:   true,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384: true,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:   true,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305:  true,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305:    true,
+}
+
+// strongCurves are the key exchange curves considered acceptable.
+var strongCurves = map[tls.CurveID]bool{
+	tls.X25519:         true,
+	tls.CurveP256:      true,
+	tls.CurveP384:      true,
+	tls.CurveP521:      true,
+	tls.X25519MLKEM768: true,
+}
+
+func isWeakCipherSuite(id uint16) bool {
+	return !strongCipherSuites[id]
+}
+
+func versionName(version uint16) string {
+	switch version {
+	case tls.VersionSSL30:
+		return "SSLv3"
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("0x%04x", version)
+	}
+}
+
+// Validate checks a tls.Config, usually one returned from Build, for
+// weak settings, such as legacy cipher suites mixed into a profile.
+// An empty result means no weak settings were found.
+func Validate(config *tls.Config) []Warning {
+	var warnings []Warning
+
+	if config.MinVersion != 0 && config.MinVersion < tls.VersionTLS12 {
+		warnings = append(warnings, Warning{
+			Setting: "MinVersion",
+			Message: fmt.Sprintf("allows %s, which is older than TLS 1.2", versionName(config.MinVersion)),
+		})
+	}
+
+	if config.MaxVersion != 0 && config.MinVersion > config.MaxVersion {
+		warnings = append(warnings, Warning{
+			Setting: "MaxVersion",
+			Message: fmt.Sprintf("%s is lower than MinVersion %s", versionName(config.MaxVersion), versionName(config.MinVersion)),
+		})
+	}
+
+	for _, id := range config.CipherSuites {
+		if isWeakCipherSuite(id) {
+			warnings = append(warnings, Warning{
+				Setting: "CipherSuites",
+				Message: fmt.Sprintf("includes weak cipher suite %s", tls.CipherSuiteName(id)),
+			})
+		}
+	}
+
+	for _, id := range config.CurvePreferences {
+		if !strongCurves[id] {
+			warnings = append(warnings, Warning{
+				Setting: "CurvePreferences",
+				Message: fmt.Sprintf("includes unrecognized curve %d", id),
+			})
+		}
+	}
+
+	if config.InsecureSkipVerify {
+		warnings = append(warnings, Warning{
+			Setting: "InsecureSkipVerify",
+			Message: "certificate verification is disabled",
+		})
+	}
+
+	return warnings
+}
@@ -0,0 +1,48 @@
+package tlsconf
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/picatz/mtls/cert"
+)
+
+// VerifyPeerSubject checks the subject of the first peer cert using the
+// given function, such as to authorize peers by organizational unit.
+func VerifyPeerSubject(check func(subject pkix.Name) error) VerifyPeerCertificate {
+	return VerifyFirstPeerCertCustom(func(c *x509.Certificate) error {
+		return check(c.Subject)
+	})
+}
+
+// VerifyPeerOrganizationalUnit requires the first peer cert to have at
+// least one of the given subject organizational units.
+func VerifyPeerOrganizationalUnit(units ...string) VerifyPeerCertificate {
+	return VerifyPeerSubject(func(subject pkix.Name) error {
+		for _, have := range subject.OrganizationalUnit {
+			for _, want := range units {
+				if have == want {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("peer organizational units %v are not one of %v", subject.OrganizationalUnit, units)
+	})
+}
+
+// VerifyPeerExtension requires the first peer cert to have an extension
+// with the given OID, whose DER encoded value is checked using the given
+// function. Use cert.ExtensionValue to decode it. The extension must not
+// be critical: chain verification fails with "unhandled critical
+// extension" before any custom verification runs.
+func VerifyPeerExtension(oid asn1.ObjectIdentifier, check func(value []byte) error) VerifyPeerCertificate {
+	return VerifyFirstPeerCertCustom(func(c *x509.Certificate) error {
+		ext, ok := cert.FindExtension(c, oid)
+		if !ok {
+			return fmt.Errorf("peer cert has no extension %s", oid)
+		}
+		return check(ext.Value)
+	})
+}
@@ -0,0 +1,106 @@
+package tlsconf
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/picatz/mtls/cert"
+	"github.com/picatz/mtls/internal/testpki"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyPeerSubjectAndExtension(t *testing.T) {
+	roleOID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 2}
+
+	certPEM, _, err := cert.New(
+		cert.WithNewECDSAKey(),
+		cert.WithCommonName("client"),
+		cert.WithOrganizationalUnit("payments"),
+		cert.WithExtensionValue(roleOID, false, "deployer"),
+	)
+	require.NoError(t, err)
+	block, _ := pem.Decode(certPEM)
+	rawCerts := [][]byte{block.Bytes}
+
+	require.NoError(t, VerifyPeerOrganizationalUnit("billing", "payments")(rawCerts, nil))
+	require.Error(t, VerifyPeerOrganizationalUnit("billing")(rawCerts, nil))
+
+	require.NoError(t, requireRole(roleOID, "deployer")(rawCerts, nil))
+	require.Error(t, requireRole(roleOID, "admin")(rawCerts, nil))
+	require.Error(t, VerifyPeerExtension(asn1.ObjectIdentifier{1, 2, 3}, func([]byte) error { return nil })(rawCerts, nil))
+}
+
+func requireRole(roleOID asn1.ObjectIdentifier, want string) VerifyPeerCertificate {
+	return VerifyPeerExtension(roleOID, func(value []byte) error {
+		var role string
+		_, err := asn1.Unmarshal(value, &role)
+		if err != nil {
+			return err
+		}
+		if role != want {
+			return fmt.Errorf("role %q is not %q", role, want)
+		}
+		return nil
+	})
+}
+
+// serverHandshake runs a TLS handshake between the given configs over a
+// loopback connection, returning the server's error.
+func serverHandshake(t *testing.T, serverConfig, clientConfig *tls.Config) error {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Handshake()
+		conn.Read(make([]byte, 1))
+	}()
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	return conn.(*tls.Conn).Handshake()
+}
+
+func TestVerifyPeerExtensionHandshake(t *testing.T) {
+	roleOID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 2}
+	pki := testpki.New(t)
+
+	serverConfig, err := Build(
+		WithCertificates([]tls.Certificate{pki.Server()}),
+		WithCACertificates(bytes.NewReader(pki.CAPEM)),
+		WithMutualAuthentication(),
+		WithCustomPeerCertificateVerification(requireRole(roleOID, "deployer")),
+	)
+	require.NoError(t, err)
+
+	clientConfig := func(critical bool) *tls.Config {
+		return &tls.Config{
+			Certificates: []tls.Certificate{pki.Client(
+				cert.WithCommonName("client"),
+				cert.WithExtensionValue(roleOID, critical, "deployer"),
+			)},
+			RootCAs:    pki.Pool,
+			ServerName: "localhost",
+		}
+	}
+
+	require.NoError(t, serverHandshake(t, serverConfig, clientConfig(false)))
+
+	// chain verification rejects the unknown critical extension before
+	// the extension is checked
+	err = serverHandshake(t, serverConfig, clientConfig(true))
+	var unhandled x509.UnhandledCriticalExtension
+	require.True(t, errors.As(err, &unhandled), err)
+}